@@ -0,0 +1,64 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kumina/openvpn_exporter/exporters"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Implements the bench subcommand, which measures the throughput of the
+// status file parser, to size the exporter for large servers.
+func runBench(args []string) {
+	flags := flag.NewFlagSet("openvpn_exporter bench", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: openvpn_exporter bench <status_path> [-n N] [-concurrency C]\n")
+		flags.PrintDefaults()
+	}
+	var (
+		parses      = flags.Int("n", 10000, "Number of times to parse the status file.")
+		concurrency = flags.Int("concurrency", runtime.GOMAXPROCS(0), "Number of status files to parse concurrently.")
+	)
+	// The status path may precede the flags.
+	var statusPath string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		statusPath, args = args[0], args[1:]
+	}
+	flags.Parse(args)
+	if statusPath == "" && flags.NArg() == 1 {
+		statusPath = flags.Arg(0)
+	}
+	if statusPath == "" || *parses < 1 || *concurrency < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	result, err := exporters.BenchmarkStatusFile(statusPath, *parses, *concurrency)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse %s: %s\n", statusPath, err)
+		os.Exit(1)
+	}
+	seconds := result.Duration.Seconds()
+	fmt.Printf("Parsed %s (%d lines) %d times using %d goroutines in %s\n",
+		statusPath, result.Lines, result.Parses, *concurrency, result.Duration)
+	fmt.Printf("Parses per second:     %.0f\n", float64(result.Parses)/seconds)
+	fmt.Printf("Lines per second:      %.0f\n", float64(result.Parses*result.Lines)/seconds)
+	fmt.Printf("Allocations per parse: %d (%d bytes)\n",
+		result.Allocations/uint64(result.Parses), result.AllocatedBytes/uint64(result.Parses))
+	fmt.Printf("Peak heap size:        %.1f MiB\n", float64(result.PeakHeapBytes)/(1<<20))
+}
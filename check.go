@@ -0,0 +1,46 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kumina/openvpn_exporter/exporters"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// Implements the check subcommand, which evaluates a single status file
+// as a Nagios/Icinga plugin.
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("openvpn_exporter check", flag.ExitOnError)
+	var (
+		statusPath = flags.String("openvpn.status_path", "", "Path of the status file to check, or a glob pattern matching the status files to check.")
+		warning    = flags.Duration("warn", 5*time.Minute, "Return a warning if the status file hasn't been updated for this long.")
+		critical   = flags.Duration("crit", 15*time.Minute, "Return a critical state if the status file hasn't been updated for this long.")
+	)
+	flags.Parse(args)
+	if *statusPath == "" {
+		fmt.Println("OPENVPN UNKNOWN - no status file given using -openvpn.status_path")
+		os.Exit(exporters.CheckUnknown)
+	}
+
+	// Plugin output is limited to stdout.
+	log.SetOutput(ioutil.Discard)
+	code, output := exporters.CheckStatusFile(*statusPath, *warning, *critical, time.Now())
+	fmt.Println(output)
+	os.Exit(code)
+}
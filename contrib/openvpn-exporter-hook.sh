@@ -0,0 +1,44 @@
+#!/bin/sh
+# Forwards OpenVPN client-connect/client-disconnect events to
+# openvpn_exporter. Configure OpenVPN as follows:
+#
+#   script-security 2
+#   client-connect /path/to/openvpn-exporter-hook.sh
+#   client-disconnect /path/to/openvpn-exporter-hook.sh
+#
+# The exporter must be started with -hooks.path=/hooks. The endpoint can be
+# changed with OPENVPN_EXPORTER_HOOK_URL, or OPENVPN_EXPORTER_HOOK_SOCKET to
+# talk to the socket set by -hooks.listen-socket. Otherwise, the token of
+# -hooks.token-file is read from OPENVPN_EXPORTER_HOOK_TOKEN_FILE.
+
+url="${OPENVPN_EXPORTER_HOOK_URL:-http://localhost:9176/hooks}"
+# Named after the configuration file by default, e.g. office for
+# /etc/openvpn/server/office.conf.
+instance="${OPENVPN_EXPORTER_INSTANCE:-$(basename "${config}" .conf)}"
+
+if [ -n "${OPENVPN_EXPORTER_HOOK_SOCKET}" ]; then
+	set -- --unix-socket "${OPENVPN_EXPORTER_HOOK_SOCKET}"
+elif [ -n "${OPENVPN_EXPORTER_HOOK_TOKEN_FILE}" ]; then
+	set -- -H "Authorization: Bearer $(cat "${OPENVPN_EXPORTER_HOOK_TOKEN_FILE}")"
+else
+	set --
+fi
+
+# Never fail the connection because the exporter is unavailable.
+curl -s -m 2 -o /dev/null "$@" \
+	--data-urlencode "instance_name=${instance}" \
+	--data-urlencode "script_type=${script_type}" \
+	--data-urlencode "common_name=${common_name}" \
+	--data-urlencode "username=${username}" \
+	--data-urlencode "trusted_ip=${trusted_ip}" \
+	--data-urlencode "trusted_ip6=${trusted_ip6}" \
+	--data-urlencode "trusted_port=${trusted_port}" \
+	--data-urlencode "ifconfig_pool_remote_ip=${ifconfig_pool_remote_ip}" \
+	--data-urlencode "time_unix=${time_unix}" \
+	--data-urlencode "iv_ver=${IV_VER}" \
+	--data-urlencode "iv_plat=${IV_PLAT}" \
+	--data-urlencode "bytes_received=${bytes_received}" \
+	--data-urlencode "bytes_sent=${bytes_sent}" \
+	--data-urlencode "time_duration=${time_duration}" \
+	"${url}"
+exit 0
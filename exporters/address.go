@@ -0,0 +1,117 @@
+package exporters
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Columns of CLIENT_LIST and ROUTING_TABLE entries holding addresses.
+var addressColumns = []string{"Real Address", "Virtual Address", "Virtual IPv6 Address"}
+
+// Protocol prefix that newer versions of OpenVPN add to real addresses,
+// e.g. udp4:192.0.2.1:1194.
+var addressProtocolPrefix = regexp.MustCompile(`^(udp|tcp)[46]?(-server|-client)?:`)
+
+// Returns the canonical form of an IP address, or false if it isn't one.
+// Zone identifiers are stripped, as they only have meaning on the host
+// running OpenVPN.
+func canonicalIP(address string) (string, bool) {
+	if i := strings.IndexByte(address, '%'); i >= 0 {
+		if strings.ContainsAny(address[i:], ":]") {
+			return "", false
+		}
+		address = address[:i]
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", false
+	}
+	return ip.String(), true
+}
+
+// Normalizes an address written by OpenVPN, so that the same client
+// doesn't end up having multiple series due to formatting differences
+// across versions of OpenVPN and sections of the status file. IPv6
+// addresses are compressed canonically and written in lowercase, zone
+// identifiers are stripped and MAC addresses of TAP clients are written
+// in lowercase. Addresses may be followed by a port or a prefix length.
+// Values that can't be parsed are returned as is.
+func normalizeAddress(address string) string {
+	prefix := addressProtocolPrefix.FindString(address)
+	rest := address[len(prefix):]
+
+	if ip, ok := canonicalIP(rest); ok {
+		return prefix + ip
+	}
+	if mac, err := net.ParseMAC(rest); err == nil {
+		return prefix + mac.String()
+	}
+	// Subnets of iroutes.
+	if i := strings.LastIndexByte(rest, '/'); i >= 0 {
+		if ip, ok := canonicalIP(rest[:i]); ok {
+			return prefix + ip + rest[i:]
+		}
+		return address
+	}
+	// Addresses followed by a port, with IPv6 addresses optionally
+	// enclosed in brackets.
+	if host, port, err := net.SplitHostPort(rest); err == nil {
+		if ip, ok := canonicalIP(host); ok {
+			if strings.HasPrefix(rest, "[") {
+				return prefix + net.JoinHostPort(ip, port)
+			}
+			return prefix + ip + ":" + port
+		}
+	} else if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		if ip, ok := canonicalIP(rest[:i]); ok {
+			return prefix + ip + rest[i:]
+		}
+	}
+	return address
+}
+
+// Normalizes a real address, which OpenVPN always writes followed by a
+// port. IPv6 addresses are written without brackets, e.g.
+// 2001:db8::1:1194, so unlike normalizeAddress, the last colon always
+// separates the port rather than being taken as part of the address.
+// Addresses enclosed in brackets are written without them, so that
+// addresses passed to scripts, joined with their port, match those of
+// the status file. Addresses that can't be split this way are normalized
+// like other addresses.
+func normalizeRealAddress(address string) string {
+	prefix := addressProtocolPrefix.FindString(address)
+	rest := address[len(prefix):]
+
+	var host, port string
+	if strings.HasPrefix(rest, "[") {
+		h, p, err := net.SplitHostPort(rest)
+		if err != nil {
+			return address
+		}
+		host, port = h, p
+	} else if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		host, port = rest[:i], rest[i+1:]
+	} else {
+		return normalizeAddress(address)
+	}
+	ip, ok := canonicalIP(host)
+	if !ok || strings.Trim(port, "0123456789") != "" {
+		// Addresses written without a port.
+		return normalizeAddress(address)
+	}
+	return prefix + ip + ":" + port
+}
+
+// Returns the IP address of a real address, without the port or protocol
+// prefix, or nil if it isn't an IP address.
+func addressIP(address string) net.IP {
+	address = normalizeRealAddress(address)
+	address = address[len(addressProtocolPrefix.FindString(address)):]
+	if i := strings.LastIndexByte(address, ':'); i >= 0 {
+		if ip := net.ParseIP(address[:i]); ip != nil {
+			return ip
+		}
+	}
+	return net.ParseIP(address)
+}
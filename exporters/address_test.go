@@ -0,0 +1,67 @@
+package exporters
+
+import (
+	"testing"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	for address, want := range map[string]string{
+		"10.8.0.2":                    "10.8.0.2",
+		"2001:DB8:0:0::2":             "2001:db8::2",
+		"fe80::1%eth0":                "fe80::1",
+		"AA:BB:CC:DD:EE:FF":           "aa:bb:cc:dd:ee:ff",
+		"10.8.1.0/24":                 "10.8.1.0/24",
+		"2001:DB8::/64":               "2001:db8::/64",
+		"192.0.2.1:1194":              "192.0.2.1:1194",
+		"[2001:DB8::1]:1194":          "[2001:db8::1]:1194",
+		"udp4:192.0.2.1:1194":         "udp4:192.0.2.1:1194",
+		"tcp6-server:[2001:DB8::1]:1": "tcp6-server:[2001:db8::1]:1",
+		"UNDEF":                       "UNDEF",
+		"":                            "",
+	} {
+		if got := normalizeAddress(address); got != want {
+			t.Errorf("normalizeAddress(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
+
+func TestNormalizeRealAddress(t *testing.T) {
+	for address, want := range map[string]string{
+		"192.0.2.1:1194":            "192.0.2.1:1194",
+		"udp4:192.0.2.1:51234":      "udp4:192.0.2.1:51234",
+		"2001:db8::1:1194":          "2001:db8::1:1194",
+		"2001:DB8:0:0::1:1194":      "2001:db8::1:1194",
+		"2001:db8::1:51234":         "2001:db8::1:51234",
+		"[2001:DB8::1]:1194":        "2001:db8::1:1194",
+		"udp6:2001:db8::1:1194":     "udp6:2001:db8::1:1194",
+		"fe80::1%eth0:1194":         "fe80::1:1194",
+		"::ffff:192.0.2.1:1194":     "192.0.2.1:1194",
+		"192.0.2.1":                 "192.0.2.1",
+		"UNDEF":                     "UNDEF",
+		"192.0.2.1:port":            "192.0.2.1:port",
+		"2001:DB8::10":              "2001:db8::10",
+		"tcp4-server:192.0.2.1:443": "tcp4-server:192.0.2.1:443",
+	} {
+		if got := normalizeRealAddress(address); got != want {
+			t.Errorf("normalizeRealAddress(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
+
+func TestAddressIP(t *testing.T) {
+	for address, want := range map[string]string{
+		"192.0.2.1:1194":        "192.0.2.1",
+		"udp4:192.0.2.1:51234":  "192.0.2.1",
+		"2001:db8::1:1194":      "2001:db8::1",
+		"2001:db8::1:51234":     "2001:db8::1",
+		"[2001:db8::1]:1194":    "2001:db8::1",
+		"udp6:2001:db8::1:1194": "2001:db8::1",
+		"192.0.2.1":             "192.0.2.1",
+		"2001:db8::10":          "2001:db8::10",
+		"UNDEF":                 "<nil>",
+	} {
+		if got := addressIP(address).String(); got != want {
+			t.Errorf("addressIP(%q) = %s, want %s", address, got, want)
+		}
+	}
+}
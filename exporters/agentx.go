@@ -0,0 +1,517 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AgentX PDU types, as defined in RFC 2741.
+const (
+	agentxOpenPDU       = 1
+	agentxClosePDU      = 2
+	agentxRegisterPDU   = 3
+	agentxGetPDU        = 5
+	agentxGetNextPDU    = 6
+	agentxGetBulkPDU    = 7
+	agentxTestSetPDU    = 8
+	agentxCommitSetPDU  = 9
+	agentxUndoSetPDU    = 10
+	agentxCleanupSetPDU = 11
+	agentxResponsePDU   = 18
+)
+
+// AgentX header flags.
+const (
+	agentxFlagNonDefaultContext = 0x08
+	agentxFlagNetworkByteOrder  = 0x10
+)
+
+// SNMP value types, as encoded in AgentX variable bindings.
+const (
+	agentxInteger        = 2
+	agentxOctetString    = 4
+	agentxGauge32        = 66
+	agentxCounter64      = 70
+	agentxNoSuchObject   = 128
+	agentxNoSuchInstance = 129
+	agentxEndOfMibView   = 130
+)
+
+// AgentX response errors.
+const (
+	agentxErrorNotWritable = 17
+)
+
+type agentxOID []uint32
+
+func parseAgentxOID(s string) (agentxOID, error) {
+	var oid agentxOID
+	for _, part := range strings.Split(strings.Trim(s, "."), ".") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid = append(oid, uint32(n))
+	}
+	return oid, nil
+}
+
+func (o agentxOID) compare(other agentxOID) int {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		if o[i] < other[i] {
+			return -1
+		} else if o[i] > other[i] {
+			return 1
+		}
+	}
+	return len(o) - len(other)
+}
+
+func (o agentxOID) hasPrefix(prefix agentxOID) bool {
+	return len(o) >= len(prefix) && o[:len(prefix)].compare(prefix) == 0
+}
+
+func (o agentxOID) append(subids ...uint32) agentxOID {
+	return append(append(agentxOID{}, o...), subids...)
+}
+
+type agentxVarBind struct {
+	oid       agentxOID
+	valueType uint16
+	value     interface{}
+}
+
+// Encodes AgentX PDUs in network byte order.
+type agentxEncoder struct {
+	bytes.Buffer
+}
+
+func (e *agentxEncoder) uint16(v uint16) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *agentxEncoder) uint32(v uint32) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *agentxEncoder) oid(oid agentxOID, include bool) {
+	e.WriteByte(byte(len(oid)))
+	e.WriteByte(0)
+	if include {
+		e.WriteByte(1)
+	} else {
+		e.WriteByte(0)
+	}
+	e.WriteByte(0)
+	for _, subid := range oid {
+		e.uint32(subid)
+	}
+}
+
+func (e *agentxEncoder) octetString(s string) {
+	e.uint32(uint32(len(s)))
+	e.WriteString(s)
+	for i := len(s); i%4 != 0; i++ {
+		e.WriteByte(0)
+	}
+}
+
+func (e *agentxEncoder) varBind(v agentxVarBind) {
+	e.uint16(v.valueType)
+	e.uint16(0)
+	e.oid(v.oid, false)
+	switch v.valueType {
+	case agentxInteger, agentxGauge32:
+		e.uint32(v.value.(uint32))
+	case agentxCounter64:
+		binary.Write(e, binary.BigEndian, v.value.(uint64))
+	case agentxOctetString:
+		e.octetString(v.value.(string))
+	}
+}
+
+// Decodes AgentX PDUs in the byte order indicated by their header.
+type agentxDecoder struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func (d *agentxDecoder) next(n int) ([]byte, error) {
+	if len(d.data) < n {
+		return nil, errors.New("truncated AgentX PDU")
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+func (d *agentxDecoder) uint16() (uint16, error) {
+	b, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint16(b), nil
+}
+
+func (d *agentxDecoder) uint32() (uint32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+func (d *agentxDecoder) oid() (agentxOID, bool, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return nil, false, err
+	}
+	var oid agentxOID
+	if b[1] != 0 {
+		// Compressed internet prefix, 1.3.6.1.<prefix>.
+		oid = agentxOID{1, 3, 6, 1, uint32(b[1])}
+	}
+	for i := 0; i < int(b[0]); i++ {
+		subid, err := d.uint32()
+		if err != nil {
+			return nil, false, err
+		}
+		oid = append(oid, subid)
+	}
+	return oid, b[2] != 0, nil
+}
+
+func (d *agentxDecoder) octetString() (string, error) {
+	length, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(length+3) / 4 * 4)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:length]), nil
+}
+
+type agentxHeader struct {
+	pduType       byte
+	flags         byte
+	sessionID     uint32
+	transactionID uint32
+	packetID      uint32
+}
+
+// AgentXSubagent exposes the status of the OpenVPN instances over SNMP by
+// registering itself with an AgentX master agent (e.g., Net-SNMP's
+// snmpd). The following objects are exported below the configured base
+// OID:
+//
+//	<base>.1.0      total number of connected clients (Gauge32)
+//	<base>.2.0      total bytes received from clients (Counter64)
+//	<base>.3.0      total bytes sent to clients (Counter64)
+//	<base>.4.1.1.i  status path of instance i (OctetString)
+//	<base>.4.1.2.i  whether instance i is up (Integer)
+//	<base>.4.1.3.i  clients connected to instance i (Gauge32)
+//	<base>.4.1.4.i  bytes received by instance i (Counter64)
+//	<base>.4.1.5.i  bytes sent by instance i (Counter64)
+//
+// Values are taken from the metrics of the provided gatherer.
+type AgentXSubagent struct {
+	network  string
+	address  string
+	baseOID  agentxOID
+	gatherer prometheus.Gatherer
+	timeout  time.Duration
+	started  time.Time
+}
+
+func NewAgentXSubagent(masterAddress string, baseOID string, gatherer prometheus.Gatherer, timeout time.Duration) (*AgentXSubagent, error) {
+	u, err := url.Parse(masterAddress)
+	if err != nil {
+		return nil, err
+	}
+	var network, address string
+	switch u.Scheme {
+	case "unix":
+		network, address = "unix", u.Path
+	case "tcp":
+		network, address = "tcp", u.Host
+	default:
+		return nil, fmt.Errorf("AgentX master address %q should start with unix:// or tcp://", masterAddress)
+	}
+	oid, err := parseAgentxOID(baseOID)
+	if err != nil {
+		return nil, err
+	}
+	return &AgentXSubagent{
+		network:  network,
+		address:  address,
+		baseOID:  oid,
+		gatherer: gatherer,
+		timeout:  timeout,
+		started:  time.Now(),
+	}, nil
+}
+
+// Computes the values of all exported objects, sorted by OID.
+func (a *AgentXSubagent) snapshot() ([]agentxVarBind, error) {
+	instances, err := summarizeInstances(a.gatherer)
+	if err != nil {
+		return nil, err
+	}
+
+	var total instanceSummary
+	var table []agentxVarBind
+	for column := uint32(1); column <= 5; column++ {
+		for i, inst := range instances {
+			oid := a.baseOID.append(4, 1, column, uint32(i+1))
+			switch column {
+			case 1:
+				table = append(table, agentxVarBind{oid, agentxOctetString, inst.statusPath})
+			case 2:
+				table = append(table, agentxVarBind{oid, agentxInteger, uint32(inst.up)})
+			case 3:
+				table = append(table, agentxVarBind{oid, agentxGauge32, uint32(inst.clients)})
+				total.clients += inst.clients
+			case 4:
+				table = append(table, agentxVarBind{oid, agentxCounter64, uint64(inst.received)})
+				total.received += inst.received
+			case 5:
+				table = append(table, agentxVarBind{oid, agentxCounter64, uint64(inst.sent)})
+				total.sent += inst.sent
+			}
+		}
+	}
+	return append([]agentxVarBind{
+		{a.baseOID.append(1, 0), agentxGauge32, uint32(total.clients)},
+		{a.baseOID.append(2, 0), agentxCounter64, uint64(total.received)},
+		{a.baseOID.append(3, 0), agentxCounter64, uint64(total.sent)},
+	}, table...), nil
+}
+
+func (a *AgentXSubagent) writePDU(conn net.Conn, header agentxHeader, payload []byte) error {
+	var e agentxEncoder
+	e.WriteByte(1)
+	e.WriteByte(header.pduType)
+	e.WriteByte(agentxFlagNetworkByteOrder)
+	e.WriteByte(0)
+	e.uint32(header.sessionID)
+	e.uint32(header.transactionID)
+	e.uint32(header.packetID)
+	e.uint32(uint32(len(payload)))
+	e.Write(payload)
+	_, err := conn.Write(e.Bytes())
+	return err
+}
+
+func (a *AgentXSubagent) readPDU(conn net.Conn) (agentxHeader, *agentxDecoder, error) {
+	raw := make([]byte, 20)
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return agentxHeader{}, nil, err
+	}
+	d := &agentxDecoder{data: raw, order: binary.LittleEndian}
+	if raw[2]&agentxFlagNetworkByteOrder != 0 {
+		d.order = binary.BigEndian
+	}
+	header := agentxHeader{pduType: raw[1], flags: raw[2]}
+	d.next(4)
+	header.sessionID, _ = d.uint32()
+	header.transactionID, _ = d.uint32()
+	header.packetID, _ = d.uint32()
+	length, _ := d.uint32()
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return agentxHeader{}, nil, err
+	}
+	d.data = payload
+	if header.flags&agentxFlagNonDefaultContext != 0 {
+		if _, err := d.octetString(); err != nil {
+			return agentxHeader{}, nil, err
+		}
+	}
+	return header, d, nil
+}
+
+// Returns the error code of a response PDU.
+func (a *AgentXSubagent) readResponse(conn net.Conn) (agentxHeader, error) {
+	header, d, err := a.readPDU(conn)
+	if err != nil {
+		return header, err
+	}
+	if header.pduType != agentxResponsePDU {
+		return header, fmt.Errorf("unexpected AgentX PDU type %d", header.pduType)
+	}
+	d.uint32()
+	code, err := d.uint16()
+	if err != nil {
+		return header, err
+	}
+	if code != 0 {
+		return header, fmt.Errorf("AgentX master agent returned error %d", code)
+	}
+	return header, nil
+}
+
+// Returns the first object following start, or endOfMibView.
+func agentxNext(snapshot []agentxVarBind, start agentxOID, include bool, end agentxOID) agentxVarBind {
+	for _, v := range snapshot {
+		c := v.oid.compare(start)
+		if c > 0 || (include && c == 0) {
+			if len(end) > 0 && v.oid.compare(end) >= 0 {
+				break
+			}
+			return v
+		}
+	}
+	return agentxVarBind{oid: start, valueType: agentxEndOfMibView}
+}
+
+// Answers Get, GetNext and GetBulk requests.
+func (a *AgentXSubagent) handleRequest(header agentxHeader, d *agentxDecoder) ([]agentxVarBind, error) {
+	var nonRepeaters, maxRepetitions uint16
+	if header.pduType == agentxGetBulkPDU {
+		nonRepeaters, _ = d.uint16()
+		maxRepetitions, _ = d.uint16()
+	}
+	snapshot, err := a.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var varBinds []agentxVarBind
+	for i := 0; len(d.data) > 0; i++ {
+		start, include, err := d.oid()
+		if err != nil {
+			return nil, err
+		}
+		end, _, err := d.oid()
+		if err != nil {
+			return nil, err
+		}
+		switch header.pduType {
+		case agentxGetPDU:
+			result := agentxVarBind{oid: start, valueType: agentxNoSuchObject}
+			if start.hasPrefix(a.baseOID) {
+				result.valueType = agentxNoSuchInstance
+			}
+			for _, v := range snapshot {
+				if v.oid.compare(start) == 0 {
+					result = v
+				}
+			}
+			varBinds = append(varBinds, result)
+		case agentxGetNextPDU:
+			varBinds = append(varBinds, agentxNext(snapshot, start, include, end))
+		case agentxGetBulkPDU:
+			repetitions := int(maxRepetitions)
+			if i < int(nonRepeaters) {
+				repetitions = 1
+			}
+			for r := 0; r < repetitions; r++ {
+				v := agentxNext(snapshot, start, include, end)
+				varBinds = append(varBinds, v)
+				if v.valueType == agentxEndOfMibView {
+					break
+				}
+				start, include = v.oid, false
+			}
+		}
+	}
+	return varBinds, nil
+}
+
+// Opens a session with the master agent, registers the base OID and
+// answers requests until the connection fails.
+func (a *AgentXSubagent) serve() error {
+	conn, err := net.DialTimeout(a.network, a.address, a.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var open agentxEncoder
+	open.WriteByte(byte(a.timeout / time.Second))
+	open.Write([]byte{0, 0, 0})
+	open.oid(a.baseOID, false)
+	open.octetString("openvpn_exporter")
+	if err := a.writePDU(conn, agentxHeader{pduType: agentxOpenPDU, packetID: 1}, open.Bytes()); err != nil {
+		return err
+	}
+	response, err := a.readResponse(conn)
+	if err != nil {
+		return err
+	}
+	sessionID := response.sessionID
+
+	var register agentxEncoder
+	register.Write([]byte{0, 127, 0, 0})
+	register.oid(a.baseOID, false)
+	if err := a.writePDU(conn, agentxHeader{pduType: agentxRegisterPDU, sessionID: sessionID, packetID: 2}, register.Bytes()); err != nil {
+		return err
+	}
+	if _, err := a.readResponse(conn); err != nil {
+		return err
+	}
+	slog.Info("Registered AgentX subagent", "address", a.address)
+
+	for {
+		header, d, err := a.readPDU(conn)
+		if err != nil {
+			return err
+		}
+		var code uint16
+		var varBinds []agentxVarBind
+		switch header.pduType {
+		case agentxGetPDU, agentxGetNextPDU, agentxGetBulkPDU:
+			varBinds, err = a.handleRequest(header, d)
+			if err != nil {
+				slog.Error("Failed to handle AgentX request", "err", err)
+				code = 5 // genErr
+			}
+		case agentxTestSetPDU:
+			code = agentxErrorNotWritable
+		case agentxCommitSetPDU, agentxUndoSetPDU, agentxCleanupSetPDU:
+			// Nothing to commit or undo.
+			if header.pduType == agentxCleanupSetPDU {
+				continue
+			}
+		case agentxClosePDU:
+			return errors.New("session closed by AgentX master agent")
+		default:
+			continue
+		}
+
+		var e agentxEncoder
+		e.uint32(uint32(time.Since(a.started) / (10 * time.Millisecond)))
+		e.uint16(code)
+		e.uint16(0)
+		for _, v := range varBinds {
+			e.varBind(v)
+		}
+		header.pduType = agentxResponsePDU
+		if err := a.writePDU(conn, header, e.Bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+// Run keeps a session with the master agent open, reconnecting when it
+// fails. It never returns.
+func (a *AgentXSubagent) Run() {
+	for {
+		if err := a.serve(); err != nil {
+			slog.Error("AgentX session failed", "address", a.address, "err", err)
+		}
+		time.Sleep(a.timeout)
+	}
+}
@@ -0,0 +1,134 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAgentxEncoding(t *testing.T) {
+	var e agentxEncoder
+	e.oid(agentxOID{1, 3, 6, 1, 4, 1, 99999}, true)
+	for _, s := range []string{"", "a", "abcd", "/var/run/openvpn/server.status"} {
+		e.octetString(s)
+	}
+
+	d := &agentxDecoder{data: e.Bytes(), order: binary.BigEndian}
+	oid, include, err := d.oid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(oid, agentxOID{1, 3, 6, 1, 4, 1, 99999}) || !include {
+		t.Errorf("got OID %v, include %v", oid, include)
+	}
+	for _, want := range []string{"", "a", "abcd", "/var/run/openvpn/server.status"} {
+		if got, err := d.octetString(); err != nil || got != want {
+			t.Errorf("got octet string %q (%v), want %q", got, err, want)
+		}
+	}
+	if len(d.data) != 0 {
+		t.Errorf("%d bytes left after decoding", len(d.data))
+	}
+}
+
+func TestAgentxVarBindEncoding(t *testing.T) {
+	var e agentxEncoder
+	e.varBind(agentxVarBind{agentxOID{1, 3, 6, 1, 4, 1, 99999, 2, 0}, agentxCounter64, uint64(1 << 40)})
+	// Type and reserved field, the OID header and sub-identifiers, and
+	// the value, as laid out in RFC 2741 section 5.4.
+	want := []byte{
+		0, 70, 0, 0,
+		9, 0, 0, 0,
+		0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, 6, 0, 0, 0, 1, 0, 0, 0, 4,
+		0, 0, 0, 1, 0, 1, 0x86, 0x9f, 0, 0, 0, 2, 0, 0, 0, 0,
+		0, 0, 1, 0, 0, 0, 0, 0,
+	}
+	if !bytes.Equal(e.Bytes(), want) {
+		t.Errorf("got % x, want % x", e.Bytes(), want)
+	}
+}
+
+func TestAgentxReadPDU(t *testing.T) {
+	// A little endian GetNext PDU with a non-default context and a
+	// compressed internet prefix, as some master agents send.
+	payload := []byte{
+		3, 0, 0, 0, 'a', 'b', 'c', 0,
+		2, 4, 0, 0, 1, 0, 0, 0, 0x9f, 0x86, 1, 0,
+		0, 0, 0, 0,
+	}
+	pdu := []byte{1, agentxGetNextPDU, agentxFlagNonDefaultContext, 0}
+	for _, v := range []uint32{7, 8, 9, uint32(len(payload))} {
+		pdu = binary.LittleEndian.AppendUint32(pdu, v)
+	}
+	pdu = append(pdu, payload...)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go client.Write(pdu)
+	header, d, err := (&AgentXSubagent{}).readPDU(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.pduType != agentxGetNextPDU || header.sessionID != 7 || header.transactionID != 8 || header.packetID != 9 {
+		t.Errorf("got header %+v", header)
+	}
+	start, _, err := d.oid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (agentxOID{1, 3, 6, 1, 4, 1, 99999}); !reflect.DeepEqual(start, want) {
+		t.Errorf("got OID %v, want %v", start, want)
+	}
+}
+
+func TestAgentxHandleRequest(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_up", Help: "Test."}, []string{"status_path"})
+	up.WithLabelValues("/var/run/openvpn/server.status").Set(1)
+	clients := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openvpn_server_connected_clients", Help: "Test."}, []string{"status_path"})
+	clients.WithLabelValues("/var/run/openvpn/server.status").Set(3)
+	registry.MustRegister(up, clients)
+	a, err := NewAgentXSubagent("tcp://localhost:705", "1.3.6.1.4.1.99999", registry, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(pduType byte, prefix []byte, start agentxOID) []agentxVarBind {
+		var e agentxEncoder
+		e.Write(prefix)
+		e.oid(start, false)
+		e.oid(nil, false)
+		varBinds, err := a.handleRequest(agentxHeader{pduType: pduType}, &agentxDecoder{data: e.Bytes(), order: binary.BigEndian})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return varBinds
+	}
+
+	got := request(agentxGetPDU, nil, a.baseOID.append(4, 1, 1, 1))
+	want := []agentxVarBind{{a.baseOID.append(4, 1, 1, 1), agentxOctetString, "/var/run/openvpn/server.status"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get: got %v, want %v", got, want)
+	}
+
+	got = request(agentxGetNextPDU, nil, a.baseOID)
+	want = []agentxVarBind{{a.baseOID.append(1, 0), agentxGauge32, uint32(3)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetNext: got %v, want %v", got, want)
+	}
+
+	// No non-repeaters and two repetitions.
+	got = request(agentxGetBulkPDU, []byte{0, 0, 0, 2}, a.baseOID.append(4, 1, 4))
+	want = []agentxVarBind{
+		{a.baseOID.append(4, 1, 4, 1), agentxCounter64, uint64(0)},
+		{a.baseOID.append(4, 1, 5, 1), agentxCounter64, uint64(0)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBulk: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type trafficClient struct {
+	statusPath string
+	commonName string
+}
+
+// Transfer rate of a client, in bytes per second.
+type trafficRate struct {
+	current float64
+	average float64
+}
+
+// TrafficAnomalyCollector periodically measures the transfer rate of every
+// client connected to the OpenVPN servers, keeping an exponentially
+// weighted moving average per common name. Clients whose current rate
+// exceeds their average by the configured factor are flagged as
+// anomalous, which may indicate data exfiltration. Averages below the
+// minimum rate are raised to it, so that mostly idle clients aren't
+// flagged as soon as they start transferring data.
+type TrafficAnomalyCollector struct {
+	statusPaths func() []string
+	interval    time.Duration
+	alpha       float64
+	factor      float64
+	minRate     float64
+
+	rateDesc    *prometheus.Desc
+	averageDesc *prometheus.Desc
+	scoreDesc   *prometheus.Desc
+	anomalyDesc *prometheus.Desc
+
+	mutex    sync.Mutex
+	observed time.Time
+	sessions map[clientSession]float64
+	rates    map[trafficClient]trafficRate
+}
+
+func NewTrafficAnomalyCollector(statusPaths func() []string, interval time.Duration, halfLife time.Duration, factor float64, minRate float64) *TrafficAnomalyCollector {
+	labels := []string{"status_path", "common_name"}
+	return &TrafficAnomalyCollector{
+		statusPaths: statusPaths,
+		interval:    interval,
+		alpha:       1 - math.Exp(-math.Ln2*interval.Seconds()/halfLife.Seconds()),
+		factor:      factor,
+		minRate:     minRate,
+		rateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_transfer_rate_bytes_per_second"),
+			"Rate at which the client transferred data during the last interval, in bytes per second.",
+			labels, nil),
+		averageDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_transfer_rate_average_bytes_per_second"),
+			"Exponentially weighted moving average of the client's transfer rate, in bytes per second.",
+			labels, nil),
+		scoreDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_traffic_anomaly_score"),
+			"Ratio between the client's current and average transfer rate.",
+			labels, nil),
+		anomalyDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_traffic_anomalous"),
+			"Whether the client's current transfer rate exceeds its average by the configured factor.",
+			labels, nil),
+		sessions: map[clientSession]float64{},
+		rates:    map[trafficClient]trafficRate{},
+	}
+}
+
+// Updates the transfer rates using the growth of each connection's byte
+// counters since the previous observation.
+func (c *TrafficAnomalyCollector) observe(now time.Time) {
+	sessions := map[clientSession]float64{}
+	for _, statusPath := range expandStatusPaths(c.statusPaths()) {
+		clients, err := readServerClientList(statusPath)
+		if err != nil {
+			slog.Error("Failed to read clients", "status_path", statusPath, "err", err)
+			continue
+		}
+		for _, client := range clients {
+			received, err := strconv.ParseFloat(client["Bytes Received"], 64)
+			if err != nil {
+				continue
+			}
+			sent, err := strconv.ParseFloat(client["Bytes Sent"], 64)
+			if err != nil {
+				continue
+			}
+			sessions[clientSession{
+				statusPath:     statusPath,
+				commonName:     client["Common Name"],
+				realAddress:    client["Real Address"],
+				connectedSince: client["Connected Since (time_t)"],
+			}] = received + sent
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elapsed := now.Sub(c.observed).Seconds()
+	deltas := map[trafficClient]float64{}
+	for session, bytes := range sessions {
+		client := trafficClient{statusPath: session.statusPath, commonName: session.commonName}
+		// Connections established since the previous observation
+		// only contribute their traffic from the next one onwards.
+		delta := 0.0
+		if previous, ok := c.sessions[session]; ok && previous <= bytes {
+			delta = bytes - previous
+		}
+		deltas[client] += delta
+	}
+	rates := map[trafficClient]trafficRate{}
+	for client, delta := range deltas {
+		current := delta / elapsed
+		// The average excludes the current rate, so that it can't
+		// mask its own deviation.
+		rate, ok := c.rates[client]
+		if ok {
+			rate.average += c.alpha * (rate.current - rate.average)
+		} else {
+			rate.average = current
+		}
+		rate.current = current
+		rates[client] = rate
+	}
+	if !c.observed.IsZero() {
+		c.rates = rates
+	}
+	c.sessions = sessions
+	c.observed = now
+}
+
+// Run measures transfer rates at the configured interval. It never
+// returns.
+func (c *TrafficAnomalyCollector) Run() {
+	for {
+		c.observe(time.Now())
+		time.Sleep(c.interval)
+	}
+}
+
+func (c *TrafficAnomalyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rateDesc
+	ch <- c.averageDesc
+	ch <- c.scoreDesc
+	ch <- c.anomalyDesc
+}
+
+func (c *TrafficAnomalyCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for client, rate := range c.rates {
+		score := rate.current / math.Max(rate.average, c.minRate)
+		anomalous := 0.0
+		if score >= c.factor {
+			anomalous = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.rateDesc,
+			prometheus.GaugeValue,
+			rate.current,
+			client.statusPath,
+			client.commonName)
+		ch <- prometheus.MustNewConstMetric(
+			c.averageDesc,
+			prometheus.GaugeValue,
+			rate.average,
+			client.statusPath,
+			client.commonName)
+		ch <- prometheus.MustNewConstMetric(
+			c.scoreDesc,
+			prometheus.GaugeValue,
+			score,
+			client.statusPath,
+			client.commonName)
+		ch <- prometheus.MustNewConstMetric(
+			c.anomalyDesc,
+			prometheus.GaugeValue,
+			anomalous,
+			client.statusPath,
+			client.commonName)
+	}
+}
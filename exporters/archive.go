@@ -0,0 +1,280 @@
+package exporters
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format of the time appended to the names of rotated sessions files.
+const sessionsFileTimeFormat = "20060102T150405Z"
+
+// SessionsArchiver periodically rotates the sessions file of a
+// ClientHookReceiver, and uploads the rotated files to a bucket of an S3
+// compatible object storage, e.g. Amazon S3 or Google Cloud Storage using
+// HMAC keys. Files are compressed using gzip, and their SHA-256 checksum
+// is verified by the storage and kept in the sha256 metadata of their
+// objects. Rotated files are only removed once uploaded, so that files
+// failing to upload are retried at the next interval.
+type SessionsArchiver struct {
+	receiver        *ClientHookReceiver
+	bucketURL       *url.URL
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	interval        time.Duration
+	client          *http.Client
+
+	uploads      prometheus.Counter
+	failures     prometheus.Counter
+	lastUploaded prometheus.Gauge
+}
+
+// NewSessionsArchiver creates an archiver uploading the rotated sessions
+// files of the receiver under the bucket URL, e.g.
+// https://s3.eu-west-1.amazonaws.com/bucket/prefix or
+// https://storage.googleapis.com/bucket/prefix, signing requests for the
+// region using the access key.
+func NewSessionsArchiver(receiver *ClientHookReceiver, bucketURL string, region string, accessKeyID string, secretAccessKey string, interval time.Duration, timeout time.Duration) (*SessionsArchiver, error) {
+	if receiver.sessionsFile == nil {
+		return nil, fmt.Errorf("sessions can only be archived when recorded in a file")
+	}
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("bucket URL %q should start with https:// or http://", bucketURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &SessionsArchiver{
+		receiver:        receiver,
+		bucketURL:       u,
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		interval:        interval,
+		client:          &http.Client{Timeout: timeout},
+		uploads: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "hook_sessions_archive_uploads_total",
+				Help:      "Number of rotated sessions files uploaded to object storage.",
+			}),
+		failures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "hook_sessions_archive_failures_total",
+				Help:      "Number of failures to rotate sessions files or upload them to object storage.",
+			}),
+		lastUploaded: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "hook_sessions_archive_last_upload_timestamp_seconds",
+				Help:      "Time at which a rotated sessions file was last uploaded to object storage.",
+			}),
+	}, nil
+}
+
+// Returns the rotated sessions files that haven't been uploaded yet, oldest
+// first.
+func (a *SessionsArchiver) pending() ([]string, error) {
+	path := a.receiver.sessionsFile.Name()
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(path) + "-"
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(sessionsFileTimeFormat, strings.TrimPrefix(name, prefix)); err == nil {
+			paths = append(paths, filepath.Join(filepath.Dir(path), name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Rotates the sessions file and uploads all rotated files.
+func (a *SessionsArchiver) archive(now time.Time) {
+	if _, err := a.receiver.rotateSessionsFile(now); err != nil {
+		slog.Error("Failed to rotate sessions file", "path", a.receiver.sessionsFile.Name(), "err", err)
+		a.failures.Inc()
+	}
+	a.uploadPending()
+}
+
+// Uploads all rotated sessions files, removing them once uploaded.
+func (a *SessionsArchiver) uploadPending() {
+	paths, err := a.pending()
+	if err != nil {
+		slog.Error("Failed to list rotated sessions files", "path", a.receiver.sessionsFile.Name(), "err", err)
+		a.failures.Inc()
+		return
+	}
+	for _, path := range paths {
+		if err := a.upload(path); err != nil {
+			slog.Error("Failed to upload sessions file", "path", path, "err", err)
+			a.failures.Inc()
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Error("Failed to remove uploaded sessions file", "path", path, "err", err)
+		}
+		a.uploads.Inc()
+		a.lastUploaded.Set(float64(time.Now().Unix()))
+	}
+}
+
+// Uploads a rotated sessions file, compressed using gzip.
+func (a *SessionsArchiver) upload(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	u := *a.bucketURL
+	u.Path += "/" + filepath.Base(path) + ".gz"
+	request, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(compressed.Bytes())
+	request.Header.Set("Content-Type", "application/gzip")
+	request.Header.Set("X-Amz-Meta-Sha256", hex.EncodeToString(checksum[:]))
+	signS3Request(request, hex.EncodeToString(checksum[:]), a.region, a.accessKeyID, a.secretAccessKey, time.Now())
+	response, err := a.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", response.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Escapes a path or query component as required by AWS Signature Version
+// 4, leaving only unreserved characters.
+func awsURIEscape(s string, keepSlashes bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' || keepSlashes && c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Signs a request to S3 using AWS Signature Version 4, covering its host
+// and all headers set on it. The payload hash is the hex encoded SHA-256
+// checksum of the body, which S3 verifies.
+func signS3Request(request *http.Request, payloadHash string, region string, accessKeyID string, secretAccessKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := request.URL.Query()
+	var parameters []string
+	for name, values := range query {
+		for _, value := range values {
+			parameters = append(parameters, awsURIEscape(name, false)+"="+awsURIEscape(value, false))
+		}
+	}
+	sort.Strings(parameters)
+
+	path := request.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		awsURIEscape(path, true),
+		strings.Join(parameters, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+}
+
+// Run rotates and uploads the sessions file at the configured interval,
+// after uploading the files rotated before the exporter started. It never
+// returns.
+func (a *SessionsArchiver) Run() {
+	a.uploadPending()
+	for {
+		time.Sleep(a.interval)
+		a.archive(time.Now())
+	}
+}
+
+func (a *SessionsArchiver) Describe(ch chan<- *prometheus.Desc) {
+	a.uploads.Describe(ch)
+	a.failures.Describe(ch)
+	a.lastUploaded.Describe(ch)
+}
+
+func (a *SessionsArchiver) Collect(ch chan<- prometheus.Metric) {
+	a.uploads.Collect(ch)
+	a.failures.Collect(ch)
+	a.lastUploaded.Collect(ch)
+}
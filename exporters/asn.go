@@ -0,0 +1,96 @@
+package exporters
+
+import (
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+)
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// ASNCollector counts the clients connected to OpenVPN servers per
+// autonomous system of their real address, as found in a MaxMind ASN
+// database (e.g. GeoLite2-ASN). This makes it possible to spot many
+// clients suddenly connecting from hosting provider networks.
+type ASNCollector struct {
+	database         *maxminddb.Reader
+	clientsByASNDesc *prometheus.Desc
+}
+
+func NewASNCollector(databasePath string) (*ASNCollector, error) {
+	database, err := maxminddb.Open(databasePath)
+	if err != nil {
+		return nil, err
+	}
+	return &ASNCollector{
+		database: database,
+		clientsByASNDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "clients_by_asn"),
+			"Number of connected clients per autonomous system of their real address.",
+			[]string{"status_path", "asn", "as_org"}, nil),
+	}, nil
+}
+
+// Close closes the database.
+func (c *ASNCollector) Close() error {
+	return c.database.Close()
+}
+
+func (c *ASNCollector) Name() string {
+	return "asn"
+}
+
+func (c *ASNCollector) appliesTo(file *StatusFile) bool {
+	return file.Server
+}
+
+func (c *ASNCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.clientsByASNDesc
+}
+
+func (c *ASNCollector) collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error {
+	clients, err := file.rows("CLIENT_LIST")
+	if err != nil {
+		return err
+	}
+	type asn struct {
+		number       string
+		organization string
+	}
+	clientsByASN := map[asn]int{}
+	sessionIDs := map[string]bool{}
+	for _, client := range clients {
+		sessionID := SessionID(client["Common Name"], client["Connected Since (time_t)"], client["Real Address"])
+		if sessionIDs[sessionID] {
+			continue
+		}
+		sessionIDs[sessionID] = true
+
+		// Addresses that aren't found, such as private addresses,
+		// are counted with empty labels.
+		var record asnRecord
+		if ip := addressIP(client["Real Address"]); ip != nil {
+			if err := c.database.Lookup(ip, &record); err != nil {
+				return err
+			}
+		}
+		key := asn{organization: record.Organization}
+		if record.Number != 0 {
+			key.number = strconv.FormatUint(uint64(record.Number), 10)
+		}
+		clientsByASN[key]++
+	}
+	for key, clients := range clientsByASN {
+		ch <- prometheus.MustNewConstMetric(
+			c.clientsByASNDesc,
+			prometheus.GaugeValue,
+			float64(clients),
+			statusPath,
+			key.number,
+			key.organization)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package exporters
+
+import (
+	"bytes"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// BenchmarkResult describes the performance of parsing a status file.
+type BenchmarkResult struct {
+	// Number of times the status file was parsed, and the number of
+	// lines it contains.
+	Parses int
+	Lines  int
+	// Total time it took to parse the status file.
+	Duration time.Duration
+	// Total number and size of heap allocations.
+	Allocations    uint64
+	AllocatedBytes uint64
+	// Largest heap size observed while parsing.
+	PeakHeapBytes uint64
+}
+
+// Parses a status file completely, including the entries of every section,
+// which are otherwise only checked when they are collected.
+func parseStatusFileCompletely(contents []byte) error {
+	file, err := parseStatusFile(bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	for entryType := range file.Entries {
+		if _, err := file.rows(entryType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BenchmarkStatusFile parses a status file n times, using the given number
+// of goroutines, to measure the throughput of the parser. The status file
+// is only read once.
+func BenchmarkStatusFile(statusPath string, n int, concurrency int) (BenchmarkResult, error) {
+	file, _, err := openStatusFile(statusPath)
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	contents, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	if err := parseStatusFileCompletely(contents); err != nil {
+		return BenchmarkResult{}, err
+	}
+
+	// Sample the heap size while parsing.
+	var peakHeapBytes uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peakHeapBytes {
+				peakHeapBytes = stats.HeapAlloc
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	parses := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range parses {
+				parseStatusFileCompletely(contents)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		parses <- struct{}{}
+	}
+	close(parses)
+	wg.Wait()
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+	close(done)
+	<-sampled
+
+	return BenchmarkResult{
+		Parses:         n,
+		Lines:          bytes.Count(contents, []byte("\n")),
+		Duration:       duration,
+		Allocations:    after.Mallocs - before.Mallocs,
+		AllocatedBytes: after.TotalAlloc - before.TotalAlloc,
+		PeakHeapBytes:  peakHeapBytes,
+	}, nil
+}
@@ -0,0 +1,312 @@
+package exporters
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A connection to a management interface that's kept open, on which the
+// daemon is asked to send the byte counts of its clients every interval
+// using the bytecount command. When using data channel offload, OpenVPN
+// only fetches the traffic in its status from the kernel periodically,
+// while the byte counts it sends are current. The counts received last
+// are kept in memory and replace those of the status read on the same
+// connection.
+type bytecountSession struct {
+	network      string
+	address      string
+	passwordFile string
+	interval     time.Duration
+	timeout      time.Duration
+
+	// Serializes connecting and reading the status.
+	mutex sync.Mutex
+	conn  net.Conn
+	// Responses to commands, i.e. lines other than notifications.
+	lines chan string
+	// Closed once the connection fails or is closed.
+	closed chan struct{}
+	// Set once the status path is no longer collected, after which the
+	// session doesn't reconnect.
+	stopped bool
+
+	countsMutex sync.Mutex
+	// Bytes received and sent by each client of a server, indexed by
+	// client ID, and by a client itself.
+	clientCounts map[string][2]string
+	counts       *[2]string
+}
+
+var (
+	bytecountSessionsMutex sync.Mutex
+	// Sessions indexed by status path.
+	bytecountSessions = map[string]*bytecountSession{}
+	// Exporters that haven't been closed, whose status paths keep their
+	// sessions open.
+	bytecountExporters = map[*OpenVPNExporter]bool{}
+)
+
+// Keeps the sessions of the exporter's status paths open until it's
+// closed.
+func retainBytecountSessions(e *OpenVPNExporter) {
+	bytecountSessionsMutex.Lock()
+	defer bytecountSessionsMutex.Unlock()
+	bytecountExporters[e] = true
+}
+
+// Closes the sessions whose status paths are no longer collected by any
+// exporter, e.g. after a reload removed a management interface or changed
+// its byte count interval or timeout, which changes its status path.
+func releaseBytecountSessions(e *OpenVPNExporter) {
+	bytecountSessionsMutex.Lock()
+	delete(bytecountExporters, e)
+	collected := map[string]bool{}
+	for e := range bytecountExporters {
+		for _, statusPath := range e.statusPaths {
+			collected[statusPath] = true
+		}
+	}
+	var stale []*bytecountSession
+	for statusPath, s := range bytecountSessions {
+		if !collected[statusPath] {
+			delete(bytecountSessions, statusPath)
+			stale = append(stale, s)
+		}
+	}
+	bytecountSessionsMutex.Unlock()
+
+	// Sessions may be reading the status until their timeout.
+	for _, s := range stale {
+		s.stop()
+	}
+}
+
+func openBytecountStatus(statusPath string, network string, address string, passwordFile string, interval time.Duration, timeout time.Duration) (io.ReadCloser, error) {
+	bytecountSessionsMutex.Lock()
+	s, ok := bytecountSessions[statusPath]
+	if !ok {
+		s = &bytecountSession{
+			network:      network,
+			address:      address,
+			passwordFile: passwordFile,
+			interval:     interval,
+			timeout:      timeout,
+		}
+		bytecountSessions[statusPath] = s
+	}
+	bytecountSessionsMutex.Unlock()
+
+	status, err := s.status()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(status), nil
+}
+
+// Connects to the management interface and subscribes to byte counts.
+func (s *bytecountSession) connect() error {
+	conn, reader, err := dialManagement(s.network, s.address, s.passwordFile, s.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	s.conn = conn
+	s.lines = make(chan string)
+	s.closed = make(chan struct{})
+	// Client IDs are reused when the daemon restarts, so counts of a
+	// previous connection can't be trusted.
+	s.countsMutex.Lock()
+	s.clientCounts = map[string][2]string{}
+	s.counts = nil
+	s.countsMutex.Unlock()
+	go s.receive(reader, s.lines, s.closed)
+
+	// Byte counts are sent at an interval of whole seconds.
+	seconds := max(int(s.interval/time.Second), 1)
+	if err := s.command(fmt.Sprintf("bytecount %d", seconds)); err != nil {
+		s.close()
+		return err
+	}
+	line, err := s.readLine()
+	if err != nil {
+		s.close()
+		return err
+	}
+	if !strings.HasPrefix(line, "SUCCESS:") {
+		s.close()
+		return fmt.Errorf("management interface: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+func (s *bytecountSession) close() {
+	s.conn.Close()
+	s.conn = nil
+}
+
+// Closes the connection for good, which ends its receiving goroutine.
+func (s *bytecountSession) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stopped = true
+	if s.conn != nil {
+		s.close()
+	}
+}
+
+// Reads from the connection until it fails, storing byte counts and
+// passing other lines on to the reader of responses.
+func (s *bytecountSession) receive(reader *bufio.Reader, lines chan<- string, closed chan struct{}) {
+	defer close(closed)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, ">BYTECOUNT_CLI:"):
+			// >BYTECOUNT_CLI:<client ID>,<bytes in>,<bytes out>
+			fields := strings.Split(line[len(">BYTECOUNT_CLI:"):], ",")
+			if len(fields) == 3 && isCount(fields[1]) && isCount(fields[2]) {
+				s.countsMutex.Lock()
+				s.clientCounts[fields[0]] = [2]string{fields[1], fields[2]}
+				s.countsMutex.Unlock()
+			}
+		case strings.HasPrefix(line, ">BYTECOUNT:"):
+			// >BYTECOUNT:<bytes in>,<bytes out>
+			fields := strings.Split(line[len(">BYTECOUNT:"):], ",")
+			if len(fields) == 2 && isCount(fields[0]) && isCount(fields[1]) {
+				s.countsMutex.Lock()
+				s.counts = &[2]string{fields[0], fields[1]}
+				s.countsMutex.Unlock()
+			}
+		case strings.HasPrefix(line, ">"):
+			// Other notifications, such as the greeting.
+		default:
+			select {
+			case lines <- line:
+			case <-time.After(s.timeout):
+				// Nobody is waiting for the response anymore.
+			}
+		}
+	}
+}
+
+func isCount(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+func (s *bytecountSession) command(command string) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := io.WriteString(s.conn, command+"\n")
+	return err
+}
+
+func (s *bytecountSession) readLine() (string, error) {
+	select {
+	case line := <-s.lines:
+		return line, nil
+	case <-s.closed:
+		return "", fmt.Errorf("management interface closed the connection")
+	case <-time.After(s.timeout):
+		return "", fmt.Errorf("management interface: timeout waiting for response")
+	}
+}
+
+// Reads the status on the session's connection, reconnecting if needed,
+// with the traffic replaced by the byte counts received last.
+func (s *bytecountSession) status() (*bytes.Buffer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return nil, fmt.Errorf("management interface is no longer collected")
+	}
+	if s.conn != nil {
+		select {
+		case <-s.closed:
+			s.close()
+		default:
+		}
+	}
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.command("status 3"); err != nil {
+		s.close()
+		return nil, err
+	}
+	status, err := readManagementStatus(s.readLine)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	status, err = addManagementStats(status, s.command, s.readLine)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return s.replaceCounts(status), nil
+}
+
+// Replaces the traffic of the clients listed by a server, identified by
+// their client ID, or the traffic of a client, by the byte counts received
+// last. Counts of clients that are no longer listed are dropped.
+func (s *bytecountSession) replaceCounts(status *bytes.Buffer) *bytes.Buffer {
+	s.countsMutex.Lock()
+	defer s.countsMutex.Unlock()
+	listed := map[string]bool{}
+	clientID, received, sent := -1, -1, -1
+	var replaced bytes.Buffer
+	for _, line := range strings.SplitAfter(status.String(), "\n") {
+		separator := ","
+		if strings.Contains(line, "\t") {
+			separator = "\t"
+		}
+		fields := strings.Split(strings.TrimRight(line, "\n"), separator)
+		switch {
+		case len(fields) > 2 && fields[0] == "HEADER" && fields[1] == "CLIENT_LIST":
+			// Columns are numbered as in CLIENT_LIST entries, which
+			// lack the HEADER field.
+			for i, column := range fields[1:] {
+				switch column {
+				case "Client ID":
+					clientID = i
+				case "Bytes Received":
+					received = i
+				case "Bytes Sent":
+					sent = i
+				}
+			}
+		case fields[0] == "CLIENT_LIST" && clientID >= 0 && received >= 0 && sent >= 0 && len(fields) > max(clientID, received, sent):
+			listed[fields[clientID]] = true
+			if counts, ok := s.clientCounts[fields[clientID]]; ok {
+				fields[received], fields[sent] = counts[0], counts[1]
+				line = strings.Join(fields, separator) + "\n"
+			}
+		case len(fields) == 2 && fields[0] == "TCP/UDP read bytes" && s.counts != nil:
+			line = fields[0] + "," + s.counts[0] + "\n"
+		case len(fields) == 2 && fields[0] == "TCP/UDP write bytes" && s.counts != nil:
+			line = fields[0] + "," + s.counts[1] + "\n"
+		}
+		replaced.WriteString(line)
+	}
+	for id := range s.clientCounts {
+		if !listed[id] {
+			delete(s.clientCounts, id)
+		}
+	}
+	return &replaced
+}
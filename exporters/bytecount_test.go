@@ -0,0 +1,47 @@
+package exporters
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReleaseBytecountSessions(t *testing.T) {
+	kept := "tcp://127.0.0.1:7505?bytecount=5s"
+	removed := "tcp://127.0.0.1:7506?bytecount=5s"
+	previous, err := NewOpenVPNExporter([]string{kept, removed}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := map[string]net.Conn{}
+	for _, statusPath := range []string{kept, removed} {
+		client, server := net.Pipe()
+		defer server.Close()
+		conns[statusPath] = server
+		bytecountSessionsMutex.Lock()
+		bytecountSessions[statusPath] = &bytecountSession{conn: client}
+		bytecountSessionsMutex.Unlock()
+	}
+
+	// A reload removes one of the management interfaces.
+	next, err := NewOpenVPNExporter([]string{kept}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	previous.Close()
+
+	bytecountSessionsMutex.Lock()
+	_, keptOpen := bytecountSessions[kept]
+	_, removedOpen := bytecountSessions[removed]
+	bytecountSessionsMutex.Unlock()
+	if !keptOpen || removedOpen {
+		t.Errorf("got sessions of %s open %v and of %s open %v", kept, keptOpen, removed, removedOpen)
+	}
+	conns[removed].SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := conns[removed].Write([]byte("\n")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("connection of the removed session wasn't closed: %v", err)
+	}
+}
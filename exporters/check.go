@@ -0,0 +1,98 @@
+package exporters
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exit codes of Nagios plugins.
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+	CheckUnknown  = 3
+)
+
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// CheckStatusFile evaluates a single status file the way a Nagios or
+// Icinga plugin would, using the same parser as the exporter. The result
+// is critical if the file can't be parsed, and warning or critical if it
+// hasn't been updated for the given durations. A glob pattern checks every
+// status file it matches, taking the worst result, and is critical if it
+// matches none. It returns the exit code of the plugin and a line of
+// output including performance data.
+func CheckStatusFile(statusPath string, warning time.Duration, critical time.Duration, now time.Time) (int, string) {
+	if !isStatusPathPattern(statusPath) {
+		code, message, perfData := checkStatusFile(statusPath, warning, critical, now)
+		return code, checkOutput(code, message, perfData)
+	}
+	if _, err := filepath.Match(statusPath, ""); err != nil {
+		return CheckUnknown, checkOutput(CheckUnknown, fmt.Sprintf("invalid status path %q: %s", statusPath, err), nil)
+	}
+	statusPaths := expandStatusPaths([]string{statusPath})
+	if len(statusPaths) == 0 {
+		return CheckCritical, checkOutput(CheckCritical, fmt.Sprintf("no status files match %s", statusPath), nil)
+	}
+	worst := CheckOK
+	var messages, perfData []string
+	for _, path := range statusPaths {
+		code, message, data := checkStatusFile(path, warning, critical, now)
+		worst = max(worst, code)
+		messages = append(messages, fmt.Sprintf("%s: %s", path, message))
+		// Performance data is labelled by status path, quoted as
+		// the labels may contain spaces.
+		for _, d := range data {
+			perfData = append(perfData, fmt.Sprintf("'%s %s", strings.ReplaceAll(path, "'", "''"), strings.Replace(d, "=", "'=", 1)))
+		}
+	}
+	return worst, checkOutput(worst, strings.Join(messages, ", "), perfData)
+}
+
+func checkOutput(code int, message string, perfData []string) string {
+	output := fmt.Sprintf("OPENVPN %s - %s", checkStates[code], message)
+	if len(perfData) > 0 {
+		output += " | " + strings.Join(perfData, " ")
+	}
+	return output
+}
+
+// Checks a single status file, returning the exit code, a message and
+// performance data.
+func checkStatusFile(statusPath string, warning time.Duration, critical time.Duration, now time.Time) (int, string, []string) {
+	exporter, err := NewOpenVPNExporter([]string{statusPath}, []StatusCollector{
+		NewServerStatusCollector(false, false, false, false, false, nil, nil, nil),
+		NewClientStatusCollector(false),
+	})
+	if err != nil {
+		return CheckUnknown, err.Error(), nil
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	instances, err := summarizeInstances(registry)
+	if err != nil {
+		return CheckUnknown, err.Error(), nil
+	}
+	if len(instances) != 1 || instances[0].up != 1 {
+		return CheckCritical, fmt.Sprintf("failed to parse %s", statusPath), nil
+	}
+	instance := instances[0]
+	if instance.updated == 0 {
+		return CheckUnknown, fmt.Sprintf("%s has no update time", statusPath), nil
+	}
+
+	staleness := now.Sub(time.Unix(int64(instance.updated), 0))
+	code := CheckOK
+	if staleness >= critical {
+		code = CheckCritical
+	} else if staleness >= warning {
+		code = CheckWarning
+	}
+	return code, fmt.Sprintf("%.0f clients connected, status updated %s ago", instance.clients, staleness.Truncate(time.Second)), []string{
+		fmt.Sprintf("clients=%.0f;;;0", instance.clients),
+		fmt.Sprintf("staleness=%.0fs;%.0f;%.0f;0", staleness.Seconds(), warning.Seconds(), critical.Seconds()),
+	}
+}
@@ -0,0 +1,122 @@
+package exporters
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Counts the sessions that started and ended between collections of each
+// status file, by comparing the sessions listed in consecutive client
+// lists. Sessions that both start and end between two collections aren't
+// seen, so the counts are lower bounds. The first collection of a status
+// file only establishes the sessions it lists.
+type churnTracker struct {
+	byCommonName bool
+
+	mutex sync.Mutex
+	// Common names of the sessions listed in the last collection,
+	// indexed by status path and session identifier.
+	sessions map[string]map[string]string
+	// Number of sessions started and ended, indexed by status path and
+	// common name, which is empty unless counting by common name.
+	started map[string]map[string]float64
+	ended   map[string]map[string]float64
+}
+
+func newChurnTracker(byCommonName bool) *churnTracker {
+	return &churnTracker{
+		byCommonName: byCommonName,
+		sessions:     map[string]map[string]string{},
+		started:      map[string]map[string]float64{},
+		ended:        map[string]map[string]float64{},
+	}
+}
+
+// Compares the sessions of a status file, given as the common names
+// indexed by session identifier, to those of its previous collection.
+// It returns the number of sessions started and ended so far.
+func (t *churnTracker) observe(statusPath string, sessions map[string]string) (map[string]float64, map[string]float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	started, ok := t.started[statusPath]
+	if !ok {
+		started = map[string]float64{}
+		t.started[statusPath] = started
+		t.ended[statusPath] = map[string]float64{}
+	}
+	ended := t.ended[statusPath]
+	key := func(commonName string) string {
+		if t.byCommonName {
+			return commonName
+		}
+		return ""
+	}
+
+	// Counters are exported as soon as a common name is seen.
+	if !t.byCommonName {
+		started[""] += 0
+		ended[""] += 0
+	}
+	previous, ok := t.sessions[statusPath]
+	for sessionID, commonName := range sessions {
+		started[key(commonName)] += 0
+		ended[key(commonName)] += 0
+		if _, seen := previous[sessionID]; ok && !seen {
+			started[key(commonName)]++
+		}
+	}
+	for sessionID, commonName := range previous {
+		if _, listed := sessions[sessionID]; !listed {
+			ended[key(commonName)]++
+		}
+	}
+	t.sessions[statusPath] = sessions
+
+	startedCopy := map[string]float64{}
+	for commonName, count := range started {
+		startedCopy[commonName] = count
+	}
+	endedCopy := map[string]float64{}
+	for commonName, count := range ended {
+		endedCopy[commonName] = count
+	}
+	return startedCopy, endedCopy
+}
+
+type churnTrackerState struct {
+	Sessions map[string]map[string]string  `json:"sessions"`
+	Started  map[string]map[string]float64 `json:"started"`
+	Ended    map[string]map[string]float64 `json:"ended"`
+}
+
+func (t *churnTracker) saveState() (json.RawMessage, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return json.Marshal(churnTrackerState{Sessions: t.sessions, Started: t.started, Ended: t.ended})
+}
+
+func (t *churnTracker) loadState(data json.RawMessage) error {
+	state := churnTrackerState{
+		Sessions: map[string]map[string]string{},
+		Started:  map[string]map[string]float64{},
+		Ended:    map[string]map[string]float64{},
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	// Both counts of a status file are created when it's first observed.
+	for _, counts := range []map[string]map[string]float64{state.Started, state.Ended} {
+		for statusPath := range counts {
+			if state.Started[statusPath] == nil {
+				state.Started[statusPath] = map[string]float64{}
+			}
+			if state.Ended[statusPath] == nil {
+				state.Ended[statusPath] = map[string]float64{}
+			}
+		}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sessions, t.started, t.ended = state.Sessions, state.Started, state.Ended
+	return nil
+}
@@ -0,0 +1,212 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"time"
+)
+
+// Connection states of OpenVPN clients, as reported by the state command
+// of the management interface.
+var clientConnectionStates = []string{
+	"CONNECTING",
+	"WAIT",
+	"AUTH",
+	"GET_CONFIG",
+	"ASSIGN_IP",
+	"ADD_ROUTES",
+	"CONNECTED",
+	"RECONNECTING",
+	"EXITING",
+	"RESOLVE",
+	"TCP_CONNECT",
+	"AUTH_PENDING",
+}
+
+// ClientStatusCollector converts OpenVPN client status files into
+// Prometheus metrics.
+type ClientStatusCollector struct {
+	statusUpdateTimeDesc *prometheus.Desc
+	clockDriftDesc       *prometheus.Desc
+	stateDesc            *prometheus.Desc
+	stateSecondsDesc     *prometheus.Desc
+	clientDescs          map[string]*prometheus.Desc
+	counters             *counterTracker
+}
+
+func NewClientStatusCollector(cumulativeCounters bool) *ClientStatusCollector {
+	// Counters are only compensated for resets in cumulative mode.
+	var counters *counterTracker
+	if cumulativeCounters {
+		counters = newCounterTracker()
+	}
+
+	return &ClientStatusCollector{
+		statusUpdateTimeDesc: newStatusUpdateTimeDesc(),
+		clockDriftDesc:       newStatusClockDriftDesc(),
+		stateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "client", "connection_state"),
+			"Whether the client is in the given connection state, as reported by its management interface.",
+			[]string{"status_path", "state"}, nil),
+		stateSecondsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "client", "connection_state_seconds"),
+			"Time for which the client has been in its current connection state, in seconds.",
+			[]string{"status_path"}, nil),
+		clientDescs: map[string]*prometheus.Desc{
+			"TUN/TAP read bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "tun_tap_read_bytes_total"),
+				"Total amount of TUN/TAP traffic read, in bytes.",
+				[]string{"status_path"}, nil),
+			"TUN/TAP write bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "tun_tap_write_bytes_total"),
+				"Total amount of TUN/TAP traffic written, in bytes.",
+				[]string{"status_path"}, nil),
+			"TCP/UDP read bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "tcp_udp_read_bytes_total"),
+				"Total amount of TCP/UDP traffic read, in bytes.",
+				[]string{"status_path"}, nil),
+			"TCP/UDP write bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "tcp_udp_write_bytes_total"),
+				"Total amount of TCP/UDP traffic written, in bytes.",
+				[]string{"status_path"}, nil),
+			"Auth read bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "auth_read_bytes_total"),
+				"Total amount of authentication traffic read, in bytes.",
+				[]string{"status_path"}, nil),
+			"pre-compress bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "pre_compress_bytes_total"),
+				"Total amount of data before compression, in bytes.",
+				[]string{"status_path"}, nil),
+			"post-compress bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "post_compress_bytes_total"),
+				"Total amount of data after compression, in bytes.",
+				[]string{"status_path"}, nil),
+			"pre-decompress bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "pre_decompress_bytes_total"),
+				"Total amount of data before decompression, in bytes.",
+				[]string{"status_path"}, nil),
+			"post-decompress bytes": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "client", "post_decompress_bytes_total"),
+				"Total amount of data after decompression, in bytes.",
+				[]string{"status_path"}, nil),
+		},
+		counters: counters,
+	}
+}
+
+func (c *ClientStatusCollector) Name() string {
+	return "client_status"
+}
+
+func (c *ClientStatusCollector) appliesTo(file *StatusFile) bool {
+	return !file.Server
+}
+
+func (c *ClientStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.statusUpdateTimeDesc
+	ch <- c.clockDriftDesc
+	ch <- c.stateDesc
+	ch <- c.stateSecondsDesc
+	for _, desc := range c.clientDescs {
+		ch <- desc
+	}
+}
+
+func (c *ClientStatusCollector) collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error {
+	if file.Updated != "" {
+		// Time at which the statistics were updated.
+		updated, err := parseClientUpdateTime(file.Updated)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.statusUpdateTimeDesc,
+			prometheus.GaugeValue,
+			updated,
+			statusPath)
+		ch <- prometheus.MustNewConstMetric(
+			c.clockDriftDesc,
+			prometheus.GaugeValue,
+			updated-float64(time.Now().UnixNano())/1e9,
+			statusPath)
+	}
+	if file.State != "" {
+		// All known states are exported, so that e.g. a client
+		// leaving the CONNECTED state can be alerted on.
+		states := clientConnectionStates
+		if !contains(states, file.State) {
+			states = append(append([]string{}, states...), file.State)
+		}
+		for _, state := range states {
+			value := 0.0
+			if state == file.State {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.stateDesc,
+				prometheus.GaugeValue,
+				value,
+				statusPath,
+				state)
+		}
+		since, err := strconv.ParseInt(file.StateSince, 10, 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.stateSecondsDesc,
+			prometheus.GaugeValue,
+			time.Since(time.Unix(since, 0)).Seconds(),
+			statusPath)
+	}
+	for key, stat := range file.Stats {
+		desc, ok := c.clientDescs[key]
+		if !ok {
+			return fmt.Errorf("unsupported key: %q", key)
+		}
+		// Traffic counters.
+		value, err := strconv.ParseFloat(stat, 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(
+			desc,
+			prometheus.CounterValue,
+			c.counters.adjust(statusPath, desc, []string{statusPath}, value),
+			statusPath)
+	}
+	c.counters.prune(statusPath)
+	return nil
+}
+
+// Parses the time at which client statistics were updated. OpenVPN writes
+// it in local time in a human readable form, but some builds and wrappers
+// write a UNIX timestamp instead.
+func parseClientUpdateTime(updated string) (float64, error) {
+	if timestamp, err := strconv.ParseInt(updated, 10, 64); err == nil {
+		return float64(timestamp), nil
+	}
+	timeParser, err := parseStatusTime(updated)
+	if err != nil {
+		return 0, err
+	}
+	return float64(timeParser.Unix()), nil
+}
+
+// SaveState returns the values of counters tracked in cumulative mode.
+func (c *ClientStatusCollector) SaveState() (json.RawMessage, error) {
+	if c.counters == nil {
+		return json.RawMessage("null"), nil
+	}
+	return c.counters.saveState()
+}
+
+// LoadState restores the values of counters tracked in cumulative mode.
+func (c *ClientStatusCollector) LoadState(data json.RawMessage) error {
+	if c.counters == nil || string(data) == "null" {
+		return nil
+	}
+	return c.counters.loadState(data)
+}
@@ -0,0 +1,158 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// A server status source and the clients connected to it, as served by
+// ClientsHandler.
+type apiInstance struct {
+	Name       string      `json:"name"`
+	StatusPath string      `json:"status_path"`
+	Error      string      `json:"error,omitempty"`
+	Clients    []apiClient `json:"clients"`
+}
+
+// A client listed in the CLIENT_LIST of a server status file. Columns that
+// older versions of OpenVPN don't write are left out.
+type apiClient struct {
+	CommonName         string `json:"common_name"`
+	RealAddress        string `json:"real_address,omitempty"`
+	VirtualAddress     string `json:"virtual_address,omitempty"`
+	VirtualIPv6Address string `json:"virtual_ipv6_address,omitempty"`
+	Username           string `json:"username,omitempty"`
+	ClientID           string `json:"client_id,omitempty"`
+	// UNIX timestamp at which the client connected.
+	ConnectedSince int64  `json:"connected_since"`
+	BytesReceived  uint64 `json:"bytes_received"`
+	BytesSent      uint64 `json:"bytes_sent"`
+}
+
+// ClientsHandler serves the clients connected to each server as JSON, e.g.
+// at /api/v1/clients, for tools that would otherwise have to parse the
+// metrics. Status files are read on request, unless they were read less
+// than a few seconds ago. Client status files are left out. Real addresses
+// are served according to the privacy setting, as in metrics. As the
+// clients of a server are sensitive, requests must carry the token as a
+// bearer token.
+type ClientsHandler struct {
+	sources func() []OverviewSource
+	privacy *RealAddressPrivacy
+	token   string
+	origins []string
+}
+
+// NewClientsHandler creates a handler serving the clients of the sources
+// returned by the given function, which may change over time. Status paths
+// that are glob patterns are expanded.
+func NewClientsHandler(sources func() []OverviewSource, privacy *RealAddressPrivacy, token string) *ClientsHandler {
+	return &ClientsHandler{
+		sources: sources,
+		privacy: privacy,
+		token:   token,
+	}
+}
+
+// SetCORSOrigins allows web pages of the given origins, or of any origin
+// if one of them is *, to request the clients from the browser, e.g. for
+// dashboards. By default, no cross-origin requests are allowed.
+func (h *ClientsHandler) SetCORSOrigins(origins []string) {
+	h.origins = origins
+}
+
+// Adds the CORS headers allowing the origin of a request, if any. It
+// returns false if the origin isn't allowed.
+func (h *ClientsHandler) allowOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	w.Header().Add("Vary", "Origin")
+	if !contains(h.origins, origin) && !contains(h.origins, "*") {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "GET")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+	return true
+}
+
+// Reads the clients connected to the server writing the status file. It
+// returns false for client status files.
+func (h *ClientsHandler) clients(statusPath string) ([]apiClient, bool, error) {
+	file, err := readRecentStatusFile(statusPath)
+	if err != nil {
+		return nil, true, err
+	}
+	if !file.Server {
+		return nil, false, nil
+	}
+	rows, err := file.rows("CLIENT_LIST")
+	if err != nil {
+		return nil, true, err
+	}
+	clients := []apiClient{}
+	for _, row := range rows {
+		client := apiClient{
+			CommonName:         row["Common Name"],
+			VirtualAddress:     row["Virtual Address"],
+			VirtualIPv6Address: row["Virtual IPv6 Address"],
+			Username:           row["Username"],
+			ClientID:           row["Client ID"],
+		}
+		if h.privacy.exported() {
+			client.RealAddress = h.privacy.value(row["Real Address"])
+		}
+		if client.ConnectedSince, err = strconv.ParseInt(row["Connected Since (time_t)"], 10, 64); err != nil {
+			return nil, true, fmt.Errorf("invalid connection time of %s: %s", client.CommonName, err)
+		}
+		if client.BytesReceived, err = strconv.ParseUint(row["Bytes Received"], 10, 64); err != nil {
+			return nil, true, fmt.Errorf("invalid bytes received by %s: %s", client.CommonName, err)
+		}
+		if client.BytesSent, err = strconv.ParseUint(row["Bytes Sent"], 10, 64); err != nil {
+			return nil, true, fmt.Errorf("invalid bytes sent to %s: %s", client.CommonName, err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, true, nil
+}
+
+func (h *ClientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowed := h.allowOrigin(w, r)
+	// Preflight requests don't carry the token.
+	if r.Method == http.MethodOptions {
+		if !allowed {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !checkBearerToken(w, r, h.token) {
+		return
+	}
+	instances := []apiInstance{}
+	for _, source := range h.sources() {
+		for _, statusPath := range expandStatusPaths([]string{source.StatusPath}) {
+			clients, server, err := h.clients(statusPath)
+			if !server {
+				continue
+			}
+			instance := apiInstance{
+				Name:       source.Name,
+				StatusPath: statusPath,
+				Clients:    clients,
+			}
+			if err != nil {
+				instance.Error = err.Error()
+				instance.Clients = []apiClient{}
+			}
+			instances = append(instances, instance)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]apiInstance{"instances": instances})
+}
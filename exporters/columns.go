@@ -0,0 +1,199 @@
+package exporters
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ColumnMapping declares a metric whose value is taken from a column of
+// the entries of a section of server status files, or from a key of the
+// GLOBAL_STATS section.
+type ColumnMapping struct {
+	Section   string
+	Column    string
+	Name      string
+	Help      string
+	ValueType prometheus.ValueType
+	// Label names, and the columns from which their values are taken.
+	LabelNames   []string
+	LabelColumns []string
+}
+
+// LoadColumnMappings reads column mappings from a CSV file with a header
+// row of section,column,name,type,labels. The type is either counter or
+// gauge, and labels are written as name=Column pairs, separated by
+// semicolons:
+//
+//	section,column,name,type,labels
+//	CLIENT_LIST,Bytes Received,openvpn_custom_received_bytes_total,counter,common_name=Common Name
+//
+// The status_path label is added to all metrics.
+func LoadColumnMappings(path string) ([]ColumnMapping, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != "section,column,name,type,labels" {
+		return nil, fmt.Errorf("%s: header row should be section,column,name,type,labels", path)
+	}
+	var mappings []ColumnMapping
+	for _, record := range records[1:] {
+		mapping := ColumnMapping{
+			Section: record[0],
+			Column:  record[1],
+			Name:    record[2],
+			Help:    fmt.Sprintf("Value of the %s column of %s entries.", record[1], record[0]),
+		}
+		switch record[3] {
+		case "counter":
+			mapping.ValueType = prometheus.CounterValue
+		case "gauge":
+			mapping.ValueType = prometheus.GaugeValue
+		default:
+			return nil, fmt.Errorf("%s: invalid type %q for %s, should be counter or gauge", path, record[3], record[2])
+		}
+		if record[4] != "" {
+			for _, label := range strings.Split(record[4], ";") {
+				parts := strings.SplitN(label, "=", 2)
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("%s: label %q of %s should be written as name=Column", path, label, record[2])
+				}
+				mapping.LabelNames = append(mapping.LabelNames, parts[0])
+				mapping.LabelColumns = append(mapping.LabelColumns, parts[1])
+			}
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// ColumnCollector exports metrics declared by column mappings, so that
+// columns added by newer or patched versions of OpenVPN can be exported
+// without changes to the exporter.
+type ColumnCollector struct {
+	entryHeaders   map[string][]OpenvpnServerHeader
+	statsDescs     map[string]*prometheus.Desc
+	statsTypes     map[string]prometheus.ValueType
+	collisionsDesc *prometheus.Desc
+}
+
+// NewColumnCollector creates a collector for the given column mappings.
+// Labels taken from the Real Address column are exported according to
+// privacy.
+func NewColumnCollector(mappings []ColumnMapping, privacy *RealAddressPrivacy) (*ColumnCollector, error) {
+	c := &ColumnCollector{
+		entryHeaders:   map[string][]OpenvpnServerHeader{},
+		statsDescs:     map[string]*prometheus.Desc{},
+		statsTypes:     map[string]prometheus.ValueType{},
+		collisionsDesc: newEntryCollisionsDesc(),
+	}
+	for _, mapping := range mappings {
+		if !model.IsValidMetricName(model.LabelValue(mapping.Name)) {
+			return nil, fmt.Errorf("invalid metric name %q", mapping.Name)
+		}
+		for _, label := range mapping.LabelNames {
+			if !model.LabelName(label).IsValid() || label == "status_path" {
+				return nil, fmt.Errorf("invalid label name %q of %s", label, mapping.Name)
+			}
+		}
+		labelNames, labelColumns := privacy.labels(mapping.LabelNames, mapping.LabelColumns)
+		desc := prometheus.NewDesc(
+			mapping.Name,
+			mapping.Help,
+			append([]string{"status_path"}, labelNames...), nil)
+		if mapping.Section == "GLOBAL_STATS" {
+			if len(mapping.LabelNames) > 0 {
+				return nil, fmt.Errorf("%s can't have labels, as GLOBAL_STATS has no columns", mapping.Name)
+			}
+			c.statsDescs[mapping.Column] = desc
+			c.statsTypes[mapping.Column] = mapping.ValueType
+			continue
+		}
+		c.entryHeaders[mapping.Section] = append(c.entryHeaders[mapping.Section], OpenvpnServerHeader{
+			LabelColumns: labelColumns,
+			privacy:      privacy,
+			Metrics: []OpenvpnServerHeaderField{
+				{
+					Column:    mapping.Column,
+					Desc:      desc,
+					ValueType: mapping.ValueType,
+				},
+			},
+		})
+	}
+	return c, nil
+}
+
+func (c *ColumnCollector) Name() string {
+	return "columns"
+}
+
+func (c *ColumnCollector) appliesTo(file *StatusFile) bool {
+	return file.Server
+}
+
+func (c *ColumnCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, headers := range c.entryHeaders {
+		for _, header := range headers {
+			for _, metric := range header.Metrics {
+				ch <- metric.Desc
+			}
+		}
+	}
+	for _, desc := range c.statsDescs {
+		ch <- desc
+	}
+	ch <- c.collisionsDesc
+}
+
+func (c *ColumnCollector) collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error {
+	collisions := 0
+	for section, headers := range c.entryHeaders {
+		rows, err := file.rows(section)
+		if err != nil {
+			return err
+		}
+		for _, header := range headers {
+			n, err := collectEntries(statusPath, header, rows, nil, nil, ch)
+			if err != nil {
+				return err
+			}
+			collisions += n
+		}
+	}
+	if len(c.entryHeaders) > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			c.collisionsDesc,
+			prometheus.GaugeValue,
+			float64(collisions),
+			statusPath,
+			c.Name())
+	}
+	for key, desc := range c.statsDescs {
+		if stat, ok := file.Stats[key]; ok {
+			value, err := strconv.ParseFloat(stat, 64)
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(
+				desc,
+				c.statsTypes[key],
+				value,
+				statusPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package exporters
+
+import (
+	"fmt"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Config is the contents of the configuration file, which declares the
+// status sources to collect from in multi-instance setups:
+//
+//	sources:
+//	  - name: office
+//	    path: /var/run/openvpn/office.status
+//	    labels:
+//	      site: ams1
+//	  - name: roadwarriors
+//	    type: management
+//	    address: 127.0.0.1:7505
+//	    password_file: /etc/openvpn/management.pw
+//	    bytecount_interval: 5s
+//	    ignore_individuals: true
+//	    timeout: 2s
+//	    cache_ttl: 10s
+//	  - name: datacenter
+//	    type: management
+//	    address: /run/openvpn/datacenter.sock
+//	    collectors:
+//	      routing: false
+type Config struct {
+	Sources []StatusSource `yaml:"sources"`
+}
+
+// StatusSource is an OpenVPN instance whose status is read either from a
+// status file (type file, the default), which may also be a docker:// or
+// k8s:// path, or from its management interface (type management).
+type StatusSource struct {
+	// Name identifying the source in logs and in the state file.
+	Name         string `yaml:"name"`
+	Type         string `yaml:"type"`
+	Path         string `yaml:"path"`
+	Address      string `yaml:"address"`
+	PasswordFile string `yaml:"password_file"`
+	// Interval at which a management interface sends the byte counts
+	// of its clients. Byte counts aren't subscribed to if zero.
+	BytecountInterval time.Duration `yaml:"bytecount_interval"`
+	// Labels added to all metrics of the source.
+	Labels map[string]string `yaml:"labels"`
+	// Overrides -ignore.individuals and the individuals query
+	// parameter for the source, if set.
+	IgnoreIndividuals *bool `yaml:"ignore_individuals"`
+	// Sums the traffic of the sessions of each common name, rather
+	// than exporting metrics per connection.
+	Aggregate bool `yaml:"aggregate"`
+	// Overrides -collect.timeout for the source, if set. For
+	// management interfaces, it also replaces the default timeout of
+	// connecting and of reading each response.
+	Timeout time.Duration `yaml:"timeout"`
+	// Overrides -collect.cache-ttl for the source, if set, so that
+	// sources are read again at most once per TTL of their own.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// Enables or disables collectors for the source, overriding their
+	// -collector.<name> flag. See SourceCollectors.
+	Collectors map[string]bool `yaml:"collectors"`
+}
+
+// SourceCollectors are the names of the collectors that can be enabled or
+// disabled per source.
+var SourceCollectors = []string{"server_status", "routing", "global_stats", "client_status"}
+
+// CollectorEnabled returns whether the collector of the given name is
+// enabled for the source, which otherwise defaults to the given setting.
+func (s StatusSource) CollectorEnabled(name string, enabled bool) bool {
+	if sourceEnabled, ok := s.Collectors[name]; ok {
+		return sourceEnabled
+	}
+	return enabled
+}
+
+// LoadConfig reads and validates a configuration file. Unknown keys are
+// rejected, so that typos don't go unnoticed.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range config.Sources {
+		source := &config.Sources[i]
+		if source.Name == "" {
+			return nil, fmt.Errorf("%s: source %d has no name", path, i+1)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("%s: source %s specified more than once", path, source.Name)
+		}
+		names[source.Name] = true
+
+		switch source.Type {
+		case "", "file":
+			source.Type = "file"
+			if source.Path == "" || source.Address != "" || source.PasswordFile != "" || source.BytecountInterval != 0 {
+				return nil, fmt.Errorf("%s: source %s of type file requires a path, and no address, password_file or bytecount_interval", path, source.Name)
+			}
+		case "management":
+			if source.Address == "" || source.Path != "" {
+				return nil, fmt.Errorf("%s: source %s of type management requires an address, and no path", path, source.Name)
+			}
+		default:
+			return nil, fmt.Errorf("%s: source %s has invalid type %q, should be file or management", path, source.Name, source.Type)
+		}
+
+		if source.BytecountInterval < 0 {
+			return nil, fmt.Errorf("%s: source %s has negative bytecount_interval", path, source.Name)
+		}
+		if source.Timeout < 0 {
+			return nil, fmt.Errorf("%s: source %s has negative timeout", path, source.Name)
+		}
+		if source.CacheTTL < 0 {
+			return nil, fmt.Errorf("%s: source %s has negative cache_ttl", path, source.Name)
+		}
+
+		for name := range source.Collectors {
+			if !contains(SourceCollectors, name) {
+				return nil, fmt.Errorf("%s: source %s has invalid collector %q, should be one of %s", path, source.Name, name, strings.Join(SourceCollectors, ", "))
+			}
+		}
+
+		for name := range source.Labels {
+			if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+				return nil, fmt.Errorf("%s: source %s has invalid label name %q", path, source.Name, name)
+			}
+			if contains(sourceReservedLabels, name) {
+				return nil, fmt.Errorf("%s: source %s has label %q, which is already used by the exporter's metrics", path, source.Name, name)
+			}
+		}
+	}
+	return &config, nil
+}
+
+// StatusPath returns the status path under which the source is read and
+// reported in the status_path label.
+func (s StatusSource) StatusPath() string {
+	if s.Type == "management" {
+		return managementStatusPath(s.Address, s.PasswordFile, s.BytecountInterval, s.Timeout)
+	}
+	return s.Path
+}
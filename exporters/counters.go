@@ -0,0 +1,157 @@
+package exporters
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keeps track of the values of counters across collections, so that
+// counters that are reset (e.g., due to OpenVPN being restarted or a
+// client reconnecting) can be made monotonic by adding the value they
+// had prior to being reset. Counters are tracked by their labels, so
+// resets are only compensated for series whose labels survive them, e.g.
+// when ignoring individuals or aggregating clients, as the labels of
+// individual clients include the time at which they connected.
+type counterTracker struct {
+	mutex   sync.Mutex
+	last    map[string]float64
+	offsets map[string]float64
+	// Time at which each counter was last adjusted.
+	seen map[string]time.Time
+}
+
+// How long counters are remembered after their series disappeared, so
+// that series missing from a few collections, e.g. while OpenVPN restarts
+// or a client reconnects, keep their offsets when they reappear.
+const counterRetention = 15 * time.Minute
+
+func newCounterTracker() *counterTracker {
+	return &counterTracker{
+		last:    map[string]float64{},
+		offsets: map[string]float64{},
+		seen:    map[string]time.Time{},
+	}
+}
+
+// Returns the key of a counter of a status file. Keys start with the
+// status path, so that they can be pruned per status file, followed by
+// the metric name rather than the whole description, so that saved
+// offsets survive changes to the help text.
+func counterKey(statusPath string, desc *prometheus.Desc, labels []string) string {
+	return statusPath + "\x00" + descName(desc) + "\x00" + strings.Join(labels, "\x00")
+}
+
+// Returns the fully-qualified name of a metric description, which the
+// client library only exposes through its string representation.
+func descName(desc *prometheus.Desc) string {
+	name, _ := descStringName(desc.String())
+	return name
+}
+
+// Extracts the name from the string representation of a metric
+// description, of the form Desc{fqName: "name", help: ...}.
+func descStringName(s string) (string, bool) {
+	const prefix = "Desc{fqName: "
+	if !strings.HasPrefix(s, prefix) {
+		return "", false
+	}
+	name, err := strconv.QuotedPrefix(s[len(prefix):])
+	if err != nil {
+		return "", false
+	}
+	name, err = strconv.Unquote(name)
+	return name, err == nil
+}
+
+// Returns the value of a counter of a status file, compensated for any
+// resets observed since the counter was first seen. Without a tracker,
+// which is the case when counters aren't cumulative, the value is
+// returned as is.
+func (t *counterTracker) adjust(statusPath string, desc *prometheus.Desc, labels []string, value float64) float64 {
+	if t == nil {
+		return value
+	}
+	key := counterKey(statusPath, desc, labels)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if last, ok := t.last[key]; ok && value < last {
+		t.offsets[key] += last
+	}
+	t.last[key] = value
+	t.seen[key] = time.Now()
+	return value + t.offsets[key]
+}
+
+// Forgets the counters of a status file that weren't adjusted for
+// counterRetention, i.e. whose series disappeared for good, such as those
+// of clients that disconnected. It should be called after collecting a
+// status file.
+func (t *counterTracker) prune(statusPath string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	prefix := statusPath + "\x00"
+	for key := range t.last {
+		if strings.HasPrefix(key, prefix) && time.Since(t.seen[key]) >= counterRetention {
+			delete(t.last, key)
+			delete(t.offsets, key)
+			delete(t.seen, key)
+		}
+	}
+}
+
+type counterTrackerState struct {
+	Last    map[string]float64 `json:"last"`
+	Offsets map[string]float64 `json:"offsets"`
+}
+
+func (t *counterTracker) saveState() (json.RawMessage, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return json.Marshal(counterTrackerState{Last: t.last, Offsets: t.offsets})
+}
+
+func (t *counterTracker) loadState(data json.RawMessage) error {
+	state := counterTrackerState{
+		Last:    map[string]float64{},
+		Offsets: map[string]float64{},
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	// Keys of earlier versions lacked the status path, and would never
+	// be pruned. Later ones held the whole description of the metric
+	// instead of its name.
+	last, offsets := map[string]float64{}, map[string]float64{}
+	for key, value := range state.Last {
+		parts := strings.SplitN(key, "\x00", 3)
+		if strings.HasPrefix(key, "Desc{") || len(parts) < 2 {
+			continue
+		}
+		if name, ok := descStringName(parts[1]); ok {
+			parts[1] = name
+		}
+		newKey := strings.Join(parts, "\x00")
+		last[newKey] = value
+		if offset, ok := state.Offsets[key]; ok {
+			offsets[newKey] = offset
+		}
+	}
+	// Counters are retained from the time they are loaded.
+	now := time.Now()
+	seen := map[string]time.Time{}
+	for key := range last {
+		seen[key] = now
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.last, t.offsets, t.seen = last, offsets, seen
+	return nil
+}
@@ -0,0 +1,65 @@
+package exporters
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func TestCounterTrackerMissedCollection(t *testing.T) {
+	desc := prometheus.NewDesc("openvpn_bytes_total", "Bytes.", []string{"common_name"}, nil)
+	tracker := newCounterTracker()
+	labels := []string{"alice"}
+	if got := tracker.adjust("server.status", desc, labels, 100); got != 100 {
+		t.Errorf("got %v, want 100", got)
+	}
+	tracker.prune("server.status")
+
+	// The client reconnects, missing from one collection.
+	tracker.prune("server.status")
+	if got := tracker.adjust("server.status", desc, labels, 10); got != 110 {
+		t.Errorf("got %v after reconnecting, want 110", got)
+	}
+
+	// Counters missing for longer than the retention are forgotten.
+	tracker.seen[counterKey("server.status", desc, labels)] = time.Now().Add(-counterRetention)
+	tracker.prune("server.status")
+	if got := tracker.adjust("server.status", desc, labels, 5); got != 5 {
+		t.Errorf("got %v after retention, want 5", got)
+	}
+}
+
+func TestCounterTrackerState(t *testing.T) {
+	before := prometheus.NewDesc("openvpn_bytes_total", "Bytes.", []string{"common_name"}, nil)
+	after := prometheus.NewDesc("openvpn_bytes_total", "Amount of bytes.", []string{"common_name"}, nil)
+	tracker := newCounterTracker()
+	tracker.adjust("server.status", before, []string{"alice"}, 100)
+	tracker.adjust("server.status", before, []string{"alice"}, 10)
+	data, err := tracker.saveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Offsets survive changes to the help text.
+	restored := newCounterTracker()
+	if err := restored.loadState(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.adjust("server.status", after, []string{"alice"}, 20); got != 120 {
+		t.Errorf("got %v, want 120", got)
+	}
+
+	// Earlier versions keyed counters on the whole description.
+	legacy, _ := json.Marshal(counterTrackerState{
+		Last:    map[string]float64{"server.status\x00" + before.String() + "\x00alice": 10},
+		Offsets: map[string]float64{"server.status\x00" + before.String() + "\x00alice": 100},
+	})
+	restored = newCounterTracker()
+	if err := restored.loadState(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.adjust("server.status", after, []string{"alice"}, 20); got != 120 {
+		t.Errorf("got %v from legacy state, want 120", got)
+	}
+}
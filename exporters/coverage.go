@@ -0,0 +1,121 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+)
+
+// CoverageCollector compares the clients provisioned in an OpenVPN
+// client-config-dir with the clients connected to the OpenVPN servers.
+// Every file in the directory is named after the common name of a
+// provisioned client, which makes it possible to see which site-to-site
+// peers, such as branch offices, are offline.
+type CoverageCollector struct {
+	statusPaths func() []string
+	ccdDir      string
+
+	expectedDesc          *prometheus.Desc
+	expectedConnectedDesc *prometheus.Desc
+	coverageDesc          *prometheus.Desc
+	clientConnectedDesc   *prometheus.Desc
+}
+
+func NewCoverageCollector(statusPaths func() []string, ccdDir string) *CoverageCollector {
+	return &CoverageCollector{
+		statusPaths: statusPaths,
+		ccdDir:      ccdDir,
+		expectedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "clients_expected"),
+			"Number of clients provisioned in the client-config-dir.",
+			nil, nil),
+		expectedConnectedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "clients_expected_connected"),
+			"Number of clients provisioned in the client-config-dir that are connected.",
+			nil, nil),
+		coverageDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "clients_coverage_ratio"),
+			"Fraction of clients provisioned in the client-config-dir that are connected.",
+			nil, nil),
+		clientConnectedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "expected_client_connected"),
+			"Whether a client provisioned in the client-config-dir is connected.",
+			[]string{"common_name"}, nil),
+	}
+}
+
+// Returns the common names of the clients provisioned in the
+// client-config-dir. The DEFAULT file, which OpenVPN uses for clients
+// without a file of their own, and hidden files are ignored.
+func (c *CoverageCollector) expectedClients() ([]string, error) {
+	files, err := ioutil.ReadDir(c.ccdDir)
+	if err != nil {
+		return nil, err
+	}
+	var commonNames []string
+	for _, file := range files {
+		if file.IsDir() || file.Name() == "DEFAULT" || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		commonNames = append(commonNames, file.Name())
+	}
+	return commonNames, nil
+}
+
+func (c *CoverageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.expectedDesc
+	ch <- c.expectedConnectedDesc
+	ch <- c.coverageDesc
+	ch <- c.clientConnectedDesc
+}
+
+func (c *CoverageCollector) Collect(ch chan<- prometheus.Metric) {
+	expected, err := c.expectedClients()
+	if err != nil {
+		slog.Error("Failed to read client-config-dir", "path", c.ccdDir, "err", err)
+		return
+	}
+	connected := map[string]bool{}
+	for _, statusPath := range expandStatusPaths(c.statusPaths()) {
+		clients, err := readServerClientList(statusPath)
+		if err != nil {
+			slog.Error("Failed to read clients", "status_path", statusPath, "err", err)
+			continue
+		}
+		for _, client := range clients {
+			connected[client["Common Name"]] = true
+		}
+	}
+
+	expectedConnected := 0
+	for _, commonName := range expected {
+		value := 0.0
+		if connected[commonName] {
+			value = 1.0
+			expectedConnected++
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.clientConnectedDesc,
+			prometheus.GaugeValue,
+			value,
+			commonName)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.expectedDesc,
+		prometheus.GaugeValue,
+		float64(len(expected)))
+	ch <- prometheus.MustNewConstMetric(
+		c.expectedConnectedDesc,
+		prometheus.GaugeValue,
+		float64(expectedConnected))
+	// Without any provisioned clients, coverage is complete.
+	coverage := 1.0
+	if len(expected) > 0 {
+		coverage = float64(expectedConnected) / float64(len(expected))
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.coverageDesc,
+		prometheus.GaugeValue,
+		coverage)
+}
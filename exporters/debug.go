@@ -0,0 +1,54 @@
+package exporters
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// StatusDebugHandler serves the raw contents of a status file as last
+// read by the exporter, e.g. /debug/status?path=/etc/openvpn/status.log,
+// so that parsing problems can be diagnosed without shell access to the
+// VPN host. Only the configured status paths can be requested, and
+// requests must carry the token as a bearer token, as status files
+// contain the addresses of clients.
+type StatusDebugHandler struct {
+	statusPaths func() []string
+	token       string
+}
+
+func NewStatusDebugHandler(statusPaths func() []string, token string) *StatusDebugHandler {
+	return &StatusDebugHandler{
+		statusPaths: statusPaths,
+		token:       token,
+	}
+}
+
+func (h *StatusDebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !checkBearerToken(w, r, h.token) {
+		return
+	}
+	statusPath := r.URL.Query().Get("path")
+	if !contains(expandStatusPaths(h.statusPaths()), statusPath) {
+		http.Error(w, "Unknown status path: "+statusPath, http.StatusNotFound)
+		return
+	}
+	contents, fetched, ok := LastStatus(statusPath)
+	if !ok {
+		http.Error(w, "Status path not read yet: "+statusPath, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Last-Modified", fetched.UTC().Format(http.TimeFormat))
+	w.Write(contents)
+}
+
+// Returns whether the request carries the token as a bearer token,
+// responding with 401 Unauthorized otherwise.
+func checkBearerToken(w http.ResponseWriter, r *http.Request, token string) bool {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package exporters
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DirectoryDiscoverer discovers status files in directories, such as
+// /run/openvpn/status/, adding and removing status sources as files appear
+// and disappear. Unlike status paths written as glob patterns, each file is
+// collected as a source of its own, labeled with its instance name, which
+// is its name without extension. The discovered files are exported as
+// openvpn_discovered_status_file_info.
+type DirectoryDiscoverer struct {
+	directories []string
+	pattern     string
+	interval    time.Duration
+	update      func(sources []StatusSource) error
+	infoDesc    *prometheus.Desc
+
+	mutex   sync.Mutex
+	sources []StatusSource
+}
+
+// NewDirectoryDiscoverer creates a discoverer of the files in the
+// directories whose names match the glob pattern. The update function is
+// called with the discovered sources whenever files appear or disappear,
+// and again when rescanning the directories every interval if it fails.
+func NewDirectoryDiscoverer(directories []string, pattern string, interval time.Duration, update func(sources []StatusSource) error) (*DirectoryDiscoverer, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return &DirectoryDiscoverer{
+		directories: directories,
+		pattern:     pattern,
+		interval:    interval,
+		update:      update,
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "discovered", "status_file_info"),
+			"Status files discovered in a watched directory.",
+			[]string{"directory", "status_path"}, nil),
+	}, nil
+}
+
+// Discover lists the status files in the directories, ordered by path.
+// Hidden files and directories are skipped, as are directories that don't
+// exist (yet).
+func (d *DirectoryDiscoverer) Discover() ([]StatusSource, error) {
+	var sources []StatusSource
+	for _, directory := range d.directories {
+		entries, err := os.ReadDir(directory)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			if matched, _ := filepath.Match(d.pattern, name); !matched {
+				continue
+			}
+			statusPath := filepath.Join(directory, name)
+			sources = append(sources, StatusSource{
+				Name:   statusPath,
+				Type:   "file",
+				Path:   statusPath,
+				Labels: map[string]string{"instance_name": strings.TrimSuffix(name, filepath.Ext(name))},
+			})
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+	return sources, nil
+}
+
+// Run watches the directories, rediscovering the status files whenever
+// files are created, removed or renamed in them and every interval,
+// starting from the given sources. Directories are watched again once
+// they're created, e.g. when a runtime directory removed by systemd on
+// stopping OpenVPN is recreated. It never returns.
+func (d *DirectoryDiscoverer) Run(sources []StatusSource) {
+	d.mutex.Lock()
+	d.sources = sources
+	d.mutex.Unlock()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Failed to watch directories, rescanning them every interval only", "err", err)
+	}
+	watch := func() {
+		if watcher == nil {
+			return
+		}
+		for _, directory := range d.directories {
+			// Directories that don't exist are watched once
+			// they're found when rescanning.
+			watcher.Add(directory)
+		}
+	}
+	rediscover := func() {
+		watch()
+		discovered, err := d.Discover()
+		if err != nil {
+			slog.Error("Failed to discover status files", "err", err)
+			return
+		}
+		if reflect.DeepEqual(discovered, sources) {
+			return
+		}
+		if err := d.update(discovered); err != nil {
+			slog.Error("Failed to update discovered status files", "err", err)
+			return
+		}
+		sources = discovered
+		d.mutex.Lock()
+		d.sources = sources
+		d.mutex.Unlock()
+	}
+	watch()
+
+	var events <-chan fsnotify.Event
+	var errors <-chan error
+	if watcher != nil {
+		events, errors = watcher.Events, watcher.Errors
+	}
+	ticker := time.NewTicker(d.interval)
+	for {
+		select {
+		case event := <-events:
+			// Status files are rewritten in place, so writes don't
+			// change the set of files.
+			if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+				rediscover()
+			}
+		case err := <-errors:
+			slog.Error("Failed to watch directories", "err", err)
+		case <-ticker.C:
+			rediscover()
+		}
+	}
+}
+
+func (d *DirectoryDiscoverer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.infoDesc
+}
+
+func (d *DirectoryDiscoverer) Collect(ch chan<- prometheus.Metric) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, source := range d.sources {
+		ch <- prometheus.MustNewConstMetric(
+			d.infoDesc,
+			prometheus.GaugeValue,
+			1,
+			filepath.Dir(source.Path),
+			source.Path)
+	}
+}
@@ -0,0 +1,18 @@
+// Package exporters implements the collectors of openvpn_exporter, which
+// convert the status files and management interfaces of OpenVPN into
+// Prometheus metrics. Besides being used by the openvpn_exporter binary,
+// it can be embedded in other Go programs:
+//
+//	exporter, err := exporters.New(exporters.Options{
+//		StatusPaths:       []string{"/var/run/openvpn/server.status"},
+//		IgnoreIndividuals: true,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	registry.MustRegister(exporter)
+//
+// Options and the exported functions used to construct it are kept
+// backwards compatible. Individual collectors can be combined using
+// NewOpenVPNExporter instead.
+package exporters
@@ -0,0 +1,86 @@
+package exporters
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Returns an HTTP client and base URL for talking to the Docker Engine
+// API, based on DOCKER_HOST. Only unix sockets and plain TCP are
+// supported.
+func dockerClient() (*http.Client, string, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, "", err
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		return &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		}, "http://docker", nil
+	case "tcp":
+		return &http.Client{Timeout: 10 * time.Second}, "http://" + u.Host, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported DOCKER_HOST: %q", host)
+	}
+}
+
+type dockerFile struct {
+	io.Reader
+	body io.Closer
+}
+
+func (f *dockerFile) Close() error {
+	return f.body.Close()
+}
+
+// Opens a file inside a container through the Docker Engine API, which
+// returns the file wrapped in a tar archive. This is equivalent to
+// running "docker exec <container> cat <path>", but doesn't require any
+// tools to be present inside the container.
+func openDockerFile(container string, path string) (io.ReadCloser, error) {
+	client, baseURL, err := dockerClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(fmt.Sprintf(
+		"%s/containers/%s/archive?path=%s",
+		baseURL, url.PathEscape(container), url.QueryEscape(path)))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read %s from container %s: %s", path, container, resp.Status)
+	}
+
+	archive := tar.NewReader(resp.Body)
+	header, err := archive.Next()
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if header.Typeflag != tar.TypeReg {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s in container %s is not a regular file", path, container)
+	}
+	return &dockerFile{Reader: archive, body: resp.Body}, nil
+}
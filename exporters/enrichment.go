@@ -0,0 +1,191 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of concurrent requests to the enrichment service.
+const enrichmentConcurrency = 8
+
+type enrichedClient struct {
+	labels []string
+	// Whether looking up the common name failed, in which case it's
+	// omitted until it's retried.
+	failed  bool
+	expires time.Time
+}
+
+// Lookups that failed are retried after this long, rather than on every
+// refresh, so that a failing service isn't flooded with requests.
+const enrichmentFailureTTL = time.Minute
+
+// EnrichmentCollector queries an external HTTP service for every common
+// name connected to the OpenVPN servers, exporting the labels it returns
+// as an info metric. This provides a generic hook for integrating with a
+// CMDB or IPAM. The service should respond with a JSON object, of which
+// only the fields named after the configured labels are used, or with a
+// 404 status code for unknown common names. The connected common names
+// are looked up in the background, so that a slow service doesn't delay
+// scrapes. Responses are cached, including those of unknown common names,
+// and failed lookups for a short while.
+type EnrichmentCollector struct {
+	statusPaths func() []string
+	urlTemplate string
+	labels      []string
+	cacheTTL    time.Duration
+	interval    time.Duration
+	client      *http.Client
+
+	infoDesc *prometheus.Desc
+
+	mutex   sync.Mutex
+	clients map[string]enrichedClient
+}
+
+// NewEnrichmentCollector creates a collector that requests urlTemplate,
+// in which %s is replaced by the escaped common name. The connected common
+// names are refreshed at the given interval by Run.
+func NewEnrichmentCollector(statusPaths func() []string, urlTemplate string, labels []string, cacheTTL time.Duration, timeout time.Duration, interval time.Duration) (*EnrichmentCollector, error) {
+	if !strings.Contains(urlTemplate, "%s") {
+		return nil, fmt.Errorf("enrichment URL %q should contain %%s", urlTemplate)
+	}
+	for _, label := range labels {
+		if !model.LabelName(label).IsValid() || label == "common_name" {
+			return nil, fmt.Errorf("invalid enrichment label name %q", label)
+		}
+	}
+	return &EnrichmentCollector{
+		statusPaths: statusPaths,
+		urlTemplate: urlTemplate,
+		labels:      labels,
+		cacheTTL:    cacheTTL,
+		interval:    interval,
+		client:      &http.Client{Timeout: timeout},
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_enrichment_info"),
+			"Labels of a connected client, as returned by the enrichment service.",
+			append([]string{"common_name"}, labels...), nil),
+		clients: map[string]enrichedClient{},
+	}, nil
+}
+
+// Escapes a common name for use in either the path or the query of a URL.
+// Spaces are escaped as %20, as + only means a space within queries.
+func escapeEnrichmentCommonName(commonName string) string {
+	return strings.ReplaceAll(url.QueryEscape(commonName), "+", "%20")
+}
+
+func (c *EnrichmentCollector) lookup(commonName string) ([]string, error) {
+	resp, err := c.client.Get(fmt.Sprintf(c.urlTemplate, escapeEnrichmentCommonName(commonName)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var values map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		return nil, err
+	}
+	labels := make([]string, len(c.labels))
+	for i, label := range c.labels {
+		if value, ok := values[label]; ok && value != nil {
+			labels[i] = fmt.Sprint(value)
+		}
+	}
+	return labels, nil
+}
+
+// Looks up the common names that are connected and aren't cached. Common
+// names that fail to be looked up are omitted until they are retried.
+func (c *EnrichmentCollector) refresh() {
+	commonNames := map[string]bool{}
+	for _, statusPath := range expandStatusPaths(c.statusPaths()) {
+		clients, err := readServerClientList(statusPath)
+		if err != nil {
+			slog.Error("Failed to read clients", "status_path", statusPath, "err", err)
+			continue
+		}
+		for _, client := range clients {
+			commonNames[client["Common Name"]] = true
+		}
+	}
+
+	c.mutex.Lock()
+	cached := c.clients
+	c.mutex.Unlock()
+	now := time.Now()
+	clients := map[string]enrichedClient{}
+	var wg sync.WaitGroup
+	var clientsMutex sync.Mutex
+	semaphore := make(chan struct{}, enrichmentConcurrency)
+	for commonName := range commonNames {
+		if client, ok := cached[commonName]; ok && now.Before(client.expires) {
+			clients[commonName] = client
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(commonName string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			client := enrichedClient{expires: now.Add(c.cacheTTL)}
+			labels, err := c.lookup(commonName)
+			if err != nil {
+				slog.Error("Failed to look up common name using enrichment service", "common_name", commonName, "err", err)
+				client = enrichedClient{failed: true, expires: now.Add(enrichmentFailureTTL)}
+			}
+			client.labels = labels
+			clientsMutex.Lock()
+			clients[commonName] = client
+			clientsMutex.Unlock()
+		}(commonName)
+	}
+	wg.Wait()
+	// Clients that are no longer connected are dropped from the cache.
+	c.mutex.Lock()
+	c.clients = clients
+	c.mutex.Unlock()
+}
+
+// Run refreshes the connected common names at the configured interval. It
+// never returns.
+func (c *EnrichmentCollector) Run() {
+	for {
+		c.refresh()
+		time.Sleep(c.interval)
+	}
+}
+
+func (c *EnrichmentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.infoDesc
+}
+
+func (c *EnrichmentCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for commonName, client := range c.clients {
+		// Common names unknown to the service have no labels.
+		if client.failed || client.labels == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.infoDesc,
+			prometheus.GaugeValue,
+			1.0,
+			append([]string{commonName}, client.labels...)...)
+	}
+}
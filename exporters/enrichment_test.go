@@ -0,0 +1,18 @@
+package exporters
+
+import (
+	"testing"
+)
+
+func TestEscapeEnrichmentCommonName(t *testing.T) {
+	for commonName, want := range map[string]string{
+		"alice":              "alice",
+		"John Doe":           "John%20Doe",
+		"a+b&c=d/e?f#g":      "a%2Bb%26c%3Dd%2Fe%3Ff%23g",
+		"laptop.example.com": "laptop.example.com",
+	} {
+		if got := escapeEnrichmentCommonName(commonName); got != want {
+			t.Errorf("escapeEnrichmentCommonName(%q) = %q, want %q", commonName, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package exporters
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics of remote exporters that are summed into fleet-wide
+// aggregates, indexed by the name of the metric on the remote exporter.
+var federationAggregates = map[string]struct {
+	name string
+	help string
+}{
+	"openvpn_server_connected_clients": {
+		name: "server_connected_clients",
+		help: "Number of clients connected to all federated OpenVPN servers.",
+	},
+	"openvpn_server_client_received_bytes_total": {
+		name: "server_client_received_bytes",
+		help: "Amount of data received by all federated OpenVPN servers over current connections, in bytes.",
+	},
+	"openvpn_server_client_sent_bytes_total": {
+		name: "server_client_sent_bytes",
+		help: "Amount of data sent by all federated OpenVPN servers over current connections, in bytes.",
+	},
+}
+
+// FederationCollector scrapes the metrics endpoints of other instances
+// of this exporter and re-exposes their OpenVPN metrics with an
+// additional source label, together with fleet-wide aggregates. Targets
+// are scraped concurrently, giving up on the ones that haven't responded
+// once the timeout has passed, which should be shorter than the scrape
+// timeout of Prometheus.
+type FederationCollector struct {
+	targets        []string
+	timeout        time.Duration
+	client         *http.Client
+	targetUpDesc   *prometheus.Desc
+	aggregateDescs map[string]*prometheus.Desc
+}
+
+func NewFederationCollector(targets []string, timeout time.Duration) (*FederationCollector, error) {
+	for _, target := range targets {
+		if _, err := url.Parse(target); err != nil {
+			return nil, err
+		}
+	}
+
+	aggregateDescs := map[string]*prometheus.Desc{}
+	for metric, aggregate := range federationAggregates {
+		aggregateDescs[metric] = prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "federation", aggregate.name),
+			aggregate.help,
+			nil, nil)
+	}
+
+	return &FederationCollector{
+		targets: targets,
+		timeout: timeout,
+		client:  &http.Client{},
+		targetUpDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "federation", "target_up"),
+			"Whether scraping the federated exporter was successful.",
+			[]string{"source"}, nil),
+		aggregateDescs: aggregateDescs,
+	}, nil
+}
+
+// Returns the value to use for the source label of a target, which is
+// the host and port of its URL.
+func federationSource(target string) string {
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return target
+}
+
+// Fetches and parses the metrics exposed by a federated exporter.
+func (c *FederationCollector) scrapeTarget(ctx context.Context, target string) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.FmtText))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// Re-exposes a single metric of a federated exporter, adding the source
+// label. Only counters, gauges and untyped metrics are supported.
+func federatedMetric(family *dto.MetricFamily, metric *dto.Metric, source string) (prometheus.Metric, float64, error) {
+	var valueType prometheus.ValueType
+	var value float64
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		valueType, value = prometheus.CounterValue, metric.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		valueType, value = prometheus.GaugeValue, metric.GetGauge().GetValue()
+	case dto.MetricType_UNTYPED:
+		valueType, value = prometheus.UntypedValue, metric.GetUntyped().GetValue()
+	default:
+		return nil, 0, fmt.Errorf("unsupported metric type %s for %s", family.GetType(), family.GetName())
+	}
+
+	labels := map[string]string{}
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	labels["source"] = source
+	var labelNames []string
+	for name := range labels {
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+	var labelValues []string
+	for _, name := range labelNames {
+		labelValues = append(labelValues, labels[name])
+	}
+
+	m, err := prometheus.NewConstMetric(
+		prometheus.NewDesc(family.GetName(), family.GetHelp(), labelNames, nil),
+		valueType,
+		value,
+		labelValues...)
+	return m, value, err
+}
+
+func (c *FederationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.targetUpDesc
+	for _, desc := range c.aggregateDescs {
+		ch <- desc
+	}
+}
+
+func (c *FederationCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	results := make([]map[string]*dto.MetricFamily, len(c.targets))
+	errs := make([]error, len(c.targets))
+	var wg sync.WaitGroup
+	for i, target := range c.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = c.scrapeTarget(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	aggregates := map[string]float64{}
+	for i, target := range c.targets {
+		source := federationSource(target)
+		families, err := results[i], errs[i]
+		if err != nil {
+			slog.Error("Failed to scrape federated exporter", "target", target, "err", err)
+			ch <- prometheus.MustNewConstMetric(
+				c.targetUpDesc,
+				prometheus.GaugeValue,
+				0.0,
+				source)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.targetUpDesc,
+			prometheus.GaugeValue,
+			1.0,
+			source)
+
+		for name, family := range families {
+			// Aggregates of a federated exporter would collide
+			// with the ones computed here.
+			if !strings.HasPrefix(name, "openvpn_") || strings.HasPrefix(name, "openvpn_federation_") {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				m, value, err := federatedMetric(family, metric, source)
+				if err != nil {
+					slog.Warn("Failed to federate metric", "target", target, "err", err)
+					continue
+				}
+				ch <- m
+				if _, ok := c.aggregateDescs[name]; ok {
+					aggregates[name] += value
+				}
+			}
+		}
+	}
+
+	for name, desc := range c.aggregateDescs {
+		ch <- prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			aggregates[name])
+	}
+}
@@ -0,0 +1,112 @@
+package exporters
+
+import (
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// GeoIPCollector determines the country of the real address of clients
+// connected to OpenVPN servers, as found in a MaxMind GeoIP2 or GeoLite2
+// Country or City database. Clients are counted per country, which allows
+// monitoring usage per region. When exporting metrics for individuals,
+// the country of every connection is exported as well, e.g. to spot
+// impossible travel of a common name between consecutive connections.
+type GeoIPCollector struct {
+	database             *maxminddb.Reader
+	clientsByCountryDesc *prometheus.Desc
+	clientCountryDesc    *prometheus.Desc
+	metadata             *ClientMetadata
+}
+
+func NewGeoIPCollector(databasePath string, ignoreIndividuals bool, metadata *ClientMetadata) (*GeoIPCollector, error) {
+	database, err := maxminddb.Open(databasePath)
+	if err != nil {
+		return nil, err
+	}
+	// Countries of connections are only exported when exporting metrics
+	// for individuals, like their session identifiers.
+	var clientCountryDesc *prometheus.Desc
+	if !ignoreIndividuals {
+		clientCountryDesc = prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_country_info"),
+			"Country of the real address of a connection on the VPN server.",
+			append([]string{"status_path", "common_name", "session_id", "country"}, metadata.labelNames()...), nil)
+	}
+	return &GeoIPCollector{
+		database: database,
+		clientsByCountryDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "clients_by_country"),
+			"Number of connected clients per country of their real address.",
+			[]string{"status_path", "country"}, nil),
+		clientCountryDesc: clientCountryDesc,
+		metadata:          metadata,
+	}, nil
+}
+
+// Close closes the database.
+func (c *GeoIPCollector) Close() error {
+	return c.database.Close()
+}
+
+func (c *GeoIPCollector) Name() string {
+	return "geoip"
+}
+
+func (c *GeoIPCollector) appliesTo(file *StatusFile) bool {
+	return file.Server
+}
+
+func (c *GeoIPCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.clientsByCountryDesc
+	if c.clientCountryDesc != nil {
+		ch <- c.clientCountryDesc
+	}
+}
+
+func (c *GeoIPCollector) collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error {
+	clients, err := file.rows("CLIENT_LIST")
+	if err != nil {
+		return err
+	}
+	clientsByCountry := map[string]int{}
+	sessionIDs := map[string]bool{}
+	for _, client := range clients {
+		sessionID := SessionID(client["Common Name"], client["Connected Since (time_t)"], client["Real Address"])
+		if sessionIDs[sessionID] {
+			continue
+		}
+		sessionIDs[sessionID] = true
+
+		// Addresses that aren't found, such as private addresses,
+		// are counted with an empty country label.
+		var record countryRecord
+		if ip := addressIP(client["Real Address"]); ip != nil {
+			if err := c.database.Lookup(ip, &record); err != nil {
+				return err
+			}
+		}
+		clientsByCountry[record.Country.ISOCode]++
+		if c.clientCountryDesc != nil {
+			ch <- prometheus.MustNewConstMetric(
+				c.clientCountryDesc,
+				prometheus.GaugeValue,
+				1.0,
+				append([]string{statusPath, client["Common Name"], sessionID, record.Country.ISOCode}, c.metadata.labelValues(client["Common Name"])...)...)
+		}
+	}
+	for country, clients := range clientsByCountry {
+		ch <- prometheus.MustNewConstMetric(
+			c.clientsByCountryDesc,
+			prometheus.GaugeValue,
+			float64(clients),
+			statusPath,
+			country)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+)
+
+// GlobalStatsCollector converts the GLOBAL_STATS entries of OpenVPN server
+// status files into Prometheus metrics. Statistics without a dedicated
+// metric, such as those added by newer versions of OpenVPN, are exported
+// by name as openvpn_server_global_stats, as long as they are numeric.
+// The load statistics of servers read through their management interface
+// are exported as well.
+type GlobalStatsCollector struct {
+	statsDescs     map[string]*prometheus.Desc
+	otherStatsDesc *prometheus.Desc
+	clientsDesc    *prometheus.Desc
+	bytesInDesc    *prometheus.Desc
+	bytesOutDesc   *prometheus.Desc
+}
+
+func NewGlobalStatsCollector() *GlobalStatsCollector {
+	return &GlobalStatsCollector{
+		statsDescs: map[string]*prometheus.Desc{
+			"Max bcast/mcast queue length": prometheus.NewDesc(
+				prometheus.BuildFQName("openvpn", "server", "max_bcast_mcast_queue_length"),
+				"Maximum length of the broadcast/multicast queue.",
+				[]string{"status_path"}, nil),
+		},
+		otherStatsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "global_stats"),
+			"Value of a global statistic of the server without a dedicated metric.",
+			[]string{"status_path", "name"}, nil),
+		clientsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "clients"),
+			"Number of clients connected to the server, as reported by its management interface.",
+			[]string{"status_path"}, nil),
+		bytesInDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "bytes_in_total"),
+			"Amount of data received by the server since it started, as reported by its management interface, in bytes.",
+			[]string{"status_path"}, nil),
+		bytesOutDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "bytes_out_total"),
+			"Amount of data sent by the server since it started, as reported by its management interface, in bytes.",
+			[]string{"status_path"}, nil),
+	}
+}
+
+func (c *GlobalStatsCollector) Name() string {
+	return "global_stats"
+}
+
+func (c *GlobalStatsCollector) appliesTo(file *StatusFile) bool {
+	return file.Server
+}
+
+func (c *GlobalStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.statsDescs {
+		ch <- desc
+	}
+	ch <- c.otherStatsDesc
+	ch <- c.clientsDesc
+	ch <- c.bytesInDesc
+	ch <- c.bytesOutDesc
+}
+
+func (c *GlobalStatsCollector) collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error {
+	for key, stat := range file.Stats {
+		desc, ok := c.statsDescs[key]
+		if !ok {
+			value, err := strconv.ParseFloat(stat, 64)
+			if err != nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.otherStatsDesc,
+				prometheus.GaugeValue,
+				value,
+				statusPath,
+				key)
+			continue
+		}
+		value, err := strconv.ParseFloat(stat, 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			value,
+			statusPath)
+	}
+
+	rows, err := file.rows("LOAD_STATS")
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		export := func(column string, desc *prometheus.Desc, valueType prometheus.ValueType) error {
+			value, err := strconv.ParseFloat(row[column], 64)
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(
+				desc,
+				valueType,
+				value,
+				statusPath)
+			return nil
+		}
+		if err := export("Clients", c.clientsDesc, prometheus.GaugeValue); err != nil {
+			return err
+		}
+		if err := export("Bytes In", c.bytesInDesc, prometheus.CounterValue); err != nil {
+			return err
+		}
+		if err := export("Bytes Out", c.bytesOutDesc, prometheus.CounterValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
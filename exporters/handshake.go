@@ -0,0 +1,162 @@
+package exporters
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Line logged by OpenVPN once a connection has been fully established.
+const openvpnInitializationCompleted = "Initialization Sequence Completed"
+
+type handshakeResult struct {
+	success  bool
+	duration time.Duration
+	time     time.Time
+}
+
+// HandshakeProbeCollector periodically establishes a connection to an
+// OpenVPN server using a dedicated monitoring profile, giving end-to-end
+// insight in whether clients are able to connect. The openvpn binary is
+// started without a TUN/TAP device, so no network configuration is
+// changed on the host running the exporter.
+type HandshakeProbeCollector struct {
+	openvpnBinary string
+	profiles      []string
+	interval      time.Duration
+	timeout       time.Duration
+
+	successDesc   *prometheus.Desc
+	durationDesc  *prometheus.Desc
+	timestampDesc *prometheus.Desc
+
+	mutex   sync.Mutex
+	results map[string]handshakeResult
+}
+
+func NewHandshakeProbeCollector(openvpnBinary string, profiles []string, interval time.Duration, timeout time.Duration) *HandshakeProbeCollector {
+	return &HandshakeProbeCollector{
+		openvpnBinary: openvpnBinary,
+		profiles:      profiles,
+		interval:      interval,
+		timeout:       timeout,
+		successDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "probe", "handshake_success"),
+			"Whether the last connection attempt using the profile succeeded.",
+			[]string{"profile"}, nil),
+		durationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "probe", "handshake_duration_seconds"),
+			"Time it took to establish a connection using the profile, in seconds.",
+			[]string{"profile"}, nil),
+		timestampDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "probe", "handshake_timestamp_seconds"),
+			"UNIX timestamp at which the last connection attempt using the profile was started.",
+			[]string{"profile"}, nil),
+		results: map[string]handshakeResult{},
+	}
+}
+
+// Runs openvpn with the profile until it reports that the connection has
+// been established, or until the timeout expires.
+func (c *HandshakeProbeCollector) handshake(profile string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.openvpnBinary,
+		"--config", profile,
+		"--dev", "null",
+		"--ifconfig-noexec",
+		"--route-noexec",
+		"--verb", "3")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	completed := false
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), openvpnInitializationCompleted) {
+			completed = true
+			break
+		}
+	}
+	cancel()
+	cmd.Wait()
+
+	if !completed {
+		if ctx.Err() == context.DeadlineExceeded {
+			return errors.New("timed out waiting for connection to be established")
+		}
+		return errors.New("openvpn exited before connection was established")
+	}
+	return nil
+}
+
+func (c *HandshakeProbeCollector) probe(profile string) {
+	start := time.Now()
+	err := c.handshake(profile)
+	if err != nil {
+		slog.Warn("Handshake probe failed", "profile", profile, "err", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.results[profile] = handshakeResult{
+		success:  err == nil,
+		duration: time.Since(start),
+		time:     start,
+	}
+}
+
+// Run probes all profiles at the configured interval. It never returns.
+func (c *HandshakeProbeCollector) Run() {
+	for {
+		for _, profile := range c.profiles {
+			c.probe(profile)
+		}
+		time.Sleep(c.interval)
+	}
+}
+
+func (c *HandshakeProbeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.successDesc
+	ch <- c.durationDesc
+	ch <- c.timestampDesc
+}
+
+func (c *HandshakeProbeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for profile, result := range c.results {
+		success := 0.0
+		if result.success {
+			success = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.successDesc,
+			prometheus.GaugeValue,
+			success,
+			profile)
+		ch <- prometheus.MustNewConstMetric(
+			c.durationDesc,
+			prometheus.GaugeValue,
+			result.duration.Seconds(),
+			profile)
+		ch <- prometheus.MustNewConstMetric(
+			c.timestampDesc,
+			prometheus.GaugeValue,
+			float64(result.time.Unix()),
+			profile)
+	}
+}
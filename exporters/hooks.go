@@ -0,0 +1,492 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Number of distinct instance names accepted by a ClientHookReceiver that
+// isn't given a list of them, limiting the number of series that clients
+// of the receiver can create.
+const maxHookInstanceNames = 64
+
+// Number of events queued for delivery to the webhook, beyond which
+// events are dropped rather than delaying the scripts.
+const hookWebhookQueueLength = 1024
+
+// Number of connected clients whose peer info is kept, beyond which the
+// peer info of clients connecting is ignored, so that a script that never
+// reports disconnections can't exhaust memory.
+const maxHookPeers = 100000
+
+// Platforms reported by OpenVPN clients as IV_PLAT. Others are exported
+// as other, as clients may report any value.
+var peerPlatforms = []string{"android", "freebsd", "ios", "linux", "mac", "netbsd", "openbsd", "solaris", "win"}
+
+// Matches the release of OpenVPN reported by clients as IV_VER, e.g. 2.6.8
+// of 2.6.8 or 2.6_git.
+var peerVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)?`)
+
+// A connected client, identified by the instance it's connected to, its
+// common name and its real address.
+type hookSession struct {
+	instanceName string
+	commonName   string
+	realAddress  string
+}
+
+// Peer info of a connected client, as sent by its client-connect script.
+type hookPeer struct {
+	version  string
+	platform string
+}
+
+// Returns the release of OpenVPN reported by a client, or unknown.
+func peerVersion(version string) string {
+	if release := peerVersionPattern.FindString(version); release != "" {
+		return release
+	}
+	return "unknown"
+}
+
+// Returns the platform reported by a client, other or unknown.
+func peerPlatform(platform string) string {
+	if platform == "" {
+		return "unknown"
+	} else if !contains(peerPlatforms, platform) {
+		return "other"
+	}
+	return platform
+}
+
+// A client-connect or client-disconnect event, as appended to the sessions
+// file and sent to the webhook and syslog. Traffic and duration are only
+// known when clients disconnect.
+type hookEvent struct {
+	Time            time.Time `json:"time"`
+	ScriptType      string    `json:"script_type"`
+	InstanceName    string    `json:"instance_name,omitempty"`
+	CommonName      string    `json:"common_name"`
+	Username        string    `json:"username,omitempty"`
+	RealAddress     string    `json:"real_address,omitempty"`
+	VirtualAddress  string    `json:"virtual_address,omitempty"`
+	ConnectedSince  int64     `json:"connected_since,omitempty"`
+	BytesReceived   *float64  `json:"bytes_received,omitempty"`
+	BytesSent       *float64  `json:"bytes_sent,omitempty"`
+	DurationSeconds *float64  `json:"duration_seconds,omitempty"`
+}
+
+// ClientHookReceiver accepts events posted by OpenVPN's client-connect
+// and client-disconnect scripts and turns them into exact counters. The
+// scripts are expected to forward their environment variables as form
+// values (see contrib/openvpn-exporter-hook.sh). Ended sessions may be
+// recorded in a file, and all events may be forwarded to a webhook and to
+// syslog.
+type ClientHookReceiver struct {
+	token         string
+	instanceNames []string
+	privacy       *RealAddressPrivacy
+
+	// Instance names seen so far, if not given.
+	seenMutex sync.Mutex
+	seen      map[string]bool
+
+	sessionsMutex sync.Mutex
+	sessionsFile  *os.File
+
+	// Peer info of the clients connected since the exporter started.
+	peersMutex sync.Mutex
+	peers      map[hookSession]hookPeer
+	peersDesc  *prometheus.Desc
+
+	webhookURL     string
+	webhookTimeout time.Duration
+	webhookEvents  chan hookEvent
+
+	syslog *SyslogForwarder
+
+	connects        *prometheus.CounterVec
+	disconnects     *prometheus.CounterVec
+	receivedBytes   *prometheus.CounterVec
+	sentBytes       *prometheus.CounterVec
+	durationSeconds *prometheus.CounterVec
+	// Distributions of the traffic and duration of individual sessions,
+	// which status files can't provide, as their last values before
+	// disconnecting are never written.
+	sessionReceivedBytes   *prometheus.HistogramVec
+	sessionSentBytes       *prometheus.HistogramVec
+	sessionDurationSeconds *prometheus.HistogramVec
+	webhookFailures        prometheus.Counter
+}
+
+// NewClientHookReceiver creates a receiver requiring requests to carry the
+// token as a bearer token, unless it's empty, e.g. when served on a unix
+// socket only. Events may only carry the given instance names. If none are
+// given, any valid instance name is accepted, up to 64 of them. Real
+// addresses are recorded according to the privacy setting.
+func NewClientHookReceiver(token string, instanceNames []string, privacy *RealAddressPrivacy) *ClientHookReceiver {
+	return &ClientHookReceiver{
+		token:         token,
+		instanceNames: instanceNames,
+		privacy:       privacy,
+		seen:          map[string]bool{},
+		peers:         map[hookSession]hookPeer{},
+		peersDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "connected_clients_by_version"),
+			"Number of connected clients by the release of OpenVPN and the platform they reported (IV_VER and IV_PLAT) when connecting, as received from client-connect scripts.",
+			[]string{"instance_name", "version", "platform"}, nil),
+		connects: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "client_connects_total",
+				Help:      "Number of client-connect events received from OpenVPN.",
+			},
+			[]string{"instance_name"}),
+		disconnects: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "client_disconnects_total",
+				Help:      "Number of client-disconnect events received from OpenVPN.",
+			},
+			[]string{"instance_name"}),
+		receivedBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "disconnected_client_received_bytes_total",
+				Help:      "Amount of data received from clients over sessions that have ended, in bytes.",
+			},
+			[]string{"instance_name"}),
+		sentBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "disconnected_client_sent_bytes_total",
+				Help:      "Amount of data sent to clients over sessions that have ended, in bytes.",
+			},
+			[]string{"instance_name"}),
+		durationSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "disconnected_client_session_duration_seconds_total",
+				Help:      "Total duration of client sessions that have ended, in seconds.",
+			},
+			[]string{"instance_name"}),
+		sessionReceivedBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "client_session_received_bytes",
+				Help:      "Amount of data received from clients per session, in bytes, as reported when they disconnect.",
+				Buckets:   prometheus.ExponentialBuckets(1024, 8, 9),
+			},
+			[]string{"instance_name"}),
+		sessionSentBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "client_session_sent_bytes",
+				Help:      "Amount of data sent to clients per session, in bytes, as reported when they disconnect.",
+				Buckets:   prometheus.ExponentialBuckets(1024, 8, 9),
+			},
+			[]string{"instance_name"}),
+		sessionDurationSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "client_session_duration_seconds",
+				Help:      "Duration of client sessions, in seconds, as reported when they disconnect.",
+				Buckets:   []float64{60, 300, 900, 1800, 3600, 3 * 3600, 8 * 3600, 24 * 3600, 7 * 24 * 3600},
+			},
+			[]string{"instance_name"}),
+		webhookFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "server",
+				Name:      "hook_webhook_failures_total",
+				Help:      "Number of script events that couldn't be delivered to the webhook, including those dropped as too many were queued.",
+			}),
+	}
+}
+
+// SetSessionsFile makes the receiver append a JSON record of every ended
+// session to the file, one per line, as reported by client-disconnect
+// scripts.
+func (h *ClientHookReceiver) SetSessionsFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	h.sessionsFile = file
+	return nil
+}
+
+// SetWebhook makes the receiver POST every event to the URL as JSON, giving
+// up on a request after the timeout. Events are delivered in the
+// background, one at a time, so that the scripts aren't delayed.
+func (h *ClientHookReceiver) SetWebhook(url string, timeout time.Duration) {
+	h.webhookURL = url
+	h.webhookTimeout = timeout
+	h.webhookEvents = make(chan hookEvent, hookWebhookQueueLength)
+	go h.deliver()
+}
+
+// SetSyslog makes the receiver forward every event to syslog.
+func (h *ClientHookReceiver) SetSyslog(forwarder *SyslogForwarder) {
+	h.syslog = forwarder
+}
+
+// Delivers queued events to the webhook. It never returns.
+func (h *ClientHookReceiver) deliver() {
+	client := &http.Client{Timeout: h.webhookTimeout}
+	for event := range h.webhookEvents {
+		body, err := json.Marshal(event)
+		if err != nil {
+			panic(err)
+		}
+		response, err := client.Post(h.webhookURL, "application/json", bytes.NewReader(body))
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode/100 != 2 {
+				err = fmt.Errorf("unexpected status %s", response.Status)
+			}
+		}
+		if err != nil {
+			slog.Error("Failed to deliver script event to webhook", "url", h.webhookURL, "err", err)
+			h.webhookFailures.Inc()
+		}
+	}
+}
+
+// Returns whether events may carry the instance name.
+func (h *ClientHookReceiver) acceptInstanceName(name string) bool {
+	if name == "" {
+		return true
+	}
+	if len(h.instanceNames) > 0 {
+		return contains(h.instanceNames, name)
+	}
+	if !isInstanceName(name) {
+		return false
+	}
+	h.seenMutex.Lock()
+	defer h.seenMutex.Unlock()
+	if !h.seen[name] && len(h.seen) >= maxHookInstanceNames {
+		return false
+	}
+	h.seen[name] = true
+	return true
+}
+
+// Parses an event posted by a client-connect or client-disconnect
+// script. The script_type field is set by OpenVPN itself, while the
+// instance_name field may be chosen by the script to distinguish multiple
+// OpenVPN daemons.
+func (h *ClientHookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" && !checkBearerToken(w, r, h.token) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests are accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	event := hookEvent{
+		Time:           time.Now(),
+		ScriptType:     r.PostForm.Get("script_type"),
+		InstanceName:   r.PostForm.Get("instance_name"),
+		CommonName:     r.PostForm.Get("common_name"),
+		Username:       r.PostForm.Get("username"),
+		VirtualAddress: r.PostForm.Get("ifconfig_pool_remote_ip"),
+	}
+	// Scripts of earlier versions sent the instance name as instance.
+	if event.InstanceName == "" {
+		event.InstanceName = r.PostForm.Get("instance")
+	}
+	if !h.acceptInstanceName(event.InstanceName) {
+		http.Error(w, fmt.Sprintf("Unknown instance_name: %q", event.InstanceName), http.StatusBadRequest)
+		return
+	}
+	ip := r.PostForm.Get("trusted_ip")
+	if ip == "" {
+		ip = r.PostForm.Get("trusted_ip6")
+	}
+	var realAddress string
+	if ip != "" {
+		// Written like the real addresses of the status file, so that
+		// both refer to the same session.
+		realAddress = normalizeRealAddress(net.JoinHostPort(ip, r.PostForm.Get("trusted_port")))
+	}
+	if realAddress != "" && h.privacy.exported() {
+		event.RealAddress = h.privacy.value(realAddress)
+	}
+	session := hookSession{instanceName: event.InstanceName, commonName: event.CommonName, realAddress: realAddress}
+	if connected, err := strconv.ParseInt(r.PostForm.Get("time_unix"), 10, 64); err == nil {
+		event.ConnectedSince = connected
+	}
+
+	instanceName := event.InstanceName
+	switch event.ScriptType {
+	case "client-connect":
+		h.connects.WithLabelValues(instanceName).Inc()
+		h.peersMutex.Lock()
+		if _, ok := h.peers[session]; ok || len(h.peers) < maxHookPeers {
+			h.peers[session] = hookPeer{
+				version:  peerVersion(r.PostForm.Get("iv_ver")),
+				platform: peerPlatform(r.PostForm.Get("iv_plat")),
+			}
+		}
+		h.peersMutex.Unlock()
+	case "client-disconnect":
+		// OpenVPN reports traffic from the server's point of view.
+		values := map[string]*float64{}
+		for _, key := range []string{"bytes_received", "bytes_sent", "time_duration"} {
+			value, err := strconv.ParseFloat(r.PostForm.Get(key), 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid value for %s: %q", key, r.PostForm.Get(key)), http.StatusBadRequest)
+				return
+			}
+			values[key] = &value
+		}
+		event.BytesReceived = values["bytes_received"]
+		event.BytesSent = values["bytes_sent"]
+		event.DurationSeconds = values["time_duration"]
+		h.disconnects.WithLabelValues(instanceName).Inc()
+		h.receivedBytes.WithLabelValues(instanceName).Add(*event.BytesReceived)
+		h.sentBytes.WithLabelValues(instanceName).Add(*event.BytesSent)
+		h.durationSeconds.WithLabelValues(instanceName).Add(*event.DurationSeconds)
+		h.sessionReceivedBytes.WithLabelValues(instanceName).Observe(*event.BytesReceived)
+		h.sessionSentBytes.WithLabelValues(instanceName).Observe(*event.BytesSent)
+		h.sessionDurationSeconds.WithLabelValues(instanceName).Observe(*event.DurationSeconds)
+		h.recordSession(event)
+		h.peersMutex.Lock()
+		delete(h.peers, session)
+		h.peersMutex.Unlock()
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported script_type: %q", event.ScriptType), http.StatusBadRequest)
+		return
+	}
+	if h.webhookEvents != nil {
+		select {
+		case h.webhookEvents <- event:
+		default:
+			slog.Error("Dropping script event, as too many are queued for the webhook", "url", h.webhookURL)
+			h.webhookFailures.Inc()
+		}
+	}
+	if h.syslog != nil {
+		h.syslog.forward(syslogMessage{
+			time:     event.Time,
+			severity: syslogNotice,
+			msgID:    event.ScriptType,
+			body:     event,
+		})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Appends the record of an ended session to the sessions file.
+func (h *ClientHookReceiver) recordSession(event hookEvent) {
+	if h.sessionsFile == nil {
+		return
+	}
+	record, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+	h.sessionsMutex.Lock()
+	defer h.sessionsMutex.Unlock()
+	if _, err := h.sessionsFile.Write(append(record, '\n')); err != nil {
+		slog.Error("Failed to record session", "path", h.sessionsFile.Name(), "err", err)
+	}
+}
+
+// Renames the sessions file by appending the time to its name, and starts
+// a new one, so that the renamed file is no longer written to. Returns the
+// path of the renamed file, or an empty string if no sessions were recorded
+// in it.
+func (h *ClientHookReceiver) rotateSessionsFile(now time.Time) (string, error) {
+	h.sessionsMutex.Lock()
+	defer h.sessionsMutex.Unlock()
+	path := h.sessionsFile.Name()
+	info, err := h.sessionsFile.Stat()
+	if err != nil {
+		return "", err
+	} else if info.Size() == 0 {
+		return "", nil
+	}
+	rotated := path + "-" + now.UTC().Format(sessionsFileTimeFormat)
+	if err := os.Rename(path, rotated); err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		// Keep writing to the file rather than losing sessions.
+		os.Rename(rotated, path)
+		return "", err
+	}
+	h.sessionsFile.Close()
+	h.sessionsFile = file
+	return rotated, nil
+}
+
+func (h *ClientHookReceiver) Describe(ch chan<- *prometheus.Desc) {
+	h.connects.Describe(ch)
+	h.disconnects.Describe(ch)
+	h.receivedBytes.Describe(ch)
+	h.sentBytes.Describe(ch)
+	h.durationSeconds.Describe(ch)
+	h.sessionReceivedBytes.Describe(ch)
+	h.sessionSentBytes.Describe(ch)
+	h.sessionDurationSeconds.Describe(ch)
+	ch <- h.peersDesc
+	if h.webhookEvents != nil {
+		h.webhookFailures.Describe(ch)
+	}
+}
+
+func (h *ClientHookReceiver) Collect(ch chan<- prometheus.Metric) {
+	h.connects.Collect(ch)
+	h.disconnects.Collect(ch)
+	h.receivedBytes.Collect(ch)
+	h.sentBytes.Collect(ch)
+	h.durationSeconds.Collect(ch)
+	h.sessionReceivedBytes.Collect(ch)
+	h.sessionSentBytes.Collect(ch)
+	h.sessionDurationSeconds.Collect(ch)
+	h.peersMutex.Lock()
+	counts := map[[3]string]int{}
+	for session, peer := range h.peers {
+		counts[[3]string{session.instanceName, peer.version, peer.platform}]++
+	}
+	h.peersMutex.Unlock()
+	for labels, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			h.peersDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			labels[0],
+			labels[1],
+			labels[2])
+	}
+	if h.webhookEvents != nil {
+		h.webhookFailures.Collect(ch)
+	}
+}
@@ -0,0 +1,67 @@
+package exporters
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClientHookReceiverRealAddress(t *testing.T) {
+	privacy, err := NewRealAddressPrivacy("keep", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewClientHookReceiver("", nil, privacy)
+	sessionsFile := filepath.Join(t.TempDir(), "sessions.jsonl")
+	if err := h.SetSessionsFile(sessionsFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, form := range []url.Values{
+		{"trusted_ip": {"192.0.2.1"}},
+		{"trusted_ip6": {"2001:DB8::1"}},
+		// Parses as a different IPv6 address when joined with the
+		// port without brackets.
+		{"trusted_ip6": {"2001:0:0:1::1"}},
+	} {
+		form.Set("instance_name", "server")
+		form.Set("script_type", "client-disconnect")
+		form.Set("common_name", "alice")
+		form.Set("trusted_port", "1194")
+		form.Set("bytes_received", "0")
+		form.Set("bytes_sent", "0")
+		form.Set("time_duration", "0")
+		req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("got status code %d: %s", w.Code, w.Body)
+		}
+	}
+
+	data, err := os.ReadFile(sessionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Written like the real addresses of status files.
+	want := []string{"192.0.2.1:1194", "2001:db8::1:1194", "2001:0:0:1::1:1194"}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d session records, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		var event hookEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.RealAddress != want[i] {
+			t.Errorf("got real address %q, want %q", event.RealAddress, want[i])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package exporters
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type idleSession struct {
+	Bytes   float64   `json:"bytes"`
+	Changed time.Time `json:"changed"`
+}
+
+// Keeps track of when the byte counters of each connection last
+// increased, across collections. Connections kept open by keepalives
+// without carrying any traffic can be detected this way.
+type idleTracker struct {
+	mutex    sync.Mutex
+	sessions map[string]map[string]idleSession
+}
+
+func newIdleTracker() *idleTracker {
+	return &idleTracker{
+		sessions: map[string]map[string]idleSession{},
+	}
+}
+
+// Returns how long the byte counters of a connection haven't increased.
+// Connections are considered active when they are first seen.
+func (t *idleTracker) observe(statusPath string, sessionID string, bytes float64, now time.Time) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	sessions := t.sessions[statusPath]
+	if sessions == nil {
+		sessions = map[string]idleSession{}
+		t.sessions[statusPath] = sessions
+	}
+	session, ok := sessions[sessionID]
+	if !ok || bytes != session.Bytes {
+		session = idleSession{Bytes: bytes, Changed: now}
+		sessions[sessionID] = session
+	}
+	return now.Sub(session.Changed)
+}
+
+// Forgets connections of a status file that are no longer listed.
+func (t *idleTracker) prune(statusPath string, sessionIDs map[string]bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for sessionID := range t.sessions[statusPath] {
+		if !sessionIDs[sessionID] {
+			delete(t.sessions[statusPath], sessionID)
+		}
+	}
+}
+
+func (t *idleTracker) saveState() (json.RawMessage, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return json.Marshal(t.sessions)
+}
+
+func (t *idleTracker) loadState(data json.RawMessage) error {
+	sessions := map[string]map[string]idleSession{}
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sessions = sessions
+	return nil
+}
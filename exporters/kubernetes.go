@@ -0,0 +1,124 @@
+package exporters
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Location of the service account credentials mounted into pods.
+const kubernetesServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Channels multiplexed over a websocket connection using the
+// v4.channel.k8s.io protocol, identified by the first byte of a message.
+const (
+	kubernetesStdoutChannel = 1
+	kubernetesStderrChannel = 2
+	kubernetesErrorChannel  = 3
+)
+
+// Parses a status path of the form k8s://<namespace>/<pod>:<path>,
+// optionally followed by ?container=<container>.
+func parseKubernetesPath(statusPath string) (string, string, string, string, error) {
+	u, err := url.Parse(statusPath)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), ":", 2)
+	if u.Host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", "", fmt.Errorf("status path %q should be of the form k8s://<namespace>/<pod>:<path>", statusPath)
+	}
+	return u.Host, parts[0], u.Query().Get("container"), parts[1], nil
+}
+
+// Opens a file inside a pod by running cat through the Kubernetes exec
+// API, authenticating with the service account of the pod the exporter
+// runs in.
+func openKubernetesFile(statusPath string) (io.ReadCloser, error) {
+	namespace, pod, container, path, err := parseKubernetesPath(statusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a Kubernetes cluster")
+	}
+	token, err := ioutil.ReadFile(kubernetesServiceAccountPath + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(kubernetesServiceAccountPath + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("failed to parse Kubernetes CA certificate")
+	}
+
+	query := url.Values{}
+	query.Add("command", "cat")
+	query.Add("command", path)
+	query.Set("stdout", "true")
+	query.Set("stderr", "true")
+	if container != "" {
+		query.Set("container", container)
+	}
+	base := "https://" + net.JoinHostPort(host, port)
+	config, err := websocket.NewConfig(
+		fmt.Sprintf("wss://%s/api/v1/namespaces/%s/pods/%s/exec?%s",
+			net.JoinHostPort(host, port), url.PathEscape(namespace), url.PathEscape(pod), query.Encode()),
+		base)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{"v4.channel.k8s.io"}
+	config.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	config.TlsConfig = &tls.Config{RootCAs: roots}
+
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var stdout, stderr bytes.Buffer
+	for {
+		var message []byte
+		if err := websocket.Message.Receive(conn, &message); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(message) == 0 {
+			continue
+		}
+		switch message[0] {
+		case kubernetesStdoutChannel:
+			stdout.Write(message[1:])
+		case kubernetesStderrChannel:
+			stderr.Write(message[1:])
+		case kubernetesErrorChannel:
+			// Final status of the command, which is only
+			// reported when it failed.
+			var status struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(message[1:], &status); err == nil && status.Status != "Success" {
+				return nil, fmt.Errorf("failed to read %s from pod %s/%s: %s %s", path, namespace, pod, status.Message, strings.TrimSpace(stderr.String()))
+			}
+		}
+	}
+	return ioutil.NopCloser(&stdout), nil
+}
@@ -0,0 +1,80 @@
+package exporters
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels that can be attached to the metrics of CLIENT_LIST and
+// ROUTING_TABLE entries, and the columns from which their values are
+// taken.
+var (
+	clientLabelColumnsByName = map[string]string{
+		"common_name":     "Common Name",
+		"connection_time": "Connected Since (time_t)",
+		"real_address":    "Real Address",
+		"virtual_address": "Virtual Address",
+		"username":        "Username",
+		// The real address without its port, which changes whenever
+		// a client reconnects.
+		"real_ip": "Real IP",
+		// Written by OpenVPN 2.4 and later, empty for clients
+		// without an IPv6 address.
+		"virtual_ipv6_address": "Virtual IPv6 Address",
+		// Identifiers of connections, assigned by OpenVPN 2.4 and
+		// later, which remain stable for the connection's lifetime.
+		"client_id": "Client ID",
+		"peer_id":   "Peer ID",
+	}
+	routeLabelColumnsByName = map[string]string{
+		"common_name":     "Common Name",
+		"real_address":    "Real Address",
+		"real_ip":         "Real IP",
+		"virtual_address": "Virtual Address",
+	}
+	// Labels of the metrics of status sources, which may not be used
+	// as labels of a source. These include the labels of clients, which
+	// are reserved for client metadata as well.
+	sourceReservedLabels = append([]string{"session", "collector", "reason", "name", "version", "asn", "as_org", "cipher", "state"}, clientMetadataReservedLabels...)
+)
+
+// CheckClientLabels returns an error if the given labels can't be attached
+// to the metrics of CLIENT_LIST entries.
+func CheckClientLabels(names []string) error {
+	return checkLabels(names, clientLabelColumnsByName)
+}
+
+// CheckRouteLabels returns an error if the given labels can't be attached
+// to the metrics of ROUTING_TABLE entries.
+func CheckRouteLabels(names []string) error {
+	return checkLabels(names, routeLabelColumnsByName)
+}
+
+func checkLabels(names []string, columns map[string]string) error {
+	seen := map[string]bool{}
+	for _, name := range names {
+		if _, ok := columns[name]; !ok {
+			var valid []string
+			for name := range columns {
+				valid = append(valid, name)
+			}
+			sort.Strings(valid)
+			return fmt.Errorf("invalid label %q, should be one of %s", name, strings.Join(valid, ", "))
+		}
+		if seen[name] {
+			return fmt.Errorf("label %q specified more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// Returns the columns from which the values of the given labels are taken.
+func labelColumns(names []string, columns map[string]string) []string {
+	var result []string
+	for _, name := range names {
+		result = append(result, columns[name])
+	}
+	return result
+}
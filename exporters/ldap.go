@@ -0,0 +1,226 @@
+package exporters
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"log/slog"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ldapUser struct {
+	found bool
+	// Whether looking up the user failed, in which case it's omitted
+	// until it's retried.
+	failed     bool
+	attributes []string
+	expires    time.Time
+}
+
+// Lookups that failed are retried after this long, rather than on every
+// refresh, so that a failing LDAP server isn't flooded with requests.
+const ldapFailureTTL = time.Minute
+
+// LDAPUserCollector looks up the usernames of clients connected to the
+// OpenVPN servers in an LDAP directory, such as Active Directory, and
+// exports the configured attributes of each user as labels of an info
+// metric. This allows VPN usage to be broken down by department or other
+// organizational units by joining on the username label. The connected
+// users are looked up in the background, so that a slow LDAP server
+// doesn't delay scrapes. Lookups are cached, including lookups of users
+// that don't exist, and failed lookups for a short while.
+type LDAPUserCollector struct {
+	statusPaths  func() []string
+	url          string
+	bindDN       string
+	bindPassword string
+	baseDN       string
+	filter       string
+	attributes   []string
+	cacheTTL     time.Duration
+	timeout      time.Duration
+	interval     time.Duration
+
+	infoDesc  *prometheus.Desc
+	foundDesc *prometheus.Desc
+
+	mutex sync.Mutex
+	users map[string]ldapUser
+}
+
+// NewLDAPUserCollector creates a collector that searches for users below
+// baseDN using filter, in which %s is replaced by the escaped username.
+// The connected users are refreshed at the given interval by Run.
+func NewLDAPUserCollector(statusPaths func() []string, url string, bindDN string, bindPassword string, baseDN string, filter string, attributes []string, cacheTTL time.Duration, timeout time.Duration, interval time.Duration) (*LDAPUserCollector, error) {
+	if !strings.Contains(filter, "%s") {
+		return nil, fmt.Errorf("LDAP filter %q should contain %%s", filter)
+	}
+	for _, attribute := range attributes {
+		if !model.LabelName(attribute).IsValid() || attribute == "username" {
+			return nil, fmt.Errorf("LDAP attribute %q can't be used as a label name", attribute)
+		}
+	}
+	return &LDAPUserCollector{
+		statusPaths:  statusPaths,
+		url:          url,
+		bindDN:       bindDN,
+		bindPassword: bindPassword,
+		baseDN:       baseDN,
+		filter:       filter,
+		attributes:   attributes,
+		cacheTTL:     cacheTTL,
+		timeout:      timeout,
+		interval:     interval,
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "user_ldap_info"),
+			"Attributes of a connected user, as stored in LDAP.",
+			append([]string{"username"}, attributes...), nil),
+		foundDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "user_ldap_found"),
+			"Whether a connected user was found in LDAP.",
+			[]string{"username"}, nil),
+		users: map[string]ldapUser{},
+	}, nil
+}
+
+func (c *LDAPUserCollector) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(c.url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: c.timeout}),
+		ldap.DialWithTLSConfig(&tls.Config{}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(c.timeout)
+	if c.bindDN != "" {
+		if err := conn.Bind(c.bindDN, c.bindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *LDAPUserCollector) lookup(conn *ldap.Conn, username string) (ldapUser, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		c.baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		1,
+		// The time limit is given in whole seconds, so sub-second
+		// timeouts are rounded up rather than disabling it.
+		int(math.Ceil(c.timeout.Seconds())),
+		false,
+		fmt.Sprintf(c.filter, ldap.EscapeFilter(username)),
+		c.attributes,
+		nil))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return ldapUser{}, err
+	}
+	user := ldapUser{expires: time.Now().Add(c.cacheTTL)}
+	if len(result.Entries) > 0 {
+		user.found = true
+		for _, attribute := range c.attributes {
+			user.attributes = append(user.attributes, result.Entries[0].GetAttributeValue(attribute))
+		}
+	}
+	return user, nil
+}
+
+// Looks up the users that are connected and aren't cached. Users that
+// fail to be looked up are omitted until they are retried.
+func (c *LDAPUserCollector) refresh() {
+	usernames := map[string]bool{}
+	for _, statusPath := range expandStatusPaths(c.statusPaths()) {
+		clients, err := readServerClientList(statusPath)
+		if err != nil {
+			slog.Error("Failed to read clients", "status_path", statusPath, "err", err)
+			continue
+		}
+		for _, client := range clients {
+			// Clients that did not authenticate using a username
+			// are reported as UNDEF.
+			if username := client["Username"]; username != "" && username != "UNDEF" {
+				usernames[username] = true
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	cached := c.users
+	c.mutex.Unlock()
+	now := time.Now()
+	var conn *ldap.Conn
+	var connErr error
+	users := map[string]ldapUser{}
+	for username := range usernames {
+		if user, ok := cached[username]; ok && now.Before(user.expires) {
+			users[username] = user
+			continue
+		}
+		if conn == nil && connErr == nil {
+			if conn, connErr = c.connect(); connErr != nil {
+				slog.Error("Failed to connect to LDAP server", "url", c.url, "err", connErr)
+			} else {
+				defer conn.Close()
+			}
+		}
+		user, err := ldapUser{}, connErr
+		if err == nil {
+			if user, err = c.lookup(conn, username); err != nil {
+				slog.Error("Failed to look up user in LDAP", "username", username, "err", err)
+			}
+		}
+		if err != nil {
+			user = ldapUser{failed: true, expires: now.Add(ldapFailureTTL)}
+		}
+		users[username] = user
+	}
+	// Users that are no longer connected are dropped from the cache.
+	c.mutex.Lock()
+	c.users = users
+	c.mutex.Unlock()
+}
+
+// Run refreshes the connected users at the configured interval. It never
+// returns.
+func (c *LDAPUserCollector) Run() {
+	for {
+		c.refresh()
+		time.Sleep(c.interval)
+	}
+}
+
+func (c *LDAPUserCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.infoDesc
+	ch <- c.foundDesc
+}
+
+func (c *LDAPUserCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for username, user := range c.users {
+		if user.failed {
+			continue
+		}
+		found := 0.0
+		if user.found {
+			found = 1.0
+			ch <- prometheus.MustNewConstMetric(
+				c.infoDesc,
+				prometheus.GaugeValue,
+				1.0,
+				append([]string{username}, user.attributes...)...)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.foundDesc,
+			prometheus.GaugeValue,
+			found,
+			username)
+	}
+}
@@ -0,0 +1,247 @@
+package exporters
+
+import (
+	"bytes"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Messages of OpenVPN server logs that are counted, by the counter they
+// are counted in and the reason label. A message is only counted by the
+// first matching pattern, so that it's counted in a single counter.
+var logPatterns = []struct {
+	pattern *regexp.Regexp
+	// One of auth_failure, rejected or tls_error.
+	counter string
+	reason  string
+}{
+	{regexp.MustCompile(`VERIFY CRL: .* is revoked|VERIFY ERROR: .*error=certificate revoked`), "auth_failure", "certificate_revoked"},
+	{regexp.MustCompile(`VERIFY ERROR: .*error=certificate has expired`), "auth_failure", "certificate_expired"},
+	{regexp.MustCompile(`VERIFY ERROR: `), "auth_failure", "certificate"},
+	{regexp.MustCompile(`Auth Username/Password verification failed`), "auth_failure", "password"},
+	{regexp.MustCompile(`would exceed maximum number of clients`), "rejected", "max_clients"},
+	{regexp.MustCompile(`rejected due to 'disable' directive`), "rejected", "disabled"},
+	{regexp.MustCompile(`client-config-dir authentication failed`), "rejected", "ccd_exclusive"},
+	{regexp.MustCompile(`client-connect.*(failed|rejected)|(failed|rejected).*client-connect`), "rejected", "client_connect"},
+	// Errors of the TLS control channel, most of which are caused by
+	// scanners or clients lacking the tls-auth or tls-crypt key rather
+	// than by legitimate clients.
+	{regexp.MustCompile(`TLS Error: (cannot locate HMAC|incoming packet authentication failed|tls-crypt unwrapping failed)|tls-crypt unwrap error`), "tls_error", "hmac"},
+	{regexp.MustCompile(`TLS Error: TLS key negotiation failed`), "tls_error", "key_negotiation_failed"},
+	{regexp.MustCompile(`TLS Error: TLS handshake failed`), "tls_error", "handshake_failed"},
+	{regexp.MustCompile(`TLS Error: Unroutable control packet`), "tls_error", "unroutable_control_packet"},
+	{regexp.MustCompile(`TLS Error: local/remote TLS keys are out of sync`), "tls_error", "keys_out_of_sync"},
+	{regexp.MustCompile(`OpenSSL: error:|TLS_ERROR: BIO read tls_read_plaintext error`), "tls_error", "ssl"},
+}
+
+// A log file that is followed as it's written to.
+type logTail struct {
+	path string
+	file *os.File
+	// Incomplete last line, read before it was written completely.
+	partial []byte
+	// Whether the previous read failed, so that errors are only logged
+	// once until the log file can be read again.
+	failing bool
+}
+
+// Returns the lines that were appended to the log file since the previous
+// call. Log files that are rotated or truncated are followed from their
+// start. When first opened, a log file is read from its end, so that
+// messages logged before the exporter started aren't counted.
+func (t *logTail) lines(initial bool) ([][]byte, error) {
+	if t.file == nil {
+		file, err := os.Open(t.path)
+		if err != nil {
+			return nil, err
+		}
+		if initial {
+			if _, err := file.Seek(0, io.SeekEnd); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		t.file = file
+	}
+
+	data, err := io.ReadAll(t.file)
+	if err != nil {
+		return nil, err
+	}
+	// Once the file has been read up to its end, check whether it was
+	// replaced or truncated.
+	if info, err := os.Stat(t.path); err == nil {
+		current, err := t.file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		offset, err := t.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if !os.SameFile(info, current) {
+			// Lines may have been written to the old file since
+			// reading it.
+			rest, err := io.ReadAll(t.file)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, rest...)
+			t.file.Close()
+			t.file = nil
+		} else if info.Size() < offset {
+			if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			t.partial = nil
+		}
+	}
+
+	data = append(t.partial, data...)
+	lines := bytes.Split(data, []byte("\n"))
+	t.partial = lines[len(lines)-1]
+	return lines[:len(lines)-1], nil
+}
+
+// An authentication failure, as forwarded to syslog.
+type logAuthFailure struct {
+	Time    time.Time `json:"time"`
+	LogPath string    `json:"log_path"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message"`
+}
+
+// LogCollector follows OpenVPN server logs, counting failed
+// authentications, rejected connections and TLS errors, which never
+// appear in status files. Messages are matched regardless of prefixes
+// added by OpenVPN or syslog.
+type LogCollector struct {
+	tails    []*logTail
+	interval time.Duration
+	syslog   *SyslogForwarder
+
+	authFailuresDesc *prometheus.Desc
+	rejectedDesc     *prometheus.Desc
+	tlsErrorsDesc    *prometheus.Desc
+
+	mutex  sync.Mutex
+	counts map[string]map[[2]string]float64
+}
+
+func NewLogCollector(logPaths []string, interval time.Duration) *LogCollector {
+	c := &LogCollector{
+		interval: interval,
+		authFailuresDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "auth_failures_total"),
+			"Number of failed authentications of clients logged by the OpenVPN server, by reason.",
+			[]string{"log_path", "reason"}, nil),
+		rejectedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "connections_rejected_total"),
+			"Number of connections of authenticated clients rejected by the OpenVPN server, by reason.",
+			[]string{"log_path", "reason"}, nil),
+		tlsErrorsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "tls_errors_total"),
+			"Number of errors of the TLS control channel logged by the OpenVPN server, by reason.",
+			[]string{"log_path", "reason"}, nil),
+		counts: map[string]map[[2]string]float64{},
+	}
+	for _, logPath := range logPaths {
+		c.tails = append(c.tails, &logTail{path: logPath})
+		// Counters of all reasons are exported from the start, so
+		// that their increase can be alerted on.
+		counts := map[[2]string]float64{}
+		for _, p := range logPatterns {
+			counts[[2]string{p.counter, p.reason}] = 0
+		}
+		c.counts[logPath] = counts
+	}
+	return c
+}
+
+// SetSyslog makes the collector forward every authentication failure to
+// syslog, along with the message logged by OpenVPN.
+func (c *LogCollector) SetSyslog(forwarder *SyslogForwarder) {
+	c.syslog = forwarder
+}
+
+// Counts the messages logged since the previous call.
+func (c *LogCollector) read(initial bool) {
+	for _, tail := range c.tails {
+		lines, err := tail.lines(initial)
+		if err != nil {
+			if !tail.failing {
+				slog.Error("Failed to read OpenVPN log", "log_path", tail.path, "err", err)
+			}
+			tail.failing = true
+			continue
+		}
+		tail.failing = false
+		c.mutex.Lock()
+		for _, line := range lines {
+			for _, p := range logPatterns {
+				if p.pattern.Match(line) {
+					c.counts[tail.path][[2]string{p.counter, p.reason}]++
+					if c.syslog != nil && p.counter == "auth_failure" {
+						now := time.Now()
+						c.syslog.forward(syslogMessage{
+							time:     now,
+							severity: syslogWarning,
+							msgID:    "auth-failure",
+							body: logAuthFailure{
+								Time:    now,
+								LogPath: tail.path,
+								Reason:  p.reason,
+								Message: string(bytes.TrimSpace(line)),
+							},
+						})
+					}
+					break
+				}
+			}
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// Run follows the log files, reading them at the configured interval. It
+// never returns.
+func (c *LogCollector) Run() {
+	c.read(true)
+	for {
+		time.Sleep(c.interval)
+		c.read(false)
+	}
+}
+
+func (c *LogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.authFailuresDesc
+	ch <- c.rejectedDesc
+	ch <- c.tlsErrorsDesc
+}
+
+func (c *LogCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for logPath, counts := range c.counts {
+		for key, count := range counts {
+			desc := c.authFailuresDesc
+			switch key[0] {
+			case "rejected":
+				desc = c.rejectedDesc
+			case "tls_error":
+				desc = c.tlsErrorsDesc
+			}
+			ch <- prometheus.MustNewConstMetric(
+				desc,
+				prometheus.CounterValue,
+				count,
+				logPath,
+				key[1])
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package exporters
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ManagementStatusPath returns the status path under which a management
+// interface is read, i.e. tcp://<host>:<port>, or unix://<path> for
+// addresses starting with a slash.
+func ManagementStatusPath(address string, passwordFile string) string {
+	return managementStatusPath(address, passwordFile, 0, 0)
+}
+
+// ManagementBytecountStatusPath returns the status path of a management
+// interface like ManagementStatusPath, additionally subscribing to the
+// byte counts of its clients every interval, rather than only reading them
+// from the status.
+func ManagementBytecountStatusPath(address string, passwordFile string, interval time.Duration) string {
+	return managementStatusPath(address, passwordFile, interval, 0)
+}
+
+// Timeout of connecting to a management interface and of reading its
+// responses, unless set using the timeout query parameter.
+const defaultManagementTimeout = 10 * time.Second
+
+func managementStatusPath(address string, passwordFile string, bytecountInterval time.Duration, timeout time.Duration) string {
+	statusPath := "tcp://" + address
+	if strings.HasPrefix(address, "/") {
+		statusPath = "unix://" + address
+	}
+	// Escaped, as password files may contain characters such as & or #.
+	params := url.Values{}
+	if passwordFile != "" {
+		params.Set("password_file", passwordFile)
+	}
+	if bytecountInterval > 0 {
+		params.Set("bytecount", bytecountInterval.String())
+	}
+	if timeout > 0 {
+		params.Set("timeout", timeout.String())
+	}
+	if len(params) > 0 {
+		statusPath += "?" + params.Encode()
+	}
+	return statusPath
+}
+
+// Reads the status of an OpenVPN daemon through its management interface,
+// for daemons that don't write a status file and to avoid the staleness
+// caused by the interval at which status files are written. Servers are
+// asked for version 3 of the status format, while clients, which ignore
+// the version, report the same statistics as in their status file.
+func openManagementStatus(network string, address string, passwordFile string, timeout time.Duration) (io.ReadCloser, error) {
+	conn, reader, err := dialManagement(network, address, passwordFile, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "status 3\n"); err != nil {
+		return nil, err
+	}
+	readLine := func() (string, error) {
+		return reader.ReadString('\n')
+	}
+	status, err := readManagementStatus(readLine)
+	if err != nil {
+		return nil, err
+	}
+	status, err = addManagementStats(status, func(command string) error {
+		_, err := io.WriteString(conn, command+"\n")
+		return err
+	}, readLine)
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(conn, "quit\n")
+	return ioutil.NopCloser(status), nil
+}
+
+// Connects to a management interface. Management interfaces protected by
+// a password (i.e., started with --management <address> <port> <pwfile>)
+// require the password to be read from passwordFile. The connection has a
+// deadline of the timeout, which callers keeping it open should clear.
+func dialManagement(network string, address string, passwordFile string, timeout time.Duration) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	reader := bufio.NewReader(conn)
+
+	if passwordFile != "" {
+		fail := func(err error) (net.Conn, *bufio.Reader, error) {
+			conn.Close()
+			return nil, nil, err
+		}
+		password, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return fail(err)
+		}
+		// The prompt isn't followed by a newline.
+		prompt, err := reader.ReadString(':')
+		if err != nil {
+			return fail(err)
+		}
+		if strings.TrimSpace(prompt) != "ENTER PASSWORD:" {
+			return fail(fmt.Errorf("management interface: expected password prompt, got %q", prompt))
+		}
+		if _, err := io.WriteString(conn, strings.TrimSpace(string(password))+"\n"); err != nil {
+			return fail(err)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fail(err)
+		}
+		if !strings.HasPrefix(line, "SUCCESS:") {
+			return fail(fmt.Errorf("management interface: %s", strings.TrimSpace(line)))
+		}
+	}
+	return conn, reader, nil
+}
+
+// Reads the response to a status command, line by line, up to its END.
+func readManagementStatus(readLine func() (string, error)) (*bytes.Buffer, error) {
+	var status bytes.Buffer
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, ">") {
+			// Real-time notifications, such as the greeting
+			// sent upon connecting.
+			continue
+		} else if strings.HasPrefix(line, "ENTER PASSWORD:") {
+			return nil, fmt.Errorf("management interface requires a password")
+		} else if strings.HasPrefix(line, "ERROR:") {
+			return nil, fmt.Errorf("management interface: %s", strings.TrimSpace(line[len("ERROR:"):]))
+		}
+		status.WriteString(line + "\n")
+		if line == "END" {
+			return &status, nil
+		}
+	}
+}
+
+// Adds statistics that are only available through the management
+// interface to the status read from it, so that they're parsed along with
+// it: the load statistics of servers and the connection state of clients.
+// Daemons that don't support the commands are left alone.
+func addManagementStats(status *bytes.Buffer, command func(string) error, readLine func() (string, error)) (*bytes.Buffer, error) {
+	if bytes.HasPrefix(status.Bytes(), []byte("TITLE\t")) {
+		return addLoadStats(status, command, readLine)
+	} else if bytes.HasPrefix(status.Bytes(), []byte("OpenVPN STATISTICS")) {
+		return addState(status, command, readLine)
+	}
+	return status, nil
+}
+
+// Reads a line of a response, skipping real-time notifications.
+func readManagementLine(readLine func() (string, error)) (string, error) {
+	for {
+		line, err := readLine()
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, ">") {
+			return line, nil
+		}
+	}
+}
+
+// Inserts lines into a status before its END.
+func insertBeforeEnd(status *bytes.Buffer, lines string) *bytes.Buffer {
+	contents := strings.TrimSuffix(status.String(), "END\n")
+	return bytes.NewBufferString(contents + lines + "END\n")
+}
+
+// Asks a server for its load statistics using the load-stats command and
+// adds them to its status as a LOAD_STATS entry. Unlike the traffic of the
+// client list, they include the traffic of clients that have disconnected
+// since the server started.
+func addLoadStats(status *bytes.Buffer, command func(string) error, readLine func() (string, error)) (*bytes.Buffer, error) {
+	if err := command("load-stats"); err != nil {
+		return nil, err
+	}
+	line, err := readManagementLine(readLine)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "SUCCESS:") {
+		return status, nil
+	}
+
+	// SUCCESS: nclients=<n>,bytesin=<bytes>,bytesout=<bytes>
+	stats := map[string]string{}
+	for _, stat := range strings.Split(strings.TrimSpace(line[len("SUCCESS:"):]), ",") {
+		if key, value, ok := strings.Cut(stat, "="); ok {
+			stats[key] = value
+		}
+	}
+	for _, key := range []string{"nclients", "bytesin", "bytesout"} {
+		if _, ok := stats[key]; !ok {
+			return nil, fmt.Errorf("management interface: unexpected load-stats response %q", line)
+		}
+	}
+	return insertBeforeEnd(status,
+		"HEADER\tLOAD_STATS\tClients\tBytes In\tBytes Out\n"+
+			"LOAD_STATS\t"+stats["nclients"]+"\t"+stats["bytesin"]+"\t"+stats["bytesout"]+"\n"), nil
+}
+
+// Asks a client for its connection state using the state command and adds
+// it to its status as a State line, holding the name of the state and the
+// time at which the client entered it.
+func addState(status *bytes.Buffer, command func(string) error, readLine func() (string, error)) (*bytes.Buffer, error) {
+	if err := command("state"); err != nil {
+		return nil, err
+	}
+	// <time_t>,<state>,<description>,<local IP>,<remote IP>,...
+	// followed by END.
+	var state []string
+	for {
+		line, err := readManagementLine(readLine)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "ERROR:") {
+			return status, nil
+		} else if line == "END" {
+			break
+		}
+		state = strings.Split(line, ",")
+	}
+	if len(state) < 2 {
+		return nil, fmt.Errorf("management interface: unexpected state response %q", strings.Join(state, ","))
+	}
+	return insertBeforeEnd(status, "State,"+state[1]+","+state[0]+"\n"), nil
+}
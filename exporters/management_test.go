@@ -0,0 +1,25 @@
+package exporters
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestManagementStatusPath(t *testing.T) {
+	statusPath := managementStatusPath("127.0.0.1:7505", "/etc/openvpn/a&b #1.pw", 5*time.Second, time.Minute)
+	if want := "tcp://127.0.0.1:7505?bytecount=5s&password_file=%2Fetc%2Fopenvpn%2Fa%26b+%231.pw&timeout=1m0s"; statusPath != want {
+		t.Errorf("got %s, want %s", statusPath, want)
+	}
+	u, err := url.Parse(statusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("password_file"); got != "/etc/openvpn/a&b #1.pw" {
+		t.Errorf("got password file %q", got)
+	}
+
+	if got := ManagementStatusPath("/run/openvpn/server.sock", ""); got != "unix:///run/openvpn/server.sock" {
+		t.Errorf("got %s for a unix socket", got)
+	}
+}
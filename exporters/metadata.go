@@ -0,0 +1,141 @@
+package exporters
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/prometheus/common/model"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Labels of client metrics that may not be overridden by metadata.
+var clientMetadataReservedLabels = []string{"status_path", "common_name", "connection_time", "real_address", "virtual_address", "username", "session_id", "client_id", "peer_id", "virtual_ipv6_address", "real_ip", "country", "data_channel_cipher"}
+
+// ClientMetadata holds static labels per common name, read from a CSV
+// file whose header row starts with common_name, followed by the names of
+// the labels to attach to the metrics of each client:
+//
+//	common_name,team,site,device_type
+//	alice,ops,ams,laptop
+//
+// The file is reloaded when it changes or SIGHUP is received. Since the
+// label names of metrics can't change at runtime, changes to the header
+// row are rejected until the exporter is restarted.
+type ClientMetadata struct {
+	path     string
+	interval time.Duration
+	names    []string
+
+	mutex   sync.Mutex
+	labels  map[string][]string
+	modTime time.Time
+}
+
+func NewClientMetadata(path string, interval time.Duration) (*ClientMetadata, error) {
+	m := &ClientMetadata{path: path, interval: interval}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *ClientMetadata) reload() error {
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(m.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 || len(records[0]) < 2 || records[0][0] != "common_name" {
+		return fmt.Errorf("%s: header row should start with common_name, followed by label names", m.path)
+	}
+	labelNames := records[0][1:]
+	for _, name := range labelNames {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") || contains(clientMetadataReservedLabels, name) {
+			return fmt.Errorf("%s: invalid label name %q", m.path, name)
+		}
+	}
+	if m.names != nil && strings.Join(labelNames, ",") != strings.Join(m.names, ",") {
+		return fmt.Errorf("%s: label names changed from %q to %q, which requires a restart", m.path, m.names, labelNames)
+	}
+	labels := map[string][]string{}
+	for _, record := range records[1:] {
+		labels[record[0]] = record[1:]
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.names = labelNames
+	m.labels = labels
+	m.modTime = info.ModTime()
+	return nil
+}
+
+// Run reloads the file when it changes or SIGHUP is received. It never
+// returns. A file that fails to load is logged and the previous contents
+// are kept.
+func (m *ClientMetadata) Run() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	ticker := time.NewTicker(m.interval)
+	for {
+		select {
+		case <-signals:
+		case <-ticker.C:
+			info, err := os.Stat(m.path)
+			if err != nil {
+				continue
+			}
+			// Files that fail to load are only reported once.
+			m.mutex.Lock()
+			changed := !info.ModTime().Equal(m.modTime)
+			m.modTime = info.ModTime()
+			m.mutex.Unlock()
+			if !changed {
+				continue
+			}
+		}
+		if err := m.reload(); err != nil {
+			slog.Error("Failed to reload client metadata", "path", m.path, "err", err)
+		} else {
+			slog.Info("Reloaded client metadata", "path", m.path)
+		}
+	}
+}
+
+// Returns the names of the labels attached to the metrics of clients.
+func (m *ClientMetadata) labelNames() []string {
+	if m == nil {
+		return nil
+	}
+	return m.names
+}
+
+// Returns the values of the labels of a common name, which are empty for
+// common names not listed in the file.
+func (m *ClientMetadata) labelValues(commonName string) []string {
+	if m == nil {
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if values, ok := m.labels[commonName]; ok {
+		return append([]string{}, values...)
+	}
+	return make([]string, len(m.names))
+}
@@ -1,21 +1,30 @@
 package exporters
 
 import (
-	"bufio"
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"github.com/prometheus/client_golang/prometheus"
 	"io"
-	"log"
-	"os"
+	"log/slog"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type OpenvpnServerHeader struct {
 	LabelColumns []string
 	Metrics      []OpenvpnServerHeaderField
+	// Applied to the values of the Real Address column.
+	privacy *RealAddressPrivacy
+	// Whether to sum the values of entries with equal labels, rather
+	// than only exporting the first of them.
+	aggregate bool
 }
 
 type OpenvpnServerHeaderField struct {
@@ -24,248 +33,286 @@ type OpenvpnServerHeaderField struct {
 	ValueType prometheus.ValueType
 }
 
+// StatusCollector converts a part of an OpenVPN status file into
+// Prometheus metrics. Status files are read once per scrape by
+// OpenVPNExporter, which passes them on to each of its collectors.
+type StatusCollector interface {
+	// Name of the collector, as reported in the collector label.
+	Name() string
+	Describe(ch chan<- *prometheus.Desc)
+	// Whether the collector applies to the kind of status file.
+	appliesTo(file *StatusFile) bool
+	collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error
+}
+
 type OpenVPNExporter struct {
-	statusPaths                 []string
-	openvpnUpDesc               *prometheus.Desc
-	openvpnStatusUpdateTimeDesc *prometheus.Desc
-	openvpnConnectedClientsDesc *prometheus.Desc
-	openvpnClientDescs          map[string]*prometheus.Desc
-	openvpnServerHeaders        map[string]OpenvpnServerHeader
+	statusPaths                  []string
+	collectors                   []StatusCollector
+	openvpnUpDesc                *prometheus.Desc
+	openvpnScrapeDurationDesc    *prometheus.Desc
+	openvpnCollectorSuccessDesc  *prometheus.Desc
+	openvpnCollectorDurationDesc *prometheus.Desc
+	openvpnScrapeErrorsDesc      *prometheus.Desc
+	openvpnStatusFileMtimeDesc   *prometheus.Desc
+
+	staleThreshold time.Duration
+	errorsMutex    sync.Mutex
+	errors         map[[2]string]float64
+
+	concurrency int
+	timeout     time.Duration
+
+	cacheTTL   time.Duration
+	cacheMutex sync.Mutex
+	cache      map[string]*cachedStatusFile
+	watcher    *fsnotify.Watcher
+	// Cleaned status paths and patterns of the watched status files.
+	watched []string
 }
 
-func NewOpenVPNExporter(statusPaths []string, ignoreIndividuals bool) (*OpenVPNExporter, error) {
+// Metrics of a status file as last collected.
+type cachedStatusFile struct {
+	// Number of times the status file was written to, as seen by the
+	// watcher.
+	writes atomic.Uint64
+
+	mutex           sync.Mutex
+	collected       bool
+	collectedWrites uint64
+	expires         time.Time
+	metrics         []prometheus.Metric
+	skipped         bool
+	// Time after which the statistics are stale, if a stale threshold is
+	// set. A status file that is no longer written to, e.g. as the daemon
+	// died, is collected again from then on, so that its staleness is
+	// counted on every scrape, like when not caching.
+	staleAt time.Time
+}
+
+// Reasons for which scraping a status file may fail.
+var scrapeErrorReasons = []string{"open", "parse", "stale"}
+
+// NewOpenVPNExporter creates an exporter that reads the given status
+// files and converts them into metrics using the given collectors. The
+// success and duration of each collector are reported separately, so that
+// partial failures are observable. Local status paths may be glob
+// patterns, e.g. /var/run/openvpn/*.status, which are expanded on every
+// scrape, so that status files of instances that are added later are
+// picked up.
+func NewOpenVPNExporter(statusPaths []string, collectors []StatusCollector) (*OpenVPNExporter, error) {
+	for _, statusPath := range statusPaths {
+		if _, err := filepath.Match(statusPath, ""); err != nil {
+			return nil, fmt.Errorf("invalid status path %q: %s", statusPath, err)
+		}
+	}
+	names := map[string]bool{}
+	for _, collector := range collectors {
+		if names[collector.Name()] {
+			return nil, fmt.Errorf("collector %s specified more than once", collector.Name())
+		}
+		names[collector.Name()] = true
+	}
+
 	// Metrics exported both for client and server statistics.
 	openvpnUpDesc := prometheus.NewDesc(
 		prometheus.BuildFQName("openvpn", "", "up"),
 		"Whether scraping OpenVPN's metrics was successful.",
 		[]string{"status_path"}, nil)
-	openvpnStatusUpdateTimeDesc := prometheus.NewDesc(
+	openvpnScrapeDurationDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "scrape", "duration_seconds"),
+		"Time it took to read, parse and collect a status file, in seconds.",
+		[]string{"status_path"}, nil)
+	openvpnCollectorSuccessDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "collector", "success"),
+		"Whether collecting a part of the OpenVPN statistics was successful.",
+		[]string{"status_path", "collector"}, nil)
+	openvpnCollectorDurationDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "collector", "duration_seconds"),
+		"Time it took to collect a part of the OpenVPN statistics, in seconds.",
+		[]string{"status_path", "collector"}, nil)
+	openvpnScrapeErrorsDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "scrape", "errors_total"),
+		"Number of times scraping a status file failed, by reason: open, parse or stale.",
+		[]string{"status_path", "reason"}, nil)
+	openvpnStatusFileMtimeDesc := prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "status_file", "mtime_seconds"),
+		"UNIX timestamp at which a status file was last modified, if known.",
+		[]string{"status_path"}, nil)
+
+	e := &OpenVPNExporter{
+		statusPaths:                  statusPaths,
+		collectors:                   collectors,
+		openvpnUpDesc:                openvpnUpDesc,
+		openvpnScrapeDurationDesc:    openvpnScrapeDurationDesc,
+		openvpnCollectorSuccessDesc:  openvpnCollectorSuccessDesc,
+		openvpnCollectorDurationDesc: openvpnCollectorDurationDesc,
+		openvpnScrapeErrorsDesc:      openvpnScrapeErrorsDesc,
+		openvpnStatusFileMtimeDesc:   openvpnStatusFileMtimeDesc,
+		errors:                       map[[2]string]float64{},
+		concurrency:                  1,
+		cache:                        map[string]*cachedStatusFile{},
+	}
+	retainBytecountSessions(e)
+	return e, nil
+}
+
+// Returns the description of the time at which the statistics were
+// updated, which is exported for both client and server statistics.
+func newStatusUpdateTimeDesc() *prometheus.Desc {
+	return prometheus.NewDesc(
 		prometheus.BuildFQName("openvpn", "", "status_update_time_seconds"),
 		"UNIX timestamp at which the OpenVPN statistics were updated.",
 		[]string{"status_path"}, nil)
+}
 
-	// Metrics specific to OpenVPN servers.
-	openvpnConnectedClientsDesc := prometheus.NewDesc(
-		prometheus.BuildFQName("openvpn", "", "server_connected_clients"),
-		"Number Of Connected Clients",
+// Returns the description of the difference between the time at which the
+// statistics were updated and the clock of the exporter.
+func newStatusClockDriftDesc() *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "status", "clock_drift_seconds"),
+		"Time at which the OpenVPN statistics were updated, minus the current time of the exporter's clock, in seconds.",
 		[]string{"status_path"}, nil)
+}
 
-	// Metrics specific to OpenVPN clients.
-	openvpnClientDescs := map[string]*prometheus.Desc{
-		"TUN/TAP read bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "tun_tap_read_bytes_total"),
-			"Total amount of TUN/TAP traffic read, in bytes.",
-			[]string{"status_path"}, nil),
-		"TUN/TAP write bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "tun_tap_write_bytes_total"),
-			"Total amount of TUN/TAP traffic written, in bytes.",
-			[]string{"status_path"}, nil),
-		"TCP/UDP read bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "tcp_udp_read_bytes_total"),
-			"Total amount of TCP/UDP traffic read, in bytes.",
-			[]string{"status_path"}, nil),
-		"TCP/UDP write bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "tcp_udp_write_bytes_total"),
-			"Total amount of TCP/UDP traffic written, in bytes.",
-			[]string{"status_path"}, nil),
-		"Auth read bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "auth_read_bytes_total"),
-			"Total amount of authentication traffic read, in bytes.",
-			[]string{"status_path"}, nil),
-		"pre-compress bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "pre_compress_bytes_total"),
-			"Total amount of data before compression, in bytes.",
-			[]string{"status_path"}, nil),
-		"post-compress bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "post_compress_bytes_total"),
-			"Total amount of data after compression, in bytes.",
-			[]string{"status_path"}, nil),
-		"pre-decompress bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "pre_decompress_bytes_total"),
-			"Total amount of data before decompression, in bytes.",
-			[]string{"status_path"}, nil),
-		"post-decompress bytes": prometheus.NewDesc(
-			prometheus.BuildFQName("openvpn", "client", "post_decompress_bytes_total"),
-			"Total amount of data after decompression, in bytes.",
-			[]string{"status_path"}, nil),
-	}
-
-	var serverHeaderClientLabels []string
-	var serverHeaderClientLabelColumns []string
-	var serverHeaderRoutingLabels []string
-	var serverHeaderRoutingLabelColumns []string
-	if ignoreIndividuals {
-		serverHeaderClientLabels = []string{"status_path", "common_name"}
-		serverHeaderClientLabelColumns = []string{"Common Name"}
-		serverHeaderRoutingLabels = []string{"status_path", "common_name"}
-		serverHeaderRoutingLabelColumns = []string{"Common Name"}
-	} else {
-		serverHeaderClientLabels = []string{"status_path", "common_name", "connection_time", "real_address", "virtual_address", "username"}
-		serverHeaderClientLabelColumns = []string{"Common Name", "Connected Since (time_t)", "Real Address", "Virtual Address", "Username"}
-		serverHeaderRoutingLabels = []string{"status_path", "common_name", "real_address", "virtual_address"}
-		serverHeaderRoutingLabelColumns = []string{"Common Name", "Real Address", "Virtual Address"}
-	}
-
-	openvpnServerHeaders := map[string]OpenvpnServerHeader{
-		"CLIENT_LIST": {
-			LabelColumns: serverHeaderClientLabelColumns,
-			Metrics: []OpenvpnServerHeaderField{
-				{
-					Column: "Bytes Received",
-					Desc: prometheus.NewDesc(
-						prometheus.BuildFQName("openvpn", "server", "client_received_bytes_total"),
-						"Amount of data received over a connection on the VPN server, in bytes.",
-						serverHeaderClientLabels, nil),
-					ValueType: prometheus.CounterValue,
-				},
-				{
-					Column: "Bytes Sent",
-					Desc: prometheus.NewDesc(
-						prometheus.BuildFQName("openvpn", "server", "client_sent_bytes_total"),
-						"Amount of data sent over a connection on the VPN server, in bytes.",
-						serverHeaderClientLabels, nil),
-					ValueType: prometheus.CounterValue,
-				},
-			},
-		},
-		"ROUTING_TABLE": {
-			LabelColumns: serverHeaderRoutingLabelColumns,
-			Metrics: []OpenvpnServerHeaderField{
-				{
-					Column: "Last Ref (time_t)",
-					Desc: prometheus.NewDesc(
-						prometheus.BuildFQName("openvpn", "server", "route_last_reference_time_seconds"),
-						"Time at which a route was last referenced, in seconds.",
-						serverHeaderRoutingLabels, nil),
-					ValueType: prometheus.GaugeValue,
-				},
-			},
-		},
-	}
-
-	return &OpenVPNExporter{
-		statusPaths:                 statusPaths,
-		openvpnUpDesc:               openvpnUpDesc,
-		openvpnStatusUpdateTimeDesc: openvpnStatusUpdateTimeDesc,
-		openvpnConnectedClientsDesc: openvpnConnectedClientsDesc,
-		openvpnClientDescs:          openvpnClientDescs,
-		openvpnServerHeaders:        openvpnServerHeaders,
-	}, nil
-}
-
-// Converts OpenVPN status information into Prometheus metrics. This
-// function automatically detects whether the file contains server or
-// client metrics. For server metrics, it also distinguishes between the
-// version 2 and 3 file formats.
-func (e *OpenVPNExporter) collectStatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric) error {
-	reader := bufio.NewReader(file)
-	buf, _ := reader.Peek(18)
-	if bytes.HasPrefix(buf, []byte("TITLE,")) {
-		// Server statistics, using format version 2.
-		return e.collectServerStatusFromReader(statusPath, reader, ch, ",")
-	} else if bytes.HasPrefix(buf, []byte("TITLE\t")) {
-		// Server statistics, using format version 3. The only
-		// difference compared to version 2 is that it uses tabs
-		// instead of spaces.
-		return e.collectServerStatusFromReader(statusPath, reader, ch, "\t")
-	} else if bytes.HasPrefix(buf, []byte("OpenVPN STATISTICS")) {
-		// Client statistics.
-		return e.collectClientStatusFromReader(statusPath, reader, ch)
-	} else {
-		return fmt.Errorf("unexpected file contents: %q", buf)
-	}
-}
-
-// Converts OpenVPN server status information into Prometheus metrics.
-func (e *OpenVPNExporter) collectServerStatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric, separator string) error {
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-	headersFound := map[string][]string{}
-	// counter of connected client
-	numberConnectedClient := 0
-
-	recordedMetrics := map[OpenvpnServerHeaderField][]string{}
-
-	for scanner.Scan() {
-		fields := strings.Split(scanner.Text(), separator)
-		if fields[0] == "END" && len(fields) == 1 {
-			// Stats footer.
-		} else if fields[0] == "GLOBAL_STATS" {
-			// Global server statistics.
-		} else if fields[0] == "HEADER" && len(fields) > 2 {
-			// Column names for CLIENT_LIST and ROUTING_TABLE.
-			headersFound[fields[1]] = fields[2:]
-		} else if fields[0] == "TIME" && len(fields) == 3 {
-			// Time at which the statistics were updated.
-			timeStartStats, err := strconv.ParseFloat(fields[2], 64)
-			if err != nil {
-				return err
-			}
-			ch <- prometheus.MustNewConstMetric(
-				e.openvpnStatusUpdateTimeDesc,
-				prometheus.GaugeValue,
-				timeStartStats,
-				statusPath)
-		} else if fields[0] == "TITLE" && len(fields) == 2 {
-			// OpenVPN version number.
-		} else if header, ok := e.openvpnServerHeaders[fields[0]]; ok {
-			if fields[0] == "CLIENT_LIST" {
-				numberConnectedClient++
-			}
-			// Entry that depends on a preceding HEADERS directive.
-			columnNames, ok := headersFound[fields[0]]
-			if !ok {
-				return fmt.Errorf("%s should be preceded by HEADERS", fields[0])
+// Returns the description of the number of entries that weren't exported
+// because of colliding labels, which is exported by the collectors of
+// entries.
+func newEntryCollisionsDesc() *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName("openvpn", "server", "entry_collisions"),
+		"Number of entries that weren't exported, as their labels are equal to those of a preceding entry, e.g. due to duplicate-cn when ignoring individuals.",
+		[]string{"status_path", "collector"}, nil)
+}
+
+// Exports the relevant columns of CLIENT_LIST or ROUTING_TABLE entries as
+// individual metrics. Metrics of entries whose labels are equal to those
+// of a preceding, different entry can't be exported, so the number of
+// such entries is returned instead, unless the header aggregates them.
+// Entries that are listed more than once are only exported once.
+func collectEntries(statusPath string, header OpenvpnServerHeader, rows []map[string]string, metadata *ClientMetadata, counters *counterTracker, ch chan<- prometheus.Metric) (int, error) {
+	// Entries, indexed by the labels under which they are exported.
+	recordedEntries := map[string]string{}
+	seenEntries := map[string]bool{}
+	collisions := 0
+	// Labels and values of aggregated entries, in order of appearance.
+	var aggregatedLabels [][]string
+	aggregatedValues := map[string]map[OpenvpnServerHeaderField]float64{}
+	for _, columnValues := range rows {
+		// Extract columns that should act as entry labels.
+		labels := []string{statusPath}
+		for _, column := range header.LabelColumns {
+			if isRealAddressColumn(column) {
+				labels = append(labels, header.privacy.value(columnValues[column]))
+			} else {
+				labels = append(labels, columnValues[column])
 			}
-			if len(fields) != len(columnNames)+1 {
-				return fmt.Errorf("HEADER for %s describes a different number of columns", fields[0])
+		}
+		labels = append(labels, metadata.labelValues(columnValues["Common Name"])...)
+
+		// All metrics of an entry share its labels.
+		key := strings.Join(labels, "\x00")
+		entry := fmt.Sprint(columnValues)
+		if seenEntries[entry] {
+			continue
+		}
+		seenEntries[entry] = true
+		if _, ok := recordedEntries[key]; ok && !header.aggregate {
+			slog.Debug("Metric entry with same labels", "labels", labels)
+			collisions++
+			continue
+		}
+		recordedEntries[key] = entry
+
+		values, ok := aggregatedValues[key]
+		if !ok {
+			values = map[OpenvpnServerHeaderField]float64{}
+			aggregatedValues[key] = values
+			aggregatedLabels = append(aggregatedLabels, labels)
+		}
+		for _, metric := range header.Metrics {
+			if columnValue, ok := columnValues[metric.Column]; ok {
+				value, err := strconv.ParseFloat(columnValue, 64)
+				if err != nil {
+					return 0, err
+				}
+				// Counters of aggregated entries are summed,
+				// while gauges hold the largest value, e.g.
+				// the time of the most recent connection.
+				if previous, ok := values[metric]; ok {
+					if metric.ValueType == prometheus.CounterValue {
+						value += previous
+					} else if previous > value {
+						value = previous
+					}
+				}
+				values[metric] = value
 			}
+		}
+	}
 
-			// Store entry values in a map indexed by column name.
-			columnValues := map[string]string{}
-			for _, column := range header.LabelColumns {
-				columnValues[column] = ""
+	// Export relevant columns as individual metrics.
+	for _, labels := range aggregatedLabels {
+		values := aggregatedValues[strings.Join(labels, "\x00")]
+		for _, metric := range header.Metrics {
+			value, ok := values[metric]
+			if !ok {
+				continue
 			}
-			for i, column := range columnNames {
-				columnValues[column] = fields[i+1]
+			if metric.ValueType == prometheus.CounterValue {
+				value = counters.adjust(statusPath, metric.Desc, labels, value)
 			}
+			ch <- prometheus.MustNewConstMetric(
+				metric.Desc,
+				metric.ValueType,
+				value,
+				labels...)
+		}
+	}
+	return collisions, nil
+}
 
-			// Extract columns that should act as entry labels.
-			labels := []string{statusPath}
-			for _, column := range header.LabelColumns {
-				labels = append(labels, columnValues[column])
+// SaveState returns the state of collectors that keep state across
+// collections, indexed by collector name.
+func (e *OpenVPNExporter) SaveState() (json.RawMessage, error) {
+	states := map[string]json.RawMessage{}
+	for _, collector := range e.collectors {
+		if p, ok := collector.(Persistable); ok {
+			state, err := p.SaveState()
+			if err != nil {
+				return nil, err
 			}
+			states[collector.Name()] = state
+		}
+	}
+	return json.Marshal(states)
+}
 
-			// Export relevant columns as individual metrics.
-			for _, metric := range header.Metrics {
-				if columnValue, ok := columnValues[metric.Column]; ok {
-					if l, _ := recordedMetrics[metric]; ! subslice(labels, l) {
-						value, err := strconv.ParseFloat(columnValue, 64)
-						if err != nil {
-							return err
-						}
-						ch <- prometheus.MustNewConstMetric(
-							metric.Desc,
-							metric.ValueType,
-							value,
-							labels...)
-						recordedMetrics[metric] = append(recordedMetrics[metric], labels...)
-					} else {
-						log.Printf("Metric entry with same labels: %s, %s", metric.Column, labels)
-					}
+// LoadState restores the state of collectors that keep state across
+// collections.
+func (e *OpenVPNExporter) LoadState(data json.RawMessage) error {
+	states := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return err
+	}
+	for _, collector := range e.collectors {
+		if p, ok := collector.(Persistable); ok {
+			if state, ok := states[collector.Name()]; ok {
+				if err := p.LoadState(state); err != nil {
+					return err
 				}
 			}
-		} else {
-			return fmt.Errorf("unsupported key: %q", fields[0])
 		}
 	}
-	// add the number of connected client
-	ch <- prometheus.MustNewConstMetric(
-		e.openvpnConnectedClientsDesc,
-		prometheus.GaugeValue,
-		float64(numberConnectedClient),
-		statusPath)
-	return scanner.Err()
+	return nil
+}
+
+// SessionID returns a stable identifier for a connection, derived from
+// the client's common name, the UNIX timestamp at which it connected and
+// its real address. Unlike the common name, it remains unique when
+// duplicate-cn is used.
+func SessionID(commonName string, connectedSince string, realAddress string) string {
+	hash := sha256.Sum256([]byte(commonName + "\x00" + connectedSince + "\x00" + realAddress))
+	return hex.EncodeToString(hash[:8])
 }
 
 // Does slice contain string
@@ -278,86 +325,421 @@ func contains(s []string, e string) bool {
 	return false
 }
 
-// Is a sub-slice of slice
-func subslice(sub []string, main []string) bool {
-	if len(sub) > len(main) {return false}
-	for _, s := range sub {
-		if ! contains(main, s) {
+// Returns whether a status path is a glob pattern, rather than a single
+// status file.
+func isStatusPathPattern(statusPath string) bool {
+	return !strings.Contains(statusPath, "://") && strings.ContainsAny(statusPath, "*?[")
+}
+
+// Expands the glob patterns among the given status paths into the status
+// files matching them, in lexical order. Patterns without matches are
+// left out, while other status paths are returned as is.
+func expandStatusPaths(statusPaths []string) []string {
+	var expanded []string
+	seen := map[string]bool{}
+	for _, statusPath := range statusPaths {
+		matches := []string{statusPath}
+		if isStatusPathPattern(statusPath) {
+			// Malformed patterns are rejected by NewOpenVPNExporter.
+			matches, _ = filepath.Glob(statusPath)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				expanded = append(expanded, match)
+				seen[match] = true
+			}
+		}
+	}
+	return expanded
+}
+
+// SplitInstanceName splits a status path written as <name>:<path> or
+// <name>=<path>, naming the OpenVPN instance, into its name and path.
+// Status paths without a name, including those of the form <scheme>://...
+// and Windows paths starting with a drive letter, such as
+// C:\Program Files\OpenVPN\log\status.log, are returned with an empty name.
+func SplitInstanceName(statusPath string) (string, string) {
+	if filepath.VolumeName(statusPath) != "" {
+		return "", statusPath
+	}
+	i := strings.IndexAny(statusPath, ":=")
+	if i > 0 && statusPath[i] == ':' && strings.HasPrefix(statusPath[i+1:], "//") {
+		return "", statusPath
+	}
+	return splitInstanceName(statusPath, i)
+}
+
+// SplitInstanceNameEquals is like SplitInstanceName, but only splits status
+// paths written as <name>=<path>, so that paths containing colons are never
+// mistaken for named ones.
+func SplitInstanceNameEquals(statusPath string) (string, string) {
+	return splitInstanceName(statusPath, strings.IndexByte(statusPath, '='))
+}
+
+// Splits a status path at the given index, if it's preceded by a valid
+// instance name.
+func splitInstanceName(statusPath string, i int) (string, string) {
+	if i <= 0 || !isInstanceName(statusPath[:i]) {
+		return "", statusPath
+	}
+	return statusPath[:i], statusPath[i+1:]
+}
+
+// Returns whether a string is a valid instance name, consisting of
+// letters, digits, underscores, dashes and dots.
+func isInstanceName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
 			return false
 		}
 	}
 	return true
 }
 
-// Converts OpenVPN client status information into Prometheus metrics.
-func (e *OpenVPNExporter) collectClientStatusFromReader(statusPath string, file io.Reader, ch chan<- prometheus.Metric) error {
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		fields := strings.Split(scanner.Text(), ",")
-		if fields[0] == "END" && len(fields) == 1 {
-			// Stats footer.
-		} else if fields[0] == "OpenVPN STATISTICS" && len(fields) == 1 {
-			// Stats header.
-		} else if fields[0] == "Updated" && len(fields) == 2 {
-			// Time at which the statistics were updated.
-			location, _ := time.LoadLocation("Local")
-			timeParser, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", fields[1], location)
-			if err != nil {
-				return err
-			}
-			ch <- prometheus.MustNewConstMetric(
-				e.openvpnStatusUpdateTimeDesc,
-				prometheus.GaugeValue,
-				float64(timeParser.Unix()),
-				statusPath)
-		} else if desc, ok := e.openvpnClientDescs[fields[0]]; ok && len(fields) == 2 {
-			// Traffic counters.
-			value, err := strconv.ParseFloat(fields[1], 64)
-			if err != nil {
-				return err
-			}
-			ch <- prometheus.MustNewConstMetric(
-				desc,
-				prometheus.CounterValue,
-				value,
-				statusPath)
-		} else {
-			return fmt.Errorf("unsupported key: %q", fields[0])
-		}
+// SetStaleThreshold makes the exporter count scrapes of status files
+// that haven't been updated for longer than the threshold as errors with
+// reason stale. It is disabled if zero.
+func (e *OpenVPNExporter) SetStaleThreshold(threshold time.Duration) {
+	e.staleThreshold = threshold
+}
+
+// SetConcurrency makes the exporter collect up to the given number of
+// status files concurrently, giving up on reading a status file after the
+// timeout. The timeout is disabled if zero. By default, status files are
+// collected one at a time, without a timeout.
+func (e *OpenVPNExporter) SetConcurrency(concurrency int, timeout time.Duration) {
+	if concurrency < 1 {
+		concurrency = 1
 	}
-	return scanner.Err()
+	e.concurrency = concurrency
+	e.timeout = timeout
 }
 
-func (e *OpenVPNExporter) collectStatusFromFile(statusPath string, ch chan<- prometheus.Metric) error {
-	conn, err := os.Open(statusPath)
-	defer conn.Close()
+// SetCacheTTL makes the exporter serve the metrics of a status file as
+// last collected to scrapes within the TTL, so that multiple Prometheus
+// servers scraping the exporter don't cause status files to be read more
+// often. It is disabled if zero.
+func (e *OpenVPNExporter) SetCacheTTL(ttl time.Duration) {
+	e.cacheTTL = ttl
+}
+
+// Watch makes the exporter only collect status files again once they
+// have been written to, serving the metrics as last collected otherwise.
+// The directories containing the status files are watched, so that
+// status files that are replaced or don't exist yet are picked up as
+// well. Status paths that aren't local files, and patterns matching files
+// in multiple directories, are collected on every scrape, unless a cache
+// TTL is set.
+func (e *OpenVPNExporter) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
 	}
-	return e.collectStatusFromReader(statusPath, conn, ch)
+	for _, statusPath := range e.statusPaths {
+		if strings.Contains(statusPath, "://") || isStatusPathPattern(filepath.Dir(statusPath)) {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(statusPath)); err != nil {
+			watcher.Close()
+			return err
+		}
+		// Events name files by their cleaned path.
+		e.watched = append(e.watched, filepath.Clean(statusPath))
+	}
+	e.watcher = watcher
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if e.isWatched(event.Name) {
+					e.cachedStatusFile(event.Name).writes.Add(1)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("Failed to watch status files", "err", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Returns whether a status file is watched.
+func (e *OpenVPNExporter) isWatched(statusPath string) bool {
+	statusPath = filepath.Clean(statusPath)
+	for _, pattern := range e.watched {
+		if matched, _ := filepath.Match(pattern, statusPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the cached metrics of a status file, keyed by its cleaned path.
+func (e *OpenVPNExporter) cachedStatusFile(statusPath string) *cachedStatusFile {
+	statusPath = filepath.Clean(statusPath)
+	e.cacheMutex.Lock()
+	defer e.cacheMutex.Unlock()
+	cache, ok := e.cache[statusPath]
+	if !ok {
+		cache = &cachedStatusFile{}
+		e.cache[statusPath] = cache
+	}
+	return cache
+}
+
+// Close stops watching the status files, and closes the collectors
+// holding resources, such as the databases of the ASN and GeoIP
+// collectors, and the connections to management interfaces that no other
+// exporter collects.
+func (e *OpenVPNExporter) Close() error {
+	releaseBytecountSessions(e)
+	err := closeCollectors(e.collectors)
+	if e.watcher != nil {
+		if watcherErr := e.watcher.Close(); err == nil {
+			err = watcherErr
+		}
+	}
+	return err
+}
+
+// Closes the collectors that implement io.Closer, returning the first
+// error.
+func closeCollectors(collectors []StatusCollector) error {
+	var err error
+	for _, collector := range collectors {
+		if closer, ok := collector.(io.Closer); ok {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+// Counts a failure to scrape a status file.
+func (e *OpenVPNExporter) countError(statusPath string, reason string) {
+	e.errorsMutex.Lock()
+	defer e.errorsMutex.Unlock()
+	e.errors[[2]string{statusPath, reason}]++
 }
 
 func (e *OpenVPNExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.openvpnUpDesc
+	ch <- e.openvpnScrapeDurationDesc
+	ch <- e.openvpnScrapeErrorsDesc
+	ch <- e.openvpnStatusFileMtimeDesc
+	ch <- e.openvpnCollectorSuccessDesc
+	ch <- e.openvpnCollectorDurationDesc
+	for _, collector := range e.collectors {
+		collector.Describe(ch)
+	}
 }
 
-func (e *OpenVPNExporter) Collect(ch chan<- prometheus.Metric) {
-	for _, statusPath := range e.statusPaths {
-		err := e.collectStatusFromFile(statusPath, ch)
-		if err == nil {
-			ch <- prometheus.MustNewConstMetric(
-				e.openvpnUpDesc,
-				prometheus.GaugeValue,
-				1.0,
-				statusPath)
+// Reads a status file, giving up after the timeout of the exporter. Reads
+// of the same status file by other exporters and collectors that are
+// running are shared. See readSharedStatusFile.
+func (e *OpenVPNExporter) readStatusFile(statusPath string) (*StatusFile, error) {
+	return readSharedStatusFile(statusPath, e.timeout, 0)
+}
+
+// Collects a single status file. It returns false if the status file was
+// skipped, as none of the collectors apply to it, along with the time at
+// which the statistics were updated, if known.
+func (e *OpenVPNExporter) collectStatusFile(statusPath string, ch chan<- prometheus.Metric) (bool, time.Time) {
+	start := time.Now()
+	file, err := e.readStatusFile(statusPath)
+	if err != nil {
+		slog.Error("Failed to read status file", "status_path", statusPath, "err", err)
+		if _, ok := err.(statusParseError); ok {
+			e.countError(statusPath, "parse")
 		} else {
-			log.Printf("Failed to scrape showq socket: %s", err)
+			e.countError(statusPath, "open")
+		}
+		recordScrape(statusPath, ScrapeResult{Time: start, Err: err})
+		ch <- prometheus.MustNewConstMetric(
+			e.openvpnUpDesc,
+			prometheus.GaugeValue,
+			0.0,
+			statusPath)
+		ch <- prometheus.MustNewConstMetric(
+			e.openvpnScrapeDurationDesc,
+			prometheus.GaugeValue,
+			time.Since(start).Seconds(),
+			statusPath)
+		return true, time.Time{}
+	}
+	var collectors []StatusCollector
+	for _, collector := range e.collectors {
+		if collector.appliesTo(file) {
+			collectors = append(collectors, collector)
+		}
+	}
+	// Files of a kind for which all collectors are disabled, such as
+	// stray client status files matched by a server-focused deployment,
+	// are skipped without exporting any metrics.
+	if len(collectors) == 0 {
+		slog.Debug("Skipping status file, as no enabled collector applies to it", "status_path", statusPath)
+		recordScrape(statusPath, ScrapeResult{Time: start, Skipped: true})
+		return false, time.Time{}
+	}
+	result := ScrapeResult{
+		Time:    start,
+		Server:  file.Server,
+		Clients: len(file.Entries["CLIENT_LIST"]),
+		State:   file.State,
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.openvpnUpDesc,
+		prometheus.GaugeValue,
+		1.0,
+		statusPath)
+	if !file.ModTime.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			e.openvpnStatusFileMtimeDesc,
+			prometheus.GaugeValue,
+			float64(file.ModTime.UnixNano())/1e9,
+			statusPath)
+	}
+	if updated, ok := file.updateTime(); ok {
+		result.Updated = updated
+		if e.staleThreshold > 0 && time.Since(updated) > e.staleThreshold {
+			e.countError(statusPath, "stale")
+			result.Err = fmt.Errorf("stale, as it wasn't updated for over %s", e.staleThreshold)
+		}
+	}
+
+	for _, collector := range collectors {
+		collectorStart := time.Now()
+		err := collector.collect(statusPath, file, ch)
+		duration := time.Since(collectorStart).Seconds()
+
+		success := 1.0
+		if err != nil {
+			slog.Error("Failed to collect", "collector", collector.Name(), "status_path", statusPath, "err", err)
+			e.countError(statusPath, "parse")
+			success = 0.0
+			if result.Err == nil {
+				result.Err = fmt.Errorf("collector %s: %s", collector.Name(), err)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.openvpnCollectorSuccessDesc,
+			prometheus.GaugeValue,
+			success,
+			statusPath,
+			collector.Name())
+		ch <- prometheus.MustNewConstMetric(
+			e.openvpnCollectorDurationDesc,
+			prometheus.GaugeValue,
+			duration,
+			statusPath,
+			collector.Name())
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.openvpnScrapeDurationDesc,
+		prometheus.GaugeValue,
+		time.Since(start).Seconds(),
+		statusPath)
+	recordScrape(statusPath, result)
+	return true, result.Updated
+}
+
+// Collects a status file, or serves its metrics as last collected if they
+// are still valid. It returns false if the status file was skipped.
+func (e *OpenVPNExporter) collectCachedStatusFile(statusPath string, ch chan<- prometheus.Metric) bool {
+	watched := !strings.Contains(statusPath, "://") && e.isWatched(statusPath)
+	if e.cacheTTL <= 0 && !watched {
+		collected, _ := e.collectStatusFile(statusPath, ch)
+		return collected
+	}
+	// Concurrent scrapes wait for the collection in progress, rather
+	// than starting one of their own.
+	cache := e.cachedStatusFile(statusPath)
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	writes := cache.writes.Load()
+	if !cache.collected ||
+		(watched && writes != cache.collectedWrites) ||
+		(e.cacheTTL > 0 && time.Now().After(cache.expires)) ||
+		(!cache.staleAt.IsZero() && time.Now().After(cache.staleAt)) {
+		metrics := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		var collected []prometheus.Metric
+		go func() {
+			for metric := range metrics {
+				collected = append(collected, metric)
+			}
+			close(done)
+		}()
+		ok, updated := e.collectStatusFile(statusPath, metrics)
+		close(metrics)
+		<-done
+		cache.collected = true
+		cache.collectedWrites = writes
+		cache.expires = time.Now().Add(e.cacheTTL)
+		cache.metrics = collected
+		cache.skipped = !ok
+		cache.staleAt = time.Time{}
+		if e.staleThreshold > 0 && !updated.IsZero() {
+			cache.staleAt = updated.Add(e.staleThreshold)
+		}
+	}
+	for _, metric := range cache.metrics {
+		ch <- metric
+	}
+	return !cache.skipped
+}
+
+// Collects the status files using a pool of workers, so that a slow
+// status file doesn't delay the collection of the others.
+func (e *OpenVPNExporter) Collect(ch chan<- prometheus.Metric) {
+	var (
+		skippedMutex sync.Mutex
+		skipped      = map[string]bool{}
+		wg           sync.WaitGroup
+	)
+	expanded := expandStatusPaths(e.statusPaths)
+	statusPaths := make(chan string)
+	for i := 0; i < e.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for statusPath := range statusPaths {
+				if !e.collectCachedStatusFile(statusPath, ch) {
+					skippedMutex.Lock()
+					skipped[statusPath] = true
+					skippedMutex.Unlock()
+				}
+			}
+		}()
+	}
+	for _, statusPath := range expanded {
+		statusPaths <- statusPath
+	}
+	close(statusPaths)
+	wg.Wait()
+
+	e.errorsMutex.Lock()
+	defer e.errorsMutex.Unlock()
+	for _, statusPath := range expanded {
+		if skipped[statusPath] {
+			continue
+		}
+		for _, reason := range scrapeErrorReasons {
 			ch <- prometheus.MustNewConstMetric(
-				e.openvpnUpDesc,
-				prometheus.GaugeValue,
-				0.0,
-				statusPath)
+				e.openvpnScrapeErrorsDesc,
+				prometheus.CounterValue,
+				e.errors[[2]string{statusPath, reason}],
+				statusPath,
+				reason)
 		}
 	}
 }
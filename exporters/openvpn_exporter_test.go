@@ -0,0 +1,60 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchedStaleStatusFile(t *testing.T) {
+	statusPath := filepath.Join(t.TempDir(), "client.status")
+	updated := time.Now().Add(-time.Hour)
+	status := "OpenVPN STATISTICS\n" +
+		"Updated," + updated.Format("2006-01-02 15:04:05") + "\n" +
+		"TUN/TAP read bytes,153789941\n" +
+		"END\n"
+	if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewOpenVPNExporter([]string{statusPath}, []StatusCollector{NewClientStatusCollector(false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	e.SetStaleThreshold(time.Minute)
+	if err := e.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+
+	// A status file that is no longer written to is counted as stale on
+	// every scrape, rather than being served from the cache.
+	for i := 1; i <= 2; i++ {
+		sharedReadsMutex.Lock()
+		delete(sharedReads, statusPath)
+		sharedReadsMutex.Unlock()
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stale float64
+		for _, family := range families {
+			if family.GetName() != "openvpn_scrape_errors_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				for _, label := range metric.Label {
+					if label.GetName() == "reason" && label.GetValue() == "stale" {
+						stale = metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		if stale != float64(i) {
+			t.Errorf("got %v stale scrapes after scrape %d, want %d", stale, i, i)
+		}
+	}
+}
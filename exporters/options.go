@@ -0,0 +1,124 @@
+package exporters
+
+import (
+	"time"
+)
+
+// Options configure an exporter created using New. The zero value
+// collects the client list, routing table and global statistics of
+// server status files and the statistics of client status files, with
+// metrics for individual clients, like the openvpn_exporter binary does
+// by default.
+type Options struct {
+	// Status files to collect, which may also be management interfaces
+	// (see ManagementStatusPath) or glob patterns.
+	StatusPaths []string
+
+	// Don't export metrics for individual clients and routes.
+	IgnoreIndividuals bool
+	// Number the sessions of a common name when ignoring individuals.
+	SessionIndex bool
+	// Keep counters monotonic across restarts and reconnects.
+	CumulativeCounters bool
+	// Label client metrics by common name only, summing their sessions.
+	Aggregate bool
+	// Count the sessions started and ended per common name.
+	ChurnByCommonName bool
+	// Labels of client and route metrics, as accepted by
+	// CheckClientLabels and CheckRouteLabels. Defaults are used if nil.
+	ClientLabels []string
+	RouteLabels  []string
+	// Export the number of routes per common name.
+	ClientRoutes bool
+	// How to export real addresses. Kept as is if nil.
+	RealAddressPrivacy *RealAddressPrivacy
+	// Labels to attach to the metrics of each common name, if any.
+	Metadata *ClientMetadata
+
+	// Collectors that are enabled by default.
+	DisableServerStatus bool
+	DisableRouting      bool
+	DisableGlobalStats  bool
+	DisableClientStatus bool
+	// Additional columns of server status files to export, if any.
+	ColumnMappings []ColumnMapping
+	// MaxMind databases with which to count clients per autonomous
+	// system and country. Disabled if empty.
+	ASNDatabase   string
+	GeoIPDatabase string
+
+	// Maximum number of status files to collect concurrently, and the
+	// timeout for reading one. See OpenVPNExporter.SetConcurrency.
+	Concurrency int
+	Timeout     time.Duration
+	// See OpenVPNExporter.SetCacheTTL, SetStaleThreshold and Watch.
+	CacheTTL       time.Duration
+	StaleThreshold time.Duration
+	Watch          bool
+}
+
+// New creates an exporter configured by the given options. The exporter
+// is a prometheus.Collector, which can be registered on any registry.
+// Exporters should be closed once they're no longer used.
+func New(options Options) (*OpenVPNExporter, error) {
+	if err := CheckClientLabels(options.ClientLabels); err != nil {
+		return nil, err
+	}
+	if err := CheckRouteLabels(options.RouteLabels); err != nil {
+		return nil, err
+	}
+
+	var collectors []StatusCollector
+	if !options.DisableServerStatus {
+		collectors = append(collectors, NewServerStatusCollector(options.IgnoreIndividuals, options.SessionIndex, options.CumulativeCounters, options.Aggregate, options.ChurnByCommonName, options.ClientLabels, options.RealAddressPrivacy, options.Metadata))
+	}
+	if !options.DisableRouting {
+		collectors = append(collectors, NewRoutingCollector(options.IgnoreIndividuals, options.ClientRoutes, options.RouteLabels, options.RealAddressPrivacy, options.Metadata))
+	}
+	if !options.DisableGlobalStats {
+		collectors = append(collectors, NewGlobalStatsCollector())
+	}
+	if options.ColumnMappings != nil {
+		collector, err := NewColumnCollector(options.ColumnMappings, options.RealAddressPrivacy)
+		if err != nil {
+			closeCollectors(collectors)
+			return nil, err
+		}
+		collectors = append(collectors, collector)
+	}
+	if options.ASNDatabase != "" {
+		collector, err := NewASNCollector(options.ASNDatabase)
+		if err != nil {
+			closeCollectors(collectors)
+			return nil, err
+		}
+		collectors = append(collectors, collector)
+	}
+	if options.GeoIPDatabase != "" {
+		collector, err := NewGeoIPCollector(options.GeoIPDatabase, options.IgnoreIndividuals || options.Aggregate, options.Metadata)
+		if err != nil {
+			closeCollectors(collectors)
+			return nil, err
+		}
+		collectors = append(collectors, collector)
+	}
+	if !options.DisableClientStatus {
+		collectors = append(collectors, NewClientStatusCollector(options.CumulativeCounters))
+	}
+
+	exporter, err := NewOpenVPNExporter(options.StatusPaths, collectors)
+	if err != nil {
+		closeCollectors(collectors)
+		return nil, err
+	}
+	exporter.SetConcurrency(options.Concurrency, options.Timeout)
+	exporter.SetCacheTTL(options.CacheTTL)
+	exporter.SetStaleThreshold(options.StaleThreshold)
+	if options.Watch {
+		if err := exporter.Watch(); err != nil {
+			exporter.Close()
+			return nil, err
+		}
+	}
+	return exporter, nil
+}
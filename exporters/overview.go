@@ -0,0 +1,155 @@
+package exporters
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ScrapeResult is the outcome of the last scrape of a status file.
+type ScrapeResult struct {
+	// Time at which the status file was scraped.
+	Time time.Time
+	// Error reading or collecting the status file, if any.
+	Err error
+	// Whether the status file was skipped, as none of the enabled
+	// collectors apply to it.
+	Skipped bool
+	// Whether the status file contains server rather than client
+	// statistics.
+	Server bool
+	// Time at which OpenVPN updated the statistics, if known.
+	Updated time.Time
+	// Number of clients connected to a server.
+	Clients int
+	// Connection state of a client, if known.
+	State string
+}
+
+var (
+	lastScrapesMutex sync.Mutex
+	lastScrapes      = map[string]ScrapeResult{}
+)
+
+func recordScrape(statusPath string, result ScrapeResult) {
+	lastScrapesMutex.Lock()
+	lastScrapes[statusPath] = result
+	lastScrapesMutex.Unlock()
+}
+
+// LastScrape returns the outcome of the last scrape of a status file. It
+// returns false if the status file hasn't been scraped yet.
+func LastScrape(statusPath string) (ScrapeResult, bool) {
+	lastScrapesMutex.Lock()
+	defer lastScrapesMutex.Unlock()
+	result, ok := lastScrapes[statusPath]
+	return result, ok
+}
+
+// OverviewSource is a status source listed on the overview page and by the
+// clients API, under the name given to it, if any.
+type OverviewSource struct {
+	Name       string
+	StatusPath string
+}
+
+// The contents of the overview page.
+type overviewPage struct {
+	MetricsPath string
+	Rows        []overviewRow
+}
+
+// A row of the overview page, for a single status file.
+type overviewRow struct {
+	Name       string
+	StatusPath string
+	Scraped    bool
+	Result     ScrapeResult
+}
+
+var overviewTemplate = template.Must(template.New("overview").Funcs(template.FuncMap{
+	"timestamp": func(t time.Time) string {
+		if t.IsZero() {
+			return "unknown"
+		}
+		return fmt.Sprintf("%s (%s ago)", t.Format("2006-01-02 15:04:05 MST"), time.Since(t).Truncate(time.Second))
+	},
+}).Parse(`<html>
+<head>
+<title>OpenVPN Exporter</title>
+<style>
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.ok { color: green; }
+.error { color: red; }
+</style>
+</head>
+<body>
+<h1>OpenVPN Exporter</h1>
+<p><a href="{{.MetricsPath}}">Metrics</a></p>
+<table>
+<tr><th>Source</th><th>Status path</th><th>Last scrape</th><th>Result</th><th>Updated</th><th>Clients</th></tr>
+{{- range .Rows}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{.StatusPath}}</td>
+{{- if not .Scraped}}
+<td colspan="4">Not scraped yet</td>
+{{- else}}
+<td>{{timestamp .Result.Time}}</td>
+{{- if .Result.Err}}
+<td class="error" colspan="3">{{.Result.Err}}</td>
+{{- else if .Result.Skipped}}
+<td colspan="3">Skipped, as no enabled collector applies to it</td>
+{{- else}}
+<td class="ok">OK</td>
+<td>{{timestamp .Result.Updated}}</td>
+<td>{{if .Result.Server}}{{.Result.Clients}}{{else}}Client{{with .Result.State}}, {{.}}{{end}}{{end}}</td>
+{{- end}}
+{{- end}}
+</tr>
+{{- else}}
+<tr><td colspan="6">No status sources</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// OverviewHandler serves a page listing the status sources along with the
+// outcome of their last scrape, when the statistics were last updated and
+// the number of connected clients, for a quick look at the exporter
+// without querying Prometheus.
+type OverviewHandler struct {
+	metricsPath string
+	sources     func() []OverviewSource
+}
+
+// NewOverviewHandler creates a handler listing the sources returned by the
+// given function, which may change over time, e.g. when reloading the
+// configuration file. Status paths that are glob patterns are expanded.
+func NewOverviewHandler(metricsPath string, sources func() []OverviewSource) *OverviewHandler {
+	return &OverviewHandler{
+		metricsPath: metricsPath,
+		sources:     sources,
+	}
+}
+
+func (h *OverviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rows []overviewRow
+	for _, source := range h.sources() {
+		for _, statusPath := range expandStatusPaths([]string{source.StatusPath}) {
+			result, scraped := LastScrape(statusPath)
+			rows = append(rows, overviewRow{
+				Name:       source.Name,
+				StatusPath: statusPath,
+				Scraped:    scraped,
+				Result:     result,
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	overviewTemplate.Execute(w, overviewPage{MetricsPath: h.metricsPath, Rows: rows})
+}
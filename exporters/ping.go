@@ -0,0 +1,253 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Returns the CLIENT_LIST entries of a server status file, with the
+// values of each entry indexed by column name. Client status files have
+// no such entries.
+func readServerClientList(statusPath string) ([]map[string]string, error) {
+	file, err := readRecentStatusFile(statusPath)
+	if err != nil {
+		return nil, err
+	}
+	return file.rows("CLIENT_LIST")
+}
+
+type clientPingTarget struct {
+	statusPath     string
+	commonName     string
+	virtualAddress string
+}
+
+type clientPingResult struct {
+	rtt      time.Duration
+	received int
+}
+
+// ClientPingCollector periodically sends ICMP echo requests to the
+// virtual address of every client connected to the OpenVPN servers,
+// measuring the round-trip time and packet loss of their tunnels.
+// Unless privileged mode is enabled, unprivileged ICMP sockets are used,
+// which on Linux requires the net.ipv4.ping_group_range sysctl to include
+// the group of the exporter.
+type ClientPingCollector struct {
+	statusPaths func() []string
+	interval    time.Duration
+	timeout     time.Duration
+	count       int
+	concurrency int
+	privileged  bool
+	limiter     <-chan time.Time
+
+	rttDesc  *prometheus.Desc
+	lossDesc *prometheus.Desc
+
+	mutex   sync.Mutex
+	results map[clientPingTarget]clientPingResult
+}
+
+// Maximum number of echo requests per second that ClientPingCollector can
+// be configured to send.
+const MaxPingRate = 10000
+
+// NewClientPingCollector creates a collector that pings every client each
+// interval, sending count echo requests to each, to up to concurrency
+// clients at a time and no more than rate per second, which is capped at
+// MaxPingRate.
+func NewClientPingCollector(statusPaths func() []string, interval time.Duration, timeout time.Duration, count int, concurrency int, rate int, privileged bool) *ClientPingCollector {
+	return &ClientPingCollector{
+		statusPaths: statusPaths,
+		interval:    interval,
+		timeout:     timeout,
+		count:       count,
+		concurrency: concurrency,
+		privileged:  privileged,
+		limiter:     time.Tick(time.Second / time.Duration(max(1, min(rate, MaxPingRate)))),
+		rttDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_ping_rtt_seconds"),
+			"Average round-trip time of ICMP echo requests sent to the client's virtual address, in seconds.",
+			[]string{"status_path", "common_name", "virtual_address"}, nil),
+		lossDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_ping_loss_ratio"),
+			"Fraction of ICMP echo requests sent to the client's virtual address that remained unanswered.",
+			[]string{"status_path", "common_name", "virtual_address"}, nil),
+		results: map[clientPingTarget]clientPingResult{},
+	}
+}
+
+// Sends echo requests to a single address, returning the sum of the
+// round-trip times and the number of replies received.
+func (c *ClientPingCollector) ping(ip net.IP) (time.Duration, int, error) {
+	var network, listenAddress string
+	var protocol int
+	var requestType, replyType icmp.Type
+	if ip.To4() != nil {
+		network, listenAddress, protocol = "udp4", "0.0.0.0", 1
+		requestType, replyType = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+		if c.privileged {
+			network = "ip4:icmp"
+		}
+	} else {
+		network, listenAddress, protocol = "udp6", "::", 58
+		requestType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		if c.privileged {
+			network = "ip6:ipv6-icmp"
+		}
+	}
+	var destination net.Addr = &net.UDPAddr{IP: ip}
+	if c.privileged {
+		destination = &net.IPAddr{IP: ip}
+	}
+
+	conn, err := icmp.ListenPacket(network, listenAddress)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	var total time.Duration
+	received := 0
+	buf := make([]byte, 1500)
+	for seq := 0; seq < c.count; seq++ {
+		<-c.limiter
+		request, err := (&icmp.Message{
+			Type: requestType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("openvpn_exporter")},
+		}).Marshal(nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		start := time.Now()
+		if _, err := conn.WriteTo(request, destination); err != nil {
+			return 0, 0, err
+		}
+		conn.SetReadDeadline(start.Add(c.timeout))
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				// Timed out waiting for a reply.
+				break
+			}
+			reply, err := icmp.ParseMessage(protocol, buf[:n])
+			if err != nil || reply.Type != replyType {
+				continue
+			}
+			// Raw sockets receive replies destined to other
+			// sockets as well.
+			var peerIP net.IP
+			switch peer := peer.(type) {
+			case *net.UDPAddr:
+				peerIP = peer.IP
+			case *net.IPAddr:
+				peerIP = peer.IP
+			}
+			echo, ok := reply.Body.(*icmp.Echo)
+			if !ok || echo.Seq != seq || !peerIP.Equal(ip) || (c.privileged && echo.ID != id) {
+				continue
+			}
+			total += time.Since(start)
+			received++
+			break
+		}
+	}
+	return total, received, nil
+}
+
+func (c *ClientPingCollector) pingAll() {
+	targets := map[clientPingTarget]net.IP{}
+	for _, statusPath := range expandStatusPaths(c.statusPaths()) {
+		clients, err := readServerClientList(statusPath)
+		if err != nil {
+			slog.Error("Failed to read clients", "status_path", statusPath, "err", err)
+			continue
+		}
+		for _, client := range clients {
+			// TAP clients have a MAC address instead.
+			if ip := net.ParseIP(client["Virtual Address"]); ip != nil {
+				targets[clientPingTarget{
+					statusPath:     statusPath,
+					commonName:     client["Common Name"],
+					virtualAddress: client["Virtual Address"],
+				}] = ip
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, c.concurrency)
+	results := map[clientPingTarget]clientPingResult{}
+	var resultsMutex sync.Mutex
+	for target, ip := range targets {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(target clientPingTarget, ip net.IP) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			total, received, err := c.ping(ip)
+			if err != nil {
+				slog.Debug("Failed to ping client", "address", target.virtualAddress, "err", err)
+				return
+			}
+			result := clientPingResult{received: received}
+			if received > 0 {
+				result.rtt = total / time.Duration(received)
+			}
+			resultsMutex.Lock()
+			results[target] = result
+			resultsMutex.Unlock()
+		}(target, ip)
+	}
+	wg.Wait()
+
+	c.mutex.Lock()
+	c.results = results
+	c.mutex.Unlock()
+}
+
+// Run pings all connected clients at the configured interval. It never
+// returns.
+func (c *ClientPingCollector) Run() {
+	for {
+		c.pingAll()
+		time.Sleep(c.interval)
+	}
+}
+
+func (c *ClientPingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rttDesc
+	ch <- c.lossDesc
+}
+
+func (c *ClientPingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for target, result := range c.results {
+		if result.received > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				c.rttDesc,
+				prometheus.GaugeValue,
+				result.rtt.Seconds(),
+				target.statusPath,
+				target.commonName,
+				target.virtualAddress)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.lossDesc,
+			prometheus.GaugeValue,
+			float64(c.count-result.received)/float64(c.count),
+			target.statusPath,
+			target.commonName,
+			target.virtualAddress)
+	}
+}
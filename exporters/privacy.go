@@ -0,0 +1,92 @@
+package exporters
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// RealAddressPrivacy determines how the real addresses of clients are
+// exported, for setups in which client source addresses may not be stored
+// in Prometheus. They are either kept as is, dropped by removing the
+// real_address and real_ip labels, or replaced by the first 16
+// hexadecimal digits of an HMAC-SHA256 keyed with a salt. Real addresses
+// are still used internally, e.g. for telling sessions apart and matching
+// routes to clients. A nil *RealAddressPrivacy keeps real addresses.
+type RealAddressPrivacy struct {
+	mode string
+	salt []byte
+}
+
+// NewRealAddressPrivacy creates the privacy setting for the given mode:
+// keep, hash or drop. Hashes are keyed with the contents of saltFile. If
+// it's empty, a random salt is generated, in which case the hashes of
+// addresses change when the exporter is restarted.
+func NewRealAddressPrivacy(mode string, saltFile string) (*RealAddressPrivacy, error) {
+	p := &RealAddressPrivacy{mode: mode}
+	switch mode {
+	case "keep", "drop":
+		return p, nil
+	case "hash":
+	default:
+		return nil, fmt.Errorf("invalid real address privacy mode %q, should be keep, hash or drop", mode)
+	}
+
+	if saltFile == "" {
+		p.salt = make([]byte, 32)
+		if _, err := rand.Read(p.salt); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	salt, err := ioutil.ReadFile(saltFile)
+	if err != nil {
+		return nil, err
+	}
+	p.salt = []byte(strings.TrimSpace(string(salt)))
+	if len(p.salt) == 0 {
+		return nil, fmt.Errorf("%s: salt is empty", saltFile)
+	}
+	return p, nil
+}
+
+// Removes the real_address and real_ip labels and their columns from the
+// labels of an entry when dropping real addresses.
+func (p *RealAddressPrivacy) labels(names []string, columns []string) ([]string, []string) {
+	if p == nil || p.mode != "drop" {
+		return names, columns
+	}
+	var keptNames, keptColumns []string
+	for i, column := range columns {
+		if !isRealAddressColumn(column) {
+			keptNames = append(keptNames, names[i])
+			keptColumns = append(keptColumns, column)
+		}
+	}
+	return keptNames, keptColumns
+}
+
+// Returns whether a column holds the real address of a client, or a part
+// of it.
+func isRealAddressColumn(column string) bool {
+	return column == "Real Address" || column == "Real IP"
+}
+
+// Returns whether the real_address label is exported.
+func (p *RealAddressPrivacy) exported() bool {
+	return p == nil || p.mode != "drop"
+}
+
+// Returns the value of the real_address or real_ip label of an address.
+func (p *RealAddressPrivacy) value(address string) string {
+	if p == nil || p.mode != "hash" {
+		return address
+	}
+	mac := hmac.New(sha256.New, p.salt)
+	mac.Write([]byte(address))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
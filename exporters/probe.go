@@ -0,0 +1,142 @@
+package exporters
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"net"
+	"net/url"
+	"time"
+)
+
+// OpenVPN control channel opcodes, stored in the upper five bits of the
+// first byte of a packet.
+const (
+	openvpnHardResetClientV2 = 7
+	openvpnHardResetServerV2 = 8
+)
+
+// PortProbeCollector checks whether OpenVPN's listening ports are
+// reachable. TCP ports are probed by establishing a connection. UDP ports
+// are probed by sending a hard reset packet and waiting for the server to
+// respond, which only works for servers that don't use tls-auth or
+// tls-crypt, as those silently drop unauthenticated packets.
+type PortProbeCollector struct {
+	addresses     []string
+	timeout       time.Duration
+	reachableDesc *prometheus.Desc
+	durationDesc  *prometheus.Desc
+}
+
+func NewPortProbeCollector(addresses []string, timeout time.Duration) (*PortProbeCollector, error) {
+	for _, address := range addresses {
+		if _, _, err := parseProbeAddress(address); err != nil {
+			return nil, err
+		}
+	}
+	return &PortProbeCollector{
+		addresses: addresses,
+		timeout:   timeout,
+		reachableDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "port_reachable"),
+			"Whether the OpenVPN server port responded to a probe.",
+			[]string{"address"}, nil),
+		durationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "port_probe_duration_seconds"),
+			"Time it took to probe the OpenVPN server port, in seconds.",
+			[]string{"address"}, nil),
+	}, nil
+}
+
+// Splits a probe address of the form udp://host:port or tcp://host:port
+// into its network and host:port parts.
+func parseProbeAddress(address string) (string, string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return "", "", fmt.Errorf("probe address %q should start with udp:// or tcp://", address)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return "", "", fmt.Errorf("probe address %q: %s", address, err)
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// Sends a P_CONTROL_HARD_RESET_CLIENT_V2 packet and waits for a
+// P_CONTROL_HARD_RESET_SERVER_V2 packet in return.
+func probeUDP(hostPort string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("udp", hostPort, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Opcode and key ID, session ID, an empty ACK array and the
+	// message packet ID.
+	packet := make([]byte, 14)
+	packet[0] = openvpnHardResetClientV2 << 3
+	if _, err := rand.Read(packet[1:9]); err != nil {
+		return err
+	}
+	if _, err := conn.Write(packet); err != nil {
+		return err
+	}
+
+	response := make([]byte, 1500)
+	n, err := conn.Read(response)
+	if err != nil {
+		return err
+	}
+	if n == 0 || response[0]>>3 != openvpnHardResetServerV2 {
+		return fmt.Errorf("unexpected response from %s", hostPort)
+	}
+	return nil
+}
+
+func (c *PortProbeCollector) probe(address string) error {
+	network, hostPort, err := parseProbeAddress(address)
+	if err != nil {
+		return err
+	}
+	if network == "udp" {
+		return probeUDP(hostPort, c.timeout)
+	}
+	conn, err := net.DialTimeout("tcp", hostPort, c.timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (c *PortProbeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.reachableDesc
+	ch <- c.durationDesc
+}
+
+func (c *PortProbeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, address := range c.addresses {
+		start := time.Now()
+		err := c.probe(address)
+		duration := time.Since(start).Seconds()
+
+		reachable := 1.0
+		if err != nil {
+			slog.Debug("Failed to probe port", "address", address, "err", err)
+			reachable = 0.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.reachableDesc,
+			prometheus.GaugeValue,
+			reachable,
+			address)
+		ch <- prometheus.MustNewConstMetric(
+			c.durationDesc,
+			prometheus.GaugeValue,
+			duration,
+			address)
+	}
+}
@@ -0,0 +1,170 @@
+package exporters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock ticks per second in which /proc/<pid>/stat reports the start time
+// of processes. It's 100 on all architectures supported by Linux.
+const userHZ = 100
+
+// An OpenVPN daemon, identified by its pid file or systemd unit.
+type openvpnProcess struct {
+	name    string
+	pidFile string
+	unit    string
+}
+
+// ProcessCollector checks whether OpenVPN daemons are running, given the
+// pid file they write (--writepid) or the systemd unit they run under, so
+// that a daemon that crashed can be told apart from one whose status file
+// is merely unchanged. Processes are looked up in /proc on every scrape,
+// so this only works on Linux.
+type ProcessCollector struct {
+	processes     []openvpnProcess
+	timeout       time.Duration
+	upDesc        *prometheus.Desc
+	startTimeDesc *prometheus.Desc
+}
+
+// NewProcessCollector creates a collector for the daemons writing the pid
+// files and running under the systemd units, which are written as
+// <name>:<path> and <name>:<unit> to set their instance_name label, like
+// status paths. Without a name, the instance_name is the path or unit.
+// The timeout limits querying systemd.
+func NewProcessCollector(pidFiles []string, units []string, timeout time.Duration) *ProcessCollector {
+	c := &ProcessCollector{
+		timeout: timeout,
+		upDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "process", "up"),
+			"Whether the OpenVPN daemon is running.",
+			[]string{"instance_name"}, nil),
+		startTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "process", "start_time_seconds"),
+			"UNIX timestamp at which the running OpenVPN daemon was started.",
+			[]string{"instance_name"}, nil),
+	}
+	for _, pidFile := range pidFiles {
+		name, pidFile := SplitInstanceName(pidFile)
+		if name == "" {
+			name = pidFile
+		}
+		c.processes = append(c.processes, openvpnProcess{name: name, pidFile: pidFile})
+	}
+	for _, unit := range units {
+		name, unit := SplitInstanceName(unit)
+		if name == "" {
+			name = unit
+		}
+		c.processes = append(c.processes, openvpnProcess{name: name, unit: unit})
+	}
+	return c
+}
+
+// Returns the process ID of the daemon, or zero if it isn't running
+// according to systemd.
+func (c *ProcessCollector) pid(process openvpnProcess) (int, error) {
+	if process.pidFile != "" {
+		data, err := ioutil.ReadFile(process.pidFile)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "systemctl", "show", "--property=MainPID", "--value", process.unit).Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+// Returns the time at which the OpenVPN process with the given ID was
+// started. Processes of other programs, e.g. those that took over the
+// process ID of a daemon that crashed, aren't accepted.
+func processStartTime(pid int) (float64, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// <pid> (<comm>) <state> ..., where the command name may contain
+	// spaces and parentheses.
+	open, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return 0, fmt.Errorf("unexpected contents of /proc/%d/stat", pid)
+	}
+	if comm := string(stat[open+1 : end]); !strings.HasPrefix(comm, "openvpn") {
+		return 0, fmt.Errorf("process %d is %s rather than openvpn", pid, comm)
+	}
+	// The start time is the 22nd field, the 20th after the command name.
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("unexpected contents of /proc/%d/stat", pid)
+	}
+	ticks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	// The start time is relative to the boot time.
+	procStat, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(procStat), "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			bootTime, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return float64(bootTime) + float64(ticks)/userHZ, nil
+		}
+	}
+	return 0, fmt.Errorf("boot time missing from /proc/stat")
+}
+
+func (c *ProcessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.upDesc
+	ch <- c.startTimeDesc
+}
+
+func (c *ProcessCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, process := range c.processes {
+		up := 0.0
+		pid, err := c.pid(process)
+		if err == nil && pid == 0 {
+			err = fmt.Errorf("unit %s isn't running", process.unit)
+		}
+		if err == nil {
+			var startTime float64
+			startTime, err = processStartTime(pid)
+			if err == nil {
+				up = 1
+				ch <- prometheus.MustNewConstMetric(
+					c.startTimeDesc,
+					prometheus.GaugeValue,
+					startTime,
+					process.name)
+			}
+		}
+		if err != nil {
+			slog.Debug("OpenVPN daemon isn't running", "instance_name", process.name, "err", err)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.upDesc,
+			prometheus.GaugeValue,
+			up,
+			process.name)
+	}
+}
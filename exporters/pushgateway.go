@@ -0,0 +1,103 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PushgatewayPusher periodically pushes the metrics of the exporter to a
+// Prometheus Pushgateway, for sites where Prometheus can't reach the VPN
+// servers, e.g. because they're behind NAT. Metrics are pushed under the
+// grouping key job=<job>,instance=<instance>, replacing those pushed
+// previously, so that metrics of disconnected clients disappear.
+type PushgatewayPusher struct {
+	url      string
+	gatherer prometheus.Gatherer
+	interval time.Duration
+	client   *http.Client
+}
+
+// NewPushgatewayPusher creates a pusher for the Pushgateway at gatewayURL,
+// which may contain credentials for basic authentication. The instance
+// label is left out of the grouping key if it's empty.
+func NewPushgatewayPusher(gatewayURL string, job string, instance string, gatherer prometheus.Gatherer, interval time.Duration, timeout time.Duration) (*PushgatewayPusher, error) {
+	if !strings.Contains(gatewayURL, "://") {
+		gatewayURL = "http://" + gatewayURL
+	}
+	if _, err := url.Parse(gatewayURL); err != nil {
+		return nil, err
+	}
+	if job == "" {
+		return nil, fmt.Errorf("job name is empty")
+	}
+	pushURL := strings.TrimSuffix(gatewayURL, "/") + "/metrics" + groupingKeyPath("job", job)
+	if instance != "" {
+		pushURL += groupingKeyPath("instance", instance)
+	}
+	return &PushgatewayPusher{
+		url:      pushURL,
+		gatherer: gatherer,
+		interval: interval,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Returns the path component of a grouping key label. Values containing
+// slashes can't be escaped in paths, so they're base64 encoded instead.
+func groupingKeyPath(name string, value string) string {
+	if strings.Contains(value, "/") {
+		return "/" + name + "@base64/" + base64.URLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + name + "/" + url.PathEscape(value)
+}
+
+// Push gathers the metrics and pushes them to the Pushgateway.
+func (p *PushgatewayPusher) Push() error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	encoder := expfmt.NewEncoder(&body, expfmt.FmtProtoDelim)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPut, p.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(expfmt.FmtProtoDelim))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Older versions of the Pushgateway respond with 202 Accepted.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Run pushes the metrics every interval. It never returns.
+func (p *PushgatewayPusher) Run() {
+	for {
+		if err := p.Push(); err != nil {
+			slog.Error("Failed to push metrics to Pushgateway", "err", err)
+		}
+		time.Sleep(p.interval)
+	}
+}
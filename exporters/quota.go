@@ -0,0 +1,304 @@
+package exporters
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Traffic quota of a single common name.
+type clientQuota struct {
+	bytes    float64
+	resetDay int
+}
+
+// Accumulated traffic of a common name within its current quota period.
+type clientQuotaUsage struct {
+	periodStart time.Time
+	bytes       float64
+}
+
+// Identifies a single connection listed in a CLIENT_LIST.
+type clientSession struct {
+	statusPath     string
+	commonName     string
+	realAddress    string
+	connectedSince string
+}
+
+// Parses a quota file. Every line consists of a common name, its quota
+// in bytes and optionally the day of the month at which the quota is
+// reset, defaulting to the first day of the month. Lines starting with
+// '#' are ignored.
+func readQuotaFile(path string) (map[string]clientQuota, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	quotas := map[string]clientQuota{}
+	for _, record := range records {
+		if len(record) != 2 && len(record) != 3 {
+			return nil, fmt.Errorf("%s: expected common name, quota and optional reset day, got %q", path, record)
+		}
+		bytes, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid quota for %s: %s", path, record[0], err)
+		}
+		resetDay := 1
+		if len(record) == 3 {
+			resetDay, err = strconv.Atoi(record[2])
+			if err != nil || resetDay < 1 || resetDay > 31 {
+				return nil, fmt.Errorf("%s: invalid reset day for %s: %q", path, record[0], record[2])
+			}
+		}
+		quotas[record[0]] = clientQuota{bytes: bytes, resetDay: resetDay}
+	}
+	return quotas, nil
+}
+
+// Returns the start of the quota period containing now, for quotas that
+// are reset at the given day of the month. Days that don't exist in a
+// month are clamped to its last day.
+func quotaPeriodStart(now time.Time, resetDay int) time.Time {
+	start := func(year int, month time.Month) time.Time {
+		lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, now.Location()).Day()
+		day := resetDay
+		if day > lastDay {
+			day = lastDay
+		}
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	}
+	if s := start(now.Year(), now.Month()); !s.After(now) {
+		return s
+	}
+	return start(now.Year(), now.Month()-1)
+}
+
+// QuotaCollector periodically accumulates the traffic of clients listed
+// in the server status files and compares it against per common name
+// quotas. Traffic is accumulated by observing the growth of each
+// connection's byte counters, so traffic that occurs between the last
+// observation and the end of a connection is not accounted for.
+type QuotaCollector struct {
+	statusPaths func() []string
+	interval    time.Duration
+	quotas      map[string]clientQuota
+
+	quotaDesc     *prometheus.Desc
+	usedDesc      *prometheus.Desc
+	remainingDesc *prometheus.Desc
+	overDesc      *prometheus.Desc
+
+	mutex    sync.Mutex
+	usage    map[string]clientQuotaUsage
+	sessions map[clientSession]float64
+}
+
+func NewQuotaCollector(statusPaths func() []string, quotaFile string, interval time.Duration) (*QuotaCollector, error) {
+	quotas, err := readQuotaFile(quotaFile)
+	if err != nil {
+		return nil, err
+	}
+	return &QuotaCollector{
+		statusPaths: statusPaths,
+		interval:    interval,
+		quotas:      quotas,
+		quotaDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_quota_bytes"),
+			"Amount of traffic the client may use per quota period, in bytes.",
+			[]string{"common_name"}, nil),
+		usedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_quota_used_bytes"),
+			"Amount of traffic the client used in the current quota period, in bytes.",
+			[]string{"common_name"}, nil),
+		remainingDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_quota_remaining_bytes"),
+			"Amount of traffic the client may still use in the current quota period, in bytes.",
+			[]string{"common_name"}, nil),
+		overDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_over_quota"),
+			"Whether the client used more traffic than its quota in the current quota period.",
+			[]string{"common_name"}, nil),
+		usage:    map[string]clientQuotaUsage{},
+		sessions: map[clientSession]float64{},
+	}, nil
+}
+
+// Adds the traffic of all connections since the previous observation to
+// the usage of their common names.
+func (c *QuotaCollector) observe(now time.Time) {
+	sessions := map[clientSession]float64{}
+	failed := map[string]bool{}
+	for _, statusPath := range expandStatusPaths(c.statusPaths()) {
+		clients, err := readServerClientList(statusPath)
+		if err != nil {
+			slog.Error("Failed to read clients", "status_path", statusPath, "err", err)
+			failed[statusPath] = true
+			continue
+		}
+		for _, client := range clients {
+			if _, ok := c.quotas[client["Common Name"]]; !ok {
+				continue
+			}
+			received, err := strconv.ParseFloat(client["Bytes Received"], 64)
+			if err != nil {
+				continue
+			}
+			sent, err := strconv.ParseFloat(client["Bytes Sent"], 64)
+			if err != nil {
+				continue
+			}
+			sessions[clientSession{
+				statusPath:     statusPath,
+				commonName:     client["Common Name"],
+				realAddress:    client["Real Address"],
+				connectedSince: client["Connected Since (time_t)"],
+			}] = received + sent
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for commonName, quota := range c.quotas {
+		periodStart := quotaPeriodStart(now, quota.resetDay)
+		if usage := c.usage[commonName]; !usage.periodStart.Equal(periodStart) {
+			c.usage[commonName] = clientQuotaUsage{periodStart: periodStart}
+		}
+	}
+	for session, bytes := range sessions {
+		delta := bytes
+		if previous, ok := c.sessions[session]; ok && previous <= bytes {
+			delta = bytes - previous
+		}
+		usage := c.usage[session.commonName]
+		usage.bytes += delta
+		c.usage[session.commonName] = usage
+	}
+	// Sessions of status files that failed to be read are kept, so that
+	// their traffic isn't counted again once they can be read.
+	for session, bytes := range c.sessions {
+		if failed[session.statusPath] {
+			sessions[session] = bytes
+		}
+	}
+	c.sessions = sessions
+}
+
+// Run accumulates client traffic at the configured interval. It never
+// returns.
+func (c *QuotaCollector) Run() {
+	for {
+		c.observe(time.Now())
+		time.Sleep(c.interval)
+	}
+}
+
+func (c *QuotaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.quotaDesc
+	ch <- c.usedDesc
+	ch <- c.remainingDesc
+	ch <- c.overDesc
+}
+
+func (c *QuotaCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for commonName, quota := range c.quotas {
+		used := c.usage[commonName].bytes
+		remaining, over := quota.bytes-used, 0.0
+		if remaining < 0 {
+			remaining, over = 0, 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.quotaDesc,
+			prometheus.GaugeValue,
+			quota.bytes,
+			commonName)
+		ch <- prometheus.MustNewConstMetric(
+			c.usedDesc,
+			prometheus.GaugeValue,
+			used,
+			commonName)
+		ch <- prometheus.MustNewConstMetric(
+			c.remainingDesc,
+			prometheus.GaugeValue,
+			remaining,
+			commonName)
+		ch <- prometheus.MustNewConstMetric(
+			c.overDesc,
+			prometheus.GaugeValue,
+			over,
+			commonName)
+	}
+}
+
+type quotaUsageState struct {
+	PeriodStart time.Time `json:"period_start"`
+	Bytes       float64   `json:"bytes"`
+}
+
+type quotaState struct {
+	Usage    map[string]quotaUsageState `json:"usage"`
+	Sessions map[string]float64         `json:"sessions"`
+}
+
+// SaveState returns the accumulated traffic per common name, together
+// with the traffic of the connections seen during the last observation.
+func (c *QuotaCollector) SaveState() (json.RawMessage, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	state := quotaState{
+		Usage:    map[string]quotaUsageState{},
+		Sessions: map[string]float64{},
+	}
+	for commonName, usage := range c.usage {
+		state.Usage[commonName] = quotaUsageState{PeriodStart: usage.periodStart, Bytes: usage.bytes}
+	}
+	for session, bytes := range c.sessions {
+		key := strings.Join([]string{session.statusPath, session.commonName, session.realAddress, session.connectedSince}, "\x00")
+		state.Sessions[key] = bytes
+	}
+	return json.Marshal(state)
+}
+
+// LoadState restores the accumulated traffic per common name.
+func (c *QuotaCollector) LoadState(data json.RawMessage) error {
+	var state quotaState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for commonName, usage := range state.Usage {
+		c.usage[commonName] = clientQuotaUsage{periodStart: usage.PeriodStart, bytes: usage.Bytes}
+	}
+	for key, bytes := range state.Sessions {
+		fields := strings.Split(key, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		c.sessions[clientSession{
+			statusPath:     fields[0],
+			commonName:     fields[1],
+			realAddress:    fields[2],
+			connectedSince: fields[3],
+		}] = bytes
+	}
+	return nil
+}
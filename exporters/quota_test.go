@@ -0,0 +1,56 @@
+package exporters
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQuotaCollectorReadFailure(t *testing.T) {
+	dir := t.TempDir()
+	quotaFile := filepath.Join(dir, "quotas.csv")
+	if err := os.WriteFile(quotaFile, []byte("alice,1000000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	statusPath := filepath.Join(dir, "server.status")
+	writeStatus := func(bytes int) {
+		status := fmt.Sprintf("TITLE,OpenVPN 2.4.4\n"+
+			"TIME,Tue Mar 21 10:39:14 2017,1490089154\n"+
+			"HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username\n"+
+			"CLIENT_LIST,alice,192.0.2.1:1194,10.8.0.2,%d,0,Thu Mar 16 17:09:03 2017,1489680543,UNDEF\n"+
+			"END\n", bytes)
+		if err := os.WriteFile(statusPath, []byte(status), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	observe := func(c *QuotaCollector) float64 {
+		// Don't reuse the previous read of the status file.
+		sharedReadsMutex.Lock()
+		delete(sharedReads, statusPath)
+		sharedReadsMutex.Unlock()
+		c.observe(time.Now())
+		return c.usage["alice"].bytes
+	}
+
+	c, err := NewQuotaCollector(func() []string { return []string{statusPath} }, quotaFile, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeStatus(1000)
+	if got := observe(c); got != 1000 {
+		t.Errorf("got usage %v, want 1000", got)
+	}
+
+	// A transient failure to read the status file doesn't count the
+	// traffic of its sessions again.
+	os.Remove(statusPath)
+	if got := observe(c); got != 1000 {
+		t.Errorf("got usage %v while failing, want 1000", got)
+	}
+	writeStatus(1500)
+	if got := observe(c); got != 1500 {
+		t.Errorf("got usage %v after recovering, want 1500", got)
+	}
+}
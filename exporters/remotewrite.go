@@ -0,0 +1,220 @@
+package exporters
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoteWriter periodically gathers the metrics of the exporter and sends
+// them to a Prometheus compatible database (Prometheus, Mimir, Thanos,
+// VictoriaMetrics, ...) using the remote write protocol, like a Prometheus
+// agent scraping the exporter would. This allows monitoring VPN servers
+// that can't be scraped, e.g. because they're behind NAT. Every series is
+// sent with the given job and instance labels.
+type RemoteWriter struct {
+	url         string
+	job         string
+	instance    string
+	gatherer    prometheus.Gatherer
+	interval    time.Duration
+	client      *http.Client
+	username    string
+	password    string
+	bearerToken string
+}
+
+// NewRemoteWriter creates a writer sending to the remote write endpoint
+// at url. Requests are authenticated using basic authentication if
+// username is set, or using bearerToken if it's set.
+func NewRemoteWriter(url string, job string, instance string, gatherer prometheus.Gatherer, interval time.Duration, timeout time.Duration, username string, password string, bearerToken string, tlsConfig *tls.Config) *RemoteWriter {
+	return &RemoteWriter{
+		url:      url,
+		job:      job,
+		instance: instance,
+		gatherer: gatherer,
+		interval: interval,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		username:    username,
+		password:    password,
+		bearerToken: bearerToken,
+	}
+}
+
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+type remoteWriteSeries struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64
+}
+
+// Converts the gathered metric families to series, splitting summaries
+// and histograms into their quantiles or buckets, sum and count, as
+// Prometheus does when scraping them.
+func (w *RemoteWriter) series(families []*dto.MetricFamily, now time.Time) []remoteWriteSeries {
+	var series []remoteWriteSeries
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			timestamp := now.UnixMilli()
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+			add := func(suffix string, value float64, extra ...remoteWriteLabel) {
+				labels := []remoteWriteLabel{
+					{"__name__", family.GetName() + suffix},
+					{"job", w.job},
+					{"instance", w.instance},
+				}
+				for _, label := range metric.GetLabel() {
+					// Like Prometheus does when scraping, labels
+					// conflicting with the target labels are kept
+					// with an exported_ prefix.
+					name := label.GetName()
+					if name == "job" || name == "instance" {
+						name = "exported_" + name
+					}
+					labels = append(labels, remoteWriteLabel{name, label.GetValue()})
+				}
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool {
+					return labels[i].name < labels[j].name
+				})
+				series = append(series, remoteWriteSeries{labels: labels, value: value, timestamp: timestamp})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", metric.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add("", quantile.GetValue(), remoteWriteLabel{"quantile", formatFloat(quantile.GetQuantile())})
+				}
+				add("_sum", summary.GetSampleSum())
+				add("_count", float64(summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				infSeen := false
+				for _, bucket := range histogram.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						infSeen = true
+					}
+					add("_bucket", float64(bucket.GetCumulativeCount()), remoteWriteLabel{"le", formatFloat(bucket.GetUpperBound())})
+				}
+				if !infSeen {
+					add("_bucket", float64(histogram.GetSampleCount()), remoteWriteLabel{"le", "+Inf"})
+				}
+				add("_sum", histogram.GetSampleSum())
+				add("_count", float64(histogram.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Encodes series as a WriteRequest protocol buffer message, as defined in
+// prometheus/prompb/remote.proto.
+func encodeWriteRequest(series []remoteWriteSeries) []byte {
+	var request, timeSeries, message []byte
+	for _, s := range series {
+		timeSeries = timeSeries[:0]
+		for _, label := range s.labels {
+			message = message[:0]
+			message = appendProtobufBytes(message, 1, []byte(label.name))
+			message = appendProtobufBytes(message, 2, []byte(label.value))
+			timeSeries = appendProtobufBytes(timeSeries, 1, message)
+		}
+		message = message[:0]
+		message = binary.AppendUvarint(message, 1<<3|1)
+		message = binary.LittleEndian.AppendUint64(message, math.Float64bits(s.value))
+		message = binary.AppendUvarint(message, 2<<3|0)
+		message = binary.AppendUvarint(message, uint64(s.timestamp))
+		timeSeries = appendProtobufBytes(timeSeries, 2, message)
+		request = appendProtobufBytes(request, 1, timeSeries)
+	}
+	return request
+}
+
+// Appends a length-delimited protocol buffer field.
+func appendProtobufBytes(b []byte, field uint64, value []byte) []byte {
+	b = binary.AppendUvarint(b, field<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// Write gathers the metrics and sends them to the remote write endpoint.
+func (w *RemoteWriter) Write() error {
+	now := time.Now()
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(w.series(families, now)))
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "openvpn_exporter")
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	} else if w.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Run sends the metrics every interval. It never returns.
+func (w *RemoteWriter) Run() {
+	for {
+		if err := w.Write(); err != nil {
+			slog.Error("Failed to send metrics using remote write", "url", w.url, "err", err)
+		}
+		time.Sleep(w.interval)
+	}
+}
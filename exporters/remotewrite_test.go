@@ -0,0 +1,115 @@
+package exporters
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The messages of prometheus/prompb/types.proto and remote.proto, for
+// decoding requests using the protocol buffer library.
+type prompbLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name"`
+	Value string `protobuf:"bytes,2,opt,name=value"`
+}
+
+func (m *prompbLabel) Reset()         { *m = prompbLabel{} }
+func (m *prompbLabel) String() string { return proto.CompactTextString(m) }
+func (*prompbLabel) ProtoMessage()    {}
+
+type prompbSample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp"`
+}
+
+func (m *prompbSample) Reset()         { *m = prompbSample{} }
+func (m *prompbSample) String() string { return proto.CompactTextString(m) }
+func (*prompbSample) ProtoMessage()    {}
+
+type prompbTimeSeries struct {
+	Labels  []*prompbLabel  `protobuf:"bytes,1,rep,name=labels"`
+	Samples []*prompbSample `protobuf:"bytes,2,rep,name=samples"`
+}
+
+func (m *prompbTimeSeries) Reset()         { *m = prompbTimeSeries{} }
+func (m *prompbTimeSeries) String() string { return proto.CompactTextString(m) }
+func (*prompbTimeSeries) ProtoMessage()    {}
+
+type prompbWriteRequest struct {
+	Timeseries []*prompbTimeSeries `protobuf:"bytes,1,rep,name=timeseries"`
+}
+
+func (m *prompbWriteRequest) Reset()         { *m = prompbWriteRequest{} }
+func (m *prompbWriteRequest) String() string { return proto.CompactTextString(m) }
+func (*prompbWriteRequest) ProtoMessage()    {}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	series := []remoteWriteSeries{
+		{
+			labels: []remoteWriteLabel{
+				{"__name__", "openvpn_up"},
+				{"instance", "vpn"},
+				{"job", "openvpn"},
+				{"status_path", "/var/run/openvpn/server.status"},
+			},
+			value:     1,
+			timestamp: 1700000000000,
+		},
+		{
+			labels:    []remoteWriteLabel{{"__name__", "openvpn_server_route_last_reference_time"}},
+			value:     math.Inf(1),
+			timestamp: 0,
+		},
+	}
+
+	var request prompbWriteRequest
+	if err := proto.Unmarshal(encodeWriteRequest(series), &request); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Timeseries) != len(series) {
+		t.Fatalf("got %d series, want %d", len(request.Timeseries), len(series))
+	}
+	for i, s := range series {
+		got := request.Timeseries[i]
+		if len(got.Labels) != len(s.labels) {
+			t.Fatalf("series %d: got %d labels, want %d", i, len(got.Labels), len(s.labels))
+		}
+		for j, label := range s.labels {
+			if got.Labels[j].Name != label.name || got.Labels[j].Value != label.value {
+				t.Errorf("series %d: got label %s=%q, want %s=%q", i, got.Labels[j].Name, got.Labels[j].Value, label.name, label.value)
+			}
+		}
+		if len(got.Samples) != 1 || got.Samples[0].Value != s.value || got.Samples[0].Timestamp != s.timestamp {
+			t.Errorf("series %d: got samples %v, want %v at %d", i, got.Samples, s.value, s.timestamp)
+		}
+	}
+}
+
+func TestRemoteWriterSeries(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "Test."}, []string{"instance"})
+	counter.WithLabelValues("server").Add(3)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "Test.", Buckets: []float64{1}})
+	histogram.Observe(0.5)
+	registry.MustRegister(counter, histogram)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewRemoteWriter("", "openvpn", "vpn", registry, time.Minute, time.Second, "", "", "", nil)
+	now := time.Unix(1700000000, 0)
+	want := []remoteWriteSeries{
+		{[]remoteWriteLabel{{"__name__", "test_seconds_bucket"}, {"instance", "vpn"}, {"job", "openvpn"}, {"le", "1"}}, 1, now.UnixMilli()},
+		{[]remoteWriteLabel{{"__name__", "test_seconds_bucket"}, {"instance", "vpn"}, {"job", "openvpn"}, {"le", "+Inf"}}, 1, now.UnixMilli()},
+		{[]remoteWriteLabel{{"__name__", "test_seconds_sum"}, {"instance", "vpn"}, {"job", "openvpn"}}, 0.5, now.UnixMilli()},
+		{[]remoteWriteLabel{{"__name__", "test_seconds_count"}, {"instance", "vpn"}, {"job", "openvpn"}}, 1, now.UnixMilli()},
+		{[]remoteWriteLabel{{"__name__", "test_total"}, {"exported_instance", "server"}, {"instance", "vpn"}, {"job", "openvpn"}}, 3, now.UnixMilli()},
+	}
+	if got := w.series(families, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got series %v, want %v", got, want)
+	}
+}
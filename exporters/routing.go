@@ -0,0 +1,179 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RoutingCollector converts the routing table of OpenVPN server status
+// files into Prometheus metrics.
+type RoutingCollector struct {
+	routeHeader         OpenvpnServerHeader
+	routesDesc          *prometheus.Desc
+	clientRoutesDesc    *prometheus.Desc
+	orphanRoutesDesc    *prometheus.Desc
+	unroutedClientsDesc *prometheus.Desc
+	collisionsDesc      *prometheus.Desc
+	metadata            *ClientMetadata
+}
+
+// NewRoutingCollector creates a collector for the routing table of server
+// status files. The number of routes of each common name is exported if
+// clientRoutes is set, which allows detecting site-to-site clients whose
+// iroutes are missing. Unless ignoring individuals, the labels of route
+// metrics can be restricted to the given ones, which are validated using
+// CheckRouteLabels; all of them are attached if labels is nil. Real
+// addresses are exported according to privacy.
+func NewRoutingCollector(ignoreIndividuals bool, clientRoutes bool, labels []string, privacy *RealAddressPrivacy, metadata *ClientMetadata) *RoutingCollector {
+	var clientRoutesDesc *prometheus.Desc
+	if clientRoutes {
+		clientRoutesDesc = prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_routes"),
+			"Number of routes per common name, including connected clients without any routes.",
+			[]string{"status_path", "common_name"}, nil)
+	}
+
+	var routeLabels []string
+	var routeLabelColumns []string
+	if ignoreIndividuals {
+		routeLabels = []string{"status_path", "common_name"}
+		routeLabelColumns = []string{"Common Name"}
+	} else {
+		if labels == nil {
+			labels = []string{"common_name", "real_address", "virtual_address"}
+		}
+		routeLabels, routeLabelColumns = privacy.labels(labels, labelColumns(labels, routeLabelColumnsByName))
+		routeLabels = append([]string{"status_path"}, routeLabels...)
+	}
+	// Static labels of the client's common name are attached as well.
+	routeLabels = append(routeLabels, metadata.labelNames()...)
+
+	return &RoutingCollector{
+		routeHeader: OpenvpnServerHeader{
+			LabelColumns: routeLabelColumns,
+			privacy:      privacy,
+			Metrics: []OpenvpnServerHeaderField{
+				{
+					Column: "Last Ref (time_t)",
+					Desc: prometheus.NewDesc(
+						prometheus.BuildFQName("openvpn", "server", "route_last_reference_time_seconds"),
+						"Time at which a route was last referenced, in seconds.",
+						routeLabels, nil),
+					ValueType: prometheus.GaugeValue,
+				},
+			},
+		},
+		routesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "routes"),
+			"Number of entries in the routing table.",
+			[]string{"status_path"}, nil),
+		clientRoutesDesc: clientRoutesDesc,
+		orphanRoutesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "orphan_routes"),
+			"Number of routes whose client is not connected.",
+			[]string{"status_path"}, nil),
+		unroutedClientsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "unrouted_clients"),
+			"Number of connected clients without any routes.",
+			[]string{"status_path"}, nil),
+		collisionsDesc: newEntryCollisionsDesc(),
+		metadata:       metadata,
+	}
+}
+
+func (c *RoutingCollector) Name() string {
+	return "routing"
+}
+
+func (c *RoutingCollector) appliesTo(file *StatusFile) bool {
+	return file.Server
+}
+
+func (c *RoutingCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range c.routeHeader.Metrics {
+		ch <- metric.Desc
+	}
+	ch <- c.routesDesc
+	if c.clientRoutesDesc != nil {
+		ch <- c.clientRoutesDesc
+	}
+	ch <- c.orphanRoutesDesc
+	ch <- c.unroutedClientsDesc
+	ch <- c.collisionsDesc
+}
+
+func (c *RoutingCollector) collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error {
+	routes, err := file.rows("ROUTING_TABLE")
+	if err != nil {
+		return err
+	}
+	collisions, err := collectEntries(statusPath, c.routeHeader, routes, c.metadata, nil, ch)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.collisionsDesc,
+		prometheus.GaugeValue,
+		float64(collisions),
+		statusPath,
+		c.Name())
+	ch <- prometheus.MustNewConstMetric(
+		c.routesDesc,
+		prometheus.GaugeValue,
+		float64(len(routes)),
+		statusPath)
+
+	// Mismatches between the routing table and the client list indicate
+	// problems with learn-address scripts or stuck server state.
+	// Connections are identified by common name and real address.
+	clients, err := file.rows("CLIENT_LIST")
+	if err != nil {
+		return err
+	}
+	clientConnections := map[string]bool{}
+	for _, client := range clients {
+		clientConnections[client["Common Name"]+"\x00"+client["Real Address"]] = true
+	}
+	routedConnections := map[string]int{}
+	for _, route := range routes {
+		routedConnections[route["Common Name"]+"\x00"+route["Real Address"]]++
+	}
+	orphanRoutes, unroutedClients := 0, 0
+	for connection, routes := range routedConnections {
+		if !clientConnections[connection] {
+			orphanRoutes += routes
+		}
+	}
+	for connection := range clientConnections {
+		if routedConnections[connection] == 0 {
+			unroutedClients++
+		}
+	}
+	if c.clientRoutesDesc != nil {
+		clientRoutes := map[string]int{}
+		for _, client := range clients {
+			clientRoutes[client["Common Name"]] += 0
+		}
+		for _, route := range routes {
+			clientRoutes[route["Common Name"]]++
+		}
+		for commonName, routes := range clientRoutes {
+			ch <- prometheus.MustNewConstMetric(
+				c.clientRoutesDesc,
+				prometheus.GaugeValue,
+				float64(routes),
+				statusPath,
+				commonName)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.orphanRoutesDesc,
+		prometheus.GaugeValue,
+		float64(orphanRoutes),
+		statusPath)
+	ch <- prometheus.MustNewConstMetric(
+		c.unroutedClientsDesc,
+		prometheus.GaugeValue,
+		float64(unroutedClients),
+		statusPath)
+	return nil
+}
@@ -0,0 +1,466 @@
+package exporters
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ServerStatusCollector converts the client list of OpenVPN server status
+// files into Prometheus metrics.
+type ServerStatusCollector struct {
+	statusUpdateTimeDesc *prometheus.Desc
+	clockDriftDesc       *prometheus.Desc
+	connectedClientsDesc *prometheus.Desc
+	infoDesc             *prometheus.Desc
+	userSessionsDesc     *prometheus.Desc
+	sessionInfoDesc      *prometheus.Desc
+	sessionsDesc         *prometheus.Desc
+	clientInfoDesc       *prometheus.Desc
+	clientsByCipherDesc  *prometheus.Desc
+	clientIdleDesc       *prometheus.Desc
+	sessionsStartedDesc  *prometheus.Desc
+	sessionsEndedDesc    *prometheus.Desc
+	collisionsDesc       *prometheus.Desc
+	clientHeader         OpenvpnServerHeader
+	sessionIndex         bool
+	privacy              *RealAddressPrivacy
+	counters             *counterTracker
+	idle                 *idleTracker
+	churn                *churnTracker
+	metadata             *ClientMetadata
+}
+
+// NewServerStatusCollector creates a collector for the client list of
+// server status files. When ignoring individuals, sessions sharing a
+// common name can be told apart by passing sessionIndex, which adds a
+// session label numbering them. Otherwise, the labels of client metrics
+// can be restricted to the given ones, which are validated using
+// CheckClientLabels; all of them are attached if labels is nil. Real
+// addresses are exported according to privacy. Passing aggregate labels
+// client metrics by common name regardless, summing the traffic of its
+// sessions, which keeps cardinality flat for servers using duplicate-cn
+// or with many reconnecting clients. The number of sessions started and
+// ended between collections is counted per common name if
+// churnByCommonName is passed.
+func NewServerStatusCollector(ignoreIndividuals bool, sessionIndex bool, cumulativeCounters bool, aggregate bool, churnByCommonName bool, labels []string, privacy *RealAddressPrivacy, metadata *ClientMetadata) *ServerStatusCollector {
+	// Session identifiers are unique per connection, so they are only
+	// exported when exporting metrics for individuals.
+	var sessionInfoDesc, clientInfoDesc *prometheus.Desc
+	if !ignoreIndividuals && !aggregate {
+		clientInfoDesc = prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_info"),
+			"Properties of a connection on the VPN server, as reported by OpenVPN 2.5 and later.",
+			append([]string{"status_path", "common_name", "session_id", "data_channel_cipher"}, metadata.labelNames()...), nil)
+		sessionInfoLabels, _ := privacy.labels(
+			[]string{"common_name", "connection_time", "real_address", "session_id"},
+			[]string{"Common Name", "Connected Since (time_t)", "Real Address", "Session ID"})
+		sessionInfoDesc = prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_session_info"),
+			"Stable identifier of a connection on the VPN server, for joining with other data sources.",
+			append(append([]string{"status_path"}, sessionInfoLabels...), metadata.labelNames()...), nil)
+	}
+
+	var sessionsDesc *prometheus.Desc
+	if aggregate {
+		sessionsDesc = prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_sessions"),
+			"Number of sessions per common name on the VPN server.",
+			append([]string{"status_path", "common_name"}, metadata.labelNames()...), nil)
+	}
+
+	var clientLabels []string
+	var clientLabelColumns []string
+	if aggregate {
+		clientLabels = []string{"status_path", "common_name"}
+		clientLabelColumns = []string{"Common Name"}
+	} else if ignoreIndividuals && sessionIndex {
+		clientLabels = []string{"status_path", "common_name", "session"}
+		clientLabelColumns = []string{"Common Name", "Session"}
+	} else if ignoreIndividuals {
+		clientLabels = []string{"status_path", "common_name"}
+		clientLabelColumns = []string{"Common Name"}
+	} else {
+		if labels == nil {
+			labels = []string{"common_name", "connection_time", "real_address", "virtual_address", "username"}
+		}
+		clientLabels, clientLabelColumns = privacy.labels(labels, labelColumns(labels, clientLabelColumnsByName))
+		clientLabels = append([]string{"status_path"}, clientLabels...)
+	}
+	// Static labels of the client's common name are attached as well.
+	clientLabels = append(clientLabels, metadata.labelNames()...)
+
+	churnLabels := []string{"status_path"}
+	if churnByCommonName {
+		churnLabels = append(churnLabels, "common_name")
+		churnLabels = append(churnLabels, metadata.labelNames()...)
+	}
+
+	// Counters are only compensated for resets in cumulative mode.
+	var counters *counterTracker
+	if cumulativeCounters {
+		counters = newCounterTracker()
+	}
+
+	return &ServerStatusCollector{
+		statusUpdateTimeDesc: newStatusUpdateTimeDesc(),
+		clockDriftDesc:       newStatusClockDriftDesc(),
+		connectedClientsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "", "server_connected_clients"),
+			"Number Of Connected Clients",
+			[]string{"status_path"}, nil),
+		infoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "info"),
+			"Version of the OpenVPN server, as reported in the TITLE of its status file.",
+			[]string{"status_path", "version"}, nil),
+		userSessionsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "user_sessions"),
+			"Number of concurrent sessions per authenticated username.",
+			[]string{"status_path", "username"}, nil),
+		sessionInfoDesc: sessionInfoDesc,
+		clientIdleDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_idle_seconds"),
+			"Time since the byte counters of the client's most recently active connection last increased, in seconds.",
+			append([]string{"status_path", "common_name"}, metadata.labelNames()...), nil),
+		sessionsStartedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_sessions_started_total"),
+			"Number of sessions that started on the VPN server, as seen by comparing consecutive client lists.",
+			churnLabels, nil),
+		sessionsEndedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "client_sessions_ended_total"),
+			"Number of sessions that ended on the VPN server, as seen by comparing consecutive client lists.",
+			churnLabels, nil),
+		collisionsDesc: newEntryCollisionsDesc(),
+		clientHeader: OpenvpnServerHeader{
+			LabelColumns: clientLabelColumns,
+			privacy:      privacy,
+			aggregate:    aggregate,
+			Metrics: []OpenvpnServerHeaderField{
+				{
+					Column: "Bytes Received",
+					Desc: prometheus.NewDesc(
+						prometheus.BuildFQName("openvpn", "server", "client_received_bytes_total"),
+						"Amount of data received over a connection on the VPN server, in bytes.",
+						clientLabels, nil),
+					ValueType: prometheus.CounterValue,
+				},
+				{
+					Column: "Bytes Sent",
+					Desc: prometheus.NewDesc(
+						prometheus.BuildFQName("openvpn", "server", "client_sent_bytes_total"),
+						"Amount of data sent over a connection on the VPN server, in bytes.",
+						clientLabels, nil),
+					ValueType: prometheus.CounterValue,
+				},
+				{
+					Column: "Connected Since (time_t)",
+					Desc: prometheus.NewDesc(
+						prometheus.BuildFQName("openvpn", "server", "client_connected_since_timestamp_seconds"),
+						"UNIX timestamp at which a connection on the VPN server was established.",
+						clientLabels, nil),
+					ValueType: prometheus.GaugeValue,
+				},
+			},
+		},
+		sessionsDesc:   sessionsDesc,
+		clientInfoDesc: clientInfoDesc,
+		clientsByCipherDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("openvpn", "server", "clients_by_cipher"),
+			"Number of connections on the VPN server per data channel cipher, as reported by OpenVPN 2.5 and later.",
+			[]string{"status_path", "cipher"}, nil),
+		sessionIndex: ignoreIndividuals && sessionIndex && !aggregate,
+		privacy:      privacy,
+		counters:     counters,
+		idle:         newIdleTracker(),
+		churn:        newChurnTracker(churnByCommonName),
+		metadata:     metadata,
+	}
+}
+
+func (c *ServerStatusCollector) Name() string {
+	return "server_status"
+}
+
+func (c *ServerStatusCollector) appliesTo(file *StatusFile) bool {
+	return file.Server
+}
+
+func (c *ServerStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.statusUpdateTimeDesc
+	ch <- c.clockDriftDesc
+	ch <- c.connectedClientsDesc
+	ch <- c.infoDesc
+	ch <- c.userSessionsDesc
+	if c.sessionInfoDesc != nil {
+		ch <- c.sessionInfoDesc
+	}
+	if c.sessionsDesc != nil {
+		ch <- c.sessionsDesc
+	}
+	if c.clientInfoDesc != nil {
+		ch <- c.clientInfoDesc
+	}
+	ch <- c.clientsByCipherDesc
+	ch <- c.clientIdleDesc
+	ch <- c.sessionsStartedDesc
+	ch <- c.sessionsEndedDesc
+	ch <- c.collisionsDesc
+	for _, metric := range c.clientHeader.Metrics {
+		ch <- metric.Desc
+	}
+}
+
+func (c *ServerStatusCollector) collect(statusPath string, file *StatusFile, ch chan<- prometheus.Metric) error {
+	if file.Title != "" {
+		ch <- prometheus.MustNewConstMetric(
+			c.infoDesc,
+			prometheus.GaugeValue,
+			1.0,
+			statusPath,
+			file.Title)
+	}
+	if file.Updated != "" {
+		// Time at which the statistics were updated.
+		timeStartStats, err := strconv.ParseFloat(file.Updated, 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.statusUpdateTimeDesc,
+			prometheus.GaugeValue,
+			timeStartStats,
+			statusPath)
+		ch <- prometheus.MustNewConstMetric(
+			c.clockDriftDesc,
+			prometheus.GaugeValue,
+			timeStartStats-float64(time.Now().UnixNano())/1e9,
+			statusPath)
+	}
+
+	clients, err := file.rows("CLIENT_LIST")
+	if err != nil {
+		return err
+	}
+	// counter of sessions per authenticated username
+	userSessions := map[string]int{}
+	// identifiers of sessions that have been seen
+	sessionIDs := map[string]bool{}
+	// common names of sessions by their identifier
+	sessionCommonNames := map[string]string{}
+	// time since traffic was last seen per common name
+	idleSeconds := map[string]float64{}
+	// counter of sessions per common name
+	commonNameSessions := map[string]int{}
+	// counter of sessions per data channel cipher
+	cipherSessions := map[string]int{}
+	now := time.Now()
+	for _, columnValues := range clients {
+		// Clients that did not authenticate using a
+		// username are reported as UNDEF.
+		if username := columnValues["Username"]; username != "" && username != "UNDEF" {
+			userSessions[username]++
+		}
+		sessionID := SessionID(columnValues["Common Name"], columnValues["Connected Since (time_t)"], columnValues["Real Address"])
+		if sessionIDs[sessionID] {
+			continue
+		}
+		if c.sessionInfoDesc != nil {
+			labels := []string{statusPath, columnValues["Common Name"], columnValues["Connected Since (time_t)"]}
+			if c.privacy.exported() {
+				labels = append(labels, c.privacy.value(columnValues["Real Address"]))
+			}
+			labels = append(labels, sessionID)
+			ch <- prometheus.MustNewConstMetric(
+				c.sessionInfoDesc,
+				prometheus.GaugeValue,
+				1.0,
+				append(labels, c.metadata.labelValues(columnValues["Common Name"])...)...)
+		}
+		received, errReceived := strconv.ParseFloat(columnValues["Bytes Received"], 64)
+		sent, errSent := strconv.ParseFloat(columnValues["Bytes Sent"], 64)
+		if errReceived == nil && errSent == nil {
+			idle := c.idle.observe(statusPath, sessionID, received+sent, now).Seconds()
+			if previous, ok := idleSeconds[columnValues["Common Name"]]; !ok || idle < previous {
+				idleSeconds[columnValues["Common Name"]] = idle
+			}
+		}
+		// Status files of OpenVPN 2.4 and earlier lack the cipher.
+		if cipher, ok := columnValues["Data Channel Cipher"]; ok {
+			cipherSessions[cipher]++
+			if c.clientInfoDesc != nil {
+				ch <- prometheus.MustNewConstMetric(
+					c.clientInfoDesc,
+					prometheus.GaugeValue,
+					1.0,
+					append([]string{statusPath, columnValues["Common Name"], sessionID, cipher}, c.metadata.labelValues(columnValues["Common Name"])...)...)
+			}
+		}
+		sessionIDs[sessionID] = true
+		sessionCommonNames[sessionID] = columnValues["Common Name"]
+		commonNameSessions[columnValues["Common Name"]]++
+	}
+	if c.sessionIndex {
+		numberSessions(clients)
+	}
+	collisions, err := collectEntries(statusPath, c.clientHeader, clients, c.metadata, c.counters, ch)
+	if err != nil {
+		return err
+	}
+	c.counters.prune(statusPath)
+	ch <- prometheus.MustNewConstMetric(
+		c.collisionsDesc,
+		prometheus.GaugeValue,
+		float64(collisions),
+		statusPath,
+		c.Name())
+
+	// add the number of connected client
+	ch <- prometheus.MustNewConstMetric(
+		c.connectedClientsDesc,
+		prometheus.GaugeValue,
+		float64(len(clients)),
+		statusPath)
+	for username, sessions := range userSessions {
+		ch <- prometheus.MustNewConstMetric(
+			c.userSessionsDesc,
+			prometheus.GaugeValue,
+			float64(sessions),
+			statusPath,
+			username)
+	}
+	for cipher, sessions := range cipherSessions {
+		ch <- prometheus.MustNewConstMetric(
+			c.clientsByCipherDesc,
+			prometheus.GaugeValue,
+			float64(sessions),
+			statusPath,
+			cipher)
+	}
+	if c.sessionsDesc != nil {
+		for commonName, sessions := range commonNameSessions {
+			ch <- prometheus.MustNewConstMetric(
+				c.sessionsDesc,
+				prometheus.GaugeValue,
+				float64(sessions),
+				append([]string{statusPath, commonName}, c.metadata.labelValues(commonName)...)...)
+		}
+	}
+	for commonName, idle := range idleSeconds {
+		ch <- prometheus.MustNewConstMetric(
+			c.clientIdleDesc,
+			prometheus.GaugeValue,
+			idle,
+			append([]string{statusPath, commonName}, c.metadata.labelValues(commonName)...)...)
+	}
+	c.idle.prune(statusPath, sessionIDs)
+
+	started, ended := c.churn.observe(statusPath, sessionCommonNames)
+	collectChurn := func(desc *prometheus.Desc, counts map[string]float64) {
+		for commonName, count := range counts {
+			labels := []string{statusPath}
+			if c.churn.byCommonName {
+				labels = append(append(labels, commonName), c.metadata.labelValues(commonName)...)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				desc,
+				prometheus.CounterValue,
+				count,
+				labels...)
+		}
+	}
+	collectChurn(c.sessionsStartedDesc, started)
+	collectChurn(c.sessionsEndedDesc, ended)
+	return nil
+}
+
+// Numbers the sessions of every common name in a Session column, ordered
+// by the time at which they connected and their real address, starting at
+// zero. The same client list thus always results in the same numbering,
+// though the sessions of a common name are renumbered when one of them
+// disconnects.
+func numberSessions(clients []map[string]string) {
+	sessions := map[string][]map[string]string{}
+	for _, client := range clients {
+		sessions[client["Common Name"]] = append(sessions[client["Common Name"]], client)
+	}
+	for _, clients := range sessions {
+		sort.SliceStable(clients, func(i, j int) bool {
+			ti, _ := strconv.ParseInt(clients[i]["Connected Since (time_t)"], 10, 64)
+			tj, _ := strconv.ParseInt(clients[j]["Connected Since (time_t)"], 10, 64)
+			if ti != tj {
+				return ti < tj
+			}
+			return clients[i]["Real Address"] < clients[j]["Real Address"]
+		})
+		// Entries listed more than once describe the same session.
+		index := -1
+		var previous string
+		for _, client := range clients {
+			sessionID := SessionID(client["Common Name"], client["Connected Since (time_t)"], client["Real Address"])
+			if index < 0 || sessionID != previous {
+				index++
+			}
+			client["Session"] = strconv.Itoa(index)
+			previous = sessionID
+		}
+	}
+}
+
+type serverStatusState struct {
+	Counters json.RawMessage `json:"counters,omitempty"`
+	Churn    json.RawMessage `json:"churn"`
+	Idle     json.RawMessage `json:"idle"`
+}
+
+// SaveState returns the values of counters tracked in cumulative mode, the
+// sessions last listed along with the number of sessions started and ended,
+// and the time at which the traffic of each session last increased.
+func (c *ServerStatusCollector) SaveState() (json.RawMessage, error) {
+	var state serverStatusState
+	var err error
+	if c.counters != nil {
+		if state.Counters, err = c.counters.saveState(); err != nil {
+			return nil, err
+		}
+	}
+	if state.Churn, err = c.churn.saveState(); err != nil {
+		return nil, err
+	}
+	if state.Idle, err = c.idle.saveState(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(state)
+}
+
+// LoadState restores the state returned by SaveState.
+func (c *ServerStatusCollector) LoadState(data json.RawMessage) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var state serverStatusState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	// Earlier versions only saved the counters.
+	if state.Counters == nil && state.Churn == nil && state.Idle == nil {
+		state.Counters = data
+	}
+	if c.counters != nil && state.Counters != nil {
+		if err := c.counters.loadState(state.Counters); err != nil {
+			return err
+		}
+	}
+	if state.Churn != nil {
+		if err := c.churn.loadState(state.Churn); err != nil {
+			return err
+		}
+	}
+	if state.Idle != nil {
+		if err := c.idle.loadState(state.Idle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
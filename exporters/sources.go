@@ -0,0 +1,162 @@
+package exporters
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusOpener opens status files whose status paths start with a scheme,
+// such as docker://, registered using RegisterStatusOpener.
+type StatusOpener interface {
+	// Open returns the contents of the status file at the status path,
+	// including its scheme, and what's known about it.
+	Open(statusPath string) (io.ReadCloser, StatusFileInfo, error)
+}
+
+// StatusFileInfo describes a status file opened by a StatusOpener.
+type StatusFileInfo struct {
+	// Time at which the status file was last modified, if known.
+	ModTime time.Time
+}
+
+// StatusOpenerFunc adapts a function to a StatusOpener.
+type StatusOpenerFunc func(statusPath string) (io.ReadCloser, StatusFileInfo, error)
+
+func (f StatusOpenerFunc) Open(statusPath string) (io.ReadCloser, StatusFileInfo, error) {
+	return f(statusPath)
+}
+
+// StatusFormat parses status files of a format not written by OpenVPN
+// itself, registered using RegisterStatusFormat.
+type StatusFormat interface {
+	// Detect returns whether a status file starting with the given
+	// bytes is of this format. The prefix holds up to
+	// StatusFormatPrefixLength bytes.
+	Detect(prefix []byte) bool
+	Parse(file io.Reader) (*StatusFile, error)
+}
+
+// StatusFormatPrefixLength is the maximum number of bytes of a status file
+// passed to StatusFormat.Detect.
+const StatusFormatPrefixLength = 512
+
+var (
+	registryMutex sync.RWMutex
+	// Openers of status paths, indexed by scheme.
+	statusOpeners = map[string]StatusOpener{
+		"docker": StatusOpenerFunc(openDockerStatus),
+		"k8s":    StatusOpenerFunc(openKubernetesStatus),
+		"tcp":    StatusOpenerFunc(openManagementStatusPath),
+		"unix":   StatusOpenerFunc(openManagementStatusPath),
+	}
+	statusFormats []StatusFormat
+)
+
+// RegisterStatusOpener makes status paths written as <scheme>://... be
+// opened by the given opener, replacing any opener registered for the
+// scheme before. Openers should be registered before creating exporters.
+func RegisterStatusOpener(scheme string, opener StatusOpener) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	statusOpeners[scheme] = opener
+}
+
+// RegisterStatusFormat makes status files that aren't in one of the
+// formats written by OpenVPN be parsed by the given format, if it detects
+// them. Formats are tried in the order in which they were registered.
+func RegisterStatusFormat(format StatusFormat) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	statusFormats = append(statusFormats, format)
+}
+
+// Returns the registered format detecting a status file by its prefix.
+func detectStatusFormat(prefix []byte) (StatusFormat, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for _, format := range statusFormats {
+		if format.Detect(prefix) {
+			return format, true
+		}
+	}
+	return nil, false
+}
+
+// Opens a status file. Besides local paths, status files inside Docker
+// containers may be specified as docker://<container>/<path>, status
+// files inside Kubernetes pods as k8s://<namespace>/<pod>:<path> and the
+// management interface of an OpenVPN daemon as tcp://<host>:<port> or
+// unix://<path>, optionally with the query parameters password_file=<path>,
+// bytecount=<interval> (see ManagementBytecountStatusPath) and
+// timeout=<duration>, which defaults to ten seconds. Other
+// schemes may be added using RegisterStatusOpener.
+func openStatusFile(statusPath string) (io.ReadCloser, StatusFileInfo, error) {
+	if i := strings.Index(statusPath, "://"); i >= 0 {
+		scheme := statusPath[:i]
+		registryMutex.RLock()
+		opener, ok := statusOpeners[scheme]
+		registryMutex.RUnlock()
+		if !ok {
+			return nil, StatusFileInfo{}, fmt.Errorf("unsupported scheme %q", scheme)
+		}
+		return opener.Open(statusPath)
+	}
+
+	file, err := os.Open(statusPath)
+	if err != nil {
+		return nil, StatusFileInfo{}, err
+	}
+	var info StatusFileInfo
+	if stat, err := file.Stat(); err == nil {
+		info.ModTime = stat.ModTime()
+	}
+	return file, info, nil
+}
+
+func openDockerStatus(statusPath string) (io.ReadCloser, StatusFileInfo, error) {
+	u, err := url.Parse(statusPath)
+	if err != nil {
+		return nil, StatusFileInfo{}, err
+	}
+	file, err := openDockerFile(u.Host, u.Path)
+	return file, StatusFileInfo{}, err
+}
+
+func openKubernetesStatus(statusPath string) (io.ReadCloser, StatusFileInfo, error) {
+	file, err := openKubernetesFile(statusPath)
+	return file, StatusFileInfo{}, err
+}
+
+func openManagementStatusPath(statusPath string) (io.ReadCloser, StatusFileInfo, error) {
+	u, err := url.Parse(statusPath)
+	if err != nil {
+		return nil, StatusFileInfo{}, err
+	}
+	address := u.Host
+	if u.Scheme == "unix" {
+		address = u.Path
+	}
+	passwordFile := u.Query().Get("password_file")
+	timeout := defaultManagementTimeout
+	if t := u.Query().Get("timeout"); t != "" {
+		timeout, err = time.ParseDuration(t)
+		if err != nil || timeout <= 0 {
+			return nil, StatusFileInfo{}, fmt.Errorf("invalid timeout %q", t)
+		}
+	}
+	if bytecount := u.Query().Get("bytecount"); bytecount != "" {
+		interval, err := time.ParseDuration(bytecount)
+		if err != nil {
+			return nil, StatusFileInfo{}, fmt.Errorf("invalid bytecount interval: %s", err)
+		}
+		file, err := openBytecountStatus(statusPath, u.Scheme, address, passwordFile, interval, timeout)
+		return file, StatusFileInfo{}, err
+	}
+	file, err := openManagementStatus(u.Scheme, address, passwordFile, timeout)
+	return file, StatusFileInfo{}, err
+}
@@ -0,0 +1,102 @@
+package exporters
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Persistable is implemented by collectors that keep state across
+// collections which should survive restarts of the exporter.
+type Persistable interface {
+	SaveState() (json.RawMessage, error)
+	LoadState(json.RawMessage) error
+}
+
+// StateFile stores the state of a set of named collectors in a single
+// JSON file.
+type StateFile struct {
+	path string
+
+	mutex       sync.Mutex
+	states      map[string]json.RawMessage
+	persistable map[string]Persistable
+}
+
+// NewStateFile reads the states stored in a state file. A missing state
+// file is not considered an error, as it is absent when the exporter
+// starts for the first time.
+func NewStateFile(path string) (*StateFile, error) {
+	states := map[string]json.RawMessage{}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &states); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &StateFile{
+		path:        path,
+		states:      states,
+		persistable: map[string]Persistable{},
+	}, nil
+}
+
+// Register restores the state of a collector, if present in the state
+// file, and ensures its state is written on subsequent saves. A collector
+// whose state can't be restored is registered regardless, so that its
+// state is replaced on the next save.
+func (f *StateFile) Register(name string, p Persistable) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.persistable[name] = p
+	if state, ok := f.states[name]; ok {
+		return p.LoadState(state)
+	}
+	return nil
+}
+
+// Unregister stops writing the state of a collector, e.g. of a source
+// that was removed, and forgets its state.
+func (f *StateFile) Unregister(name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.persistable, name)
+	delete(f.states, name)
+}
+
+// Save writes the state of all registered collectors. The file is
+// replaced atomically, so that a crash while saving doesn't corrupt it.
+func (f *StateFile) Save() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for name, p := range f.persistable {
+		state, err := p.SaveState()
+		if err != nil {
+			return err
+		}
+		f.states[name] = state
+	}
+	data, err := json.Marshal(f.states)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,464 @@
+package exporters
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatusFile holds the contents of a status file, split into its
+// sections, as returned by the parsers of status file formats. Entries are
+// only checked for being well-formed when they are used, so that a
+// malformed section doesn't prevent other sections from being collected.
+type StatusFile struct {
+	// Whether the file contains server rather than client statistics.
+	Server bool
+	// Time at which the statistics were updated, as written by OpenVPN:
+	// a UNIX timestamp or a date.
+	Updated string
+	// Version of OpenVPN, as written in the TITLE of server statistics
+	// using format version 2 or 3.
+	Title string
+	// Column names of entries, indexed by entry type.
+	Headers map[string][]string
+	// Fields of CLIENT_LIST, ROUTING_TABLE and other entries described
+	// by a HEADER, indexed by entry type.
+	Entries map[string][][]string
+	// Global server statistics, or client statistics.
+	Stats map[string]string
+	// Connection state of a client, such as CONNECTED or RECONNECTING,
+	// and the UNIX timestamp at which it entered it, if known. Only
+	// available when read through its management interface.
+	State      string
+	StateSince string
+	// Time at which the file was last modified, if known.
+	ModTime time.Time
+}
+
+// Parses a status file. This function automatically detects whether the
+// file contains server or client statistics. For server statistics, it
+// also distinguishes between the version 1, 2 and 3 file formats.
+func parseStatusFile(file io.Reader) (*StatusFile, error) {
+	reader := bufio.NewReader(file)
+	buf, _ := reader.Peek(StatusFormatPrefixLength)
+	if bytes.HasPrefix(buf, []byte("TITLE,")) {
+		// Server statistics, using format version 2.
+		return parseServerStatusFile(reader, ",")
+	} else if bytes.HasPrefix(buf, []byte("TITLE\t")) {
+		// Server statistics, using format version 3. The only
+		// difference compared to version 2 is that it uses tabs
+		// instead of spaces.
+		return parseServerStatusFile(reader, "\t")
+	} else if bytes.HasPrefix(buf, []byte("OpenVPN CLIENT LIST")) {
+		// Server statistics, using format version 1.
+		return parseServerStatusFileV1(reader)
+	} else if bytes.HasPrefix(buf, []byte("OpenVPN STATISTICS")) {
+		// Client statistics.
+		return parseClientStatusFile(reader)
+	} else if format, ok := detectStatusFormat(buf); ok {
+		// Formats registered using RegisterStatusFormat.
+		return format.Parse(reader)
+	} else {
+		return nil, fmt.Errorf("unexpected file contents: %q", buf[:min(len(buf), 19)])
+	}
+}
+
+// Column layouts that OpenVPN uses for entries of server status files
+// using format version 2 or 3, told apart by their number of columns.
+var defaultHeaders = map[string][][]string{
+	"CLIENT_LIST": {
+		// OpenVPN 2.3.
+		{"Common Name", "Real Address", "Virtual Address", "Bytes Received", "Bytes Sent", "Connected Since", "Connected Since (time_t)", "Username"},
+		// OpenVPN 2.4.
+		{"Common Name", "Real Address", "Virtual Address", "Virtual IPv6 Address", "Bytes Received", "Bytes Sent", "Connected Since", "Connected Since (time_t)", "Username", "Client ID", "Peer ID"},
+		// OpenVPN 2.5 and later.
+		{"Common Name", "Real Address", "Virtual Address", "Virtual IPv6 Address", "Bytes Received", "Bytes Sent", "Connected Since", "Connected Since (time_t)", "Username", "Client ID", "Peer ID", "Data Channel Cipher"},
+	},
+	"ROUTING_TABLE": {
+		{"Virtual Address", "Common Name", "Real Address", "Last Ref", "Last Ref (time_t)"},
+	},
+}
+
+var useDefaultHeaders atomic.Bool
+
+// UseDefaultHeaders makes the parser fall back to the column layout that
+// OpenVPN uses by default for CLIENT_LIST and ROUTING_TABLE entries of
+// server status files lacking a HEADER, e.g. because they were truncated
+// or stripped by other tooling. The layout is chosen by the number of
+// columns of the entries. By default, such entries are rejected.
+func UseDefaultHeaders(enabled bool) {
+	useDefaultHeaders.Store(enabled)
+}
+
+// Adds the default column names of entries lacking a HEADER, if their
+// number of columns matches one of the default layouts.
+func (s *StatusFile) addDefaultHeaders() {
+	for entryType, layouts := range defaultHeaders {
+		entries := s.Entries[entryType]
+		if _, ok := s.Headers[entryType]; ok || len(entries) == 0 {
+			continue
+		}
+		for _, columns := range layouts {
+			if len(columns) == len(entries[0]) {
+				s.Headers[entryType] = columns
+			}
+		}
+	}
+}
+
+func parseServerStatusFile(file io.Reader, separator string) (*StatusFile, error) {
+	status := &StatusFile{
+		Server:  true,
+		Headers: map[string][]string{},
+		Entries: map[string][][]string{},
+		Stats:   map[string]string{},
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), separator)
+		if fields[0] == "END" && len(fields) == 1 {
+			// Stats footer.
+		} else if fields[0] == "GLOBAL_STATS" {
+			// Global server statistics.
+			if len(fields) == 3 {
+				status.Stats[fields[1]] = fields[2]
+			}
+		} else if fields[0] == "HEADER" && len(fields) > 2 {
+			// Column names for CLIENT_LIST and ROUTING_TABLE.
+			status.Headers[fields[1]] = fields[2:]
+		} else if fields[0] == "TIME" && len(fields) == 3 {
+			// Time at which the statistics were updated.
+			status.Updated = fields[2]
+		} else if fields[0] == "TITLE" && len(fields) == 2 {
+			// OpenVPN version number.
+			status.Title = fields[1]
+		} else if _, ok := status.Headers[fields[0]]; ok || fields[0] == "CLIENT_LIST" || fields[0] == "ROUTING_TABLE" {
+			// Entry that depends on a preceding HEADERS directive.
+			// Sections added by newer or patched versions of
+			// OpenVPN are accepted as long as they have one.
+			status.Entries[fields[0]] = append(status.Entries[fields[0]], fields[1:])
+		} else {
+			return nil, fmt.Errorf("unsupported key: %q", fields[0])
+		}
+	}
+	if useDefaultHeaders.Load() {
+		status.addDefaultHeaders()
+	}
+	return status, scanner.Err()
+}
+
+// Columns of version 1 server status files holding times, which are
+// converted to the columns holding UNIX timestamps found in later versions.
+var statusFileV1TimeColumns = map[string]string{
+	"Connected Since": "Connected Since (time_t)",
+	"Last Ref":        "Last Ref (time_t)",
+}
+
+// Parses a server status file using format version 1, OpenVPN's default.
+// Unlike later versions, it has no HEADER lines, as every section starts
+// with a title followed by a line of column names, and only contains
+// times in local time. These are converted to UNIX timestamps, so that
+// the file can be collected like files using later versions.
+func parseServerStatusFileV1(file io.Reader) (*StatusFile, error) {
+	status := &StatusFile{
+		Server:  true,
+		Headers: map[string][]string{},
+		Entries: map[string][][]string{},
+		Stats:   map[string]string{},
+	}
+	sections := map[string]string{
+		"OpenVPN CLIENT LIST": "CLIENT_LIST",
+		"ROUTING TABLE":       "ROUTING_TABLE",
+		"GLOBAL STATS":        "GLOBAL_STATS",
+	}
+	var section string
+	// Indices of columns holding times, for every section.
+	timeColumns := map[string][]int{}
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Split(line, ",")
+		if name, ok := sections[line]; ok {
+			// Title of a section.
+			section = name
+		} else if line == "END" {
+			// Stats footer.
+		} else if section == "CLIENT_LIST" && fields[0] == "Updated" && len(fields) == 2 {
+			// Time at which the statistics were updated.
+			updated, err := parseStatusTime(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			status.Updated = strconv.FormatInt(updated.Unix(), 10)
+		} else if section == "GLOBAL_STATS" && len(fields) == 2 {
+			// Global server statistics.
+			status.Stats[fields[0]] = fields[1]
+		} else if _, ok := status.Headers[section]; !ok && section != "" && section != "GLOBAL_STATS" {
+			// Column names, directly following the title.
+			for i, column := range fields {
+				if timeColumn, ok := statusFileV1TimeColumns[column]; ok {
+					fields = append(fields, timeColumn)
+					timeColumns[section] = append(timeColumns[section], i)
+				}
+			}
+			status.Headers[section] = fields
+		} else if section == "CLIENT_LIST" || section == "ROUTING_TABLE" {
+			for _, i := range timeColumns[section] {
+				if i >= len(fields) {
+					return nil, fmt.Errorf("HEADER for %s describes a different number of columns", section)
+				}
+				t, err := parseStatusTime(fields[i])
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, strconv.FormatInt(t.Unix(), 10))
+			}
+			status.Entries[section] = append(status.Entries[section], fields)
+		} else {
+			return nil, fmt.Errorf("unsupported line: %q", line)
+		}
+	}
+	return status, scanner.Err()
+}
+
+// Parses a time written by OpenVPN, which is in local time. OpenVPN 2.6
+// and later write times in ISO 8601 format instead of the format of
+// ctime(3).
+func parseStatusTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("Mon Jan _2 15:04:05 2006", value, time.Local)
+}
+
+func parseClientStatusFile(file io.Reader) (*StatusFile, error) {
+	status := &StatusFile{Stats: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if fields[0] == "END" && len(fields) == 1 {
+			// Stats footer.
+		} else if fields[0] == "OpenVPN STATISTICS" && len(fields) == 1 {
+			// Stats header.
+		} else if fields[0] == "Updated" && len(fields) == 2 {
+			// Time at which the statistics were updated.
+			status.Updated = fields[1]
+		} else if fields[0] == "State" && len(fields) == 3 {
+			// Connection state, added when reading the status
+			// through the management interface.
+			status.State = fields[1]
+			status.StateSince = fields[2]
+		} else if len(fields) == 2 {
+			// Traffic counters.
+			status.Stats[fields[0]] = fields[1]
+		} else {
+			return nil, fmt.Errorf("unsupported key: %q", fields[0])
+		}
+	}
+	return status, scanner.Err()
+}
+
+// Raw contents of a status file, as last read.
+type rawStatus struct {
+	contents []byte
+	fetched  time.Time
+}
+
+var (
+	lastStatusMutex sync.Mutex
+	lastStatus      = map[string]rawStatus{}
+)
+
+// Reads and parses a status file. The raw contents are kept, so that they
+// can be inspected when diagnosing parsing problems.
+func readStatusFile(statusPath string) (*StatusFile, error) {
+	file, info, err := openStatusFile(statusPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	lastStatusMutex.Lock()
+	lastStatus[statusPath] = rawStatus{contents: contents, fetched: time.Now()}
+	lastStatusMutex.Unlock()
+	status, err := parseStatusFile(bytes.NewReader(contents))
+	if err != nil {
+		return nil, statusParseError{err}
+	}
+	status.ModTime = info.ModTime
+	return status, nil
+}
+
+// Error returned by readStatusFile for status files that could be read,
+// but not parsed.
+type statusParseError struct {
+	err error
+}
+
+func (e statusParseError) Error() string {
+	return e.err.Error()
+}
+
+// A read of a status file, which is shared by everyone reading the status
+// file while it's running.
+type sharedRead struct {
+	done     chan struct{}
+	finished time.Time
+	timedOut bool
+	file     *StatusFile
+	err      error
+}
+
+var (
+	sharedReadsMutex  sync.Mutex
+	sharedReads       = map[string]*sharedRead{}
+	recentReadTimeout atomic.Int64
+)
+
+// Status files read less than this long ago are reused by the collectors
+// that read the clients connected to the servers on their own, rather than
+// read again.
+const recentReadMaxAge = 5 * time.Second
+
+// SetRecentReadTimeout sets the timeout for reading status files by the
+// collectors that read the clients connected to the servers on their own,
+// such as the ping, quota and LDAP collectors, and by the clients API. The
+// timeout is disabled if zero, which is the default.
+func SetRecentReadTimeout(timeout time.Duration) {
+	recentReadTimeout.Store(int64(timeout))
+}
+
+// Reads a status file, giving up after the timeout, unless it's zero.
+// Concurrent reads of a status file share a single read, so that e.g. only
+// a single connection is made to a management interface at a time, and
+// reads that finished less than maxAge ago are reused. Reads that time out
+// are left running in the background, as reads from e.g. a dead NFS mount
+// can't be interrupted, but no further reads of the same status file are
+// started until they finish.
+func readSharedStatusFile(statusPath string, timeout time.Duration, maxAge time.Duration) (*StatusFile, error) {
+	sharedReadsMutex.Lock()
+	read, ok := sharedReads[statusPath]
+	if ok && read.finished.IsZero() && read.timedOut {
+		sharedReadsMutex.Unlock()
+		return nil, fmt.Errorf("previous read timed out and hasn't finished yet")
+	}
+	if !ok || (!read.finished.IsZero() && time.Since(read.finished) >= maxAge) {
+		// Reads that can no longer be reused are forgotten, so that
+		// status files that disappeared aren't kept around.
+		for path, previous := range sharedReads {
+			if !previous.finished.IsZero() && time.Since(previous.finished) >= recentReadMaxAge {
+				delete(sharedReads, path)
+			}
+		}
+		read = &sharedRead{done: make(chan struct{})}
+		sharedReads[statusPath] = read
+		go func() {
+			file, err := readStatusFile(statusPath)
+			sharedReadsMutex.Lock()
+			read.finished = time.Now()
+			read.file = file
+			read.err = err
+			sharedReadsMutex.Unlock()
+			close(read.done)
+		}()
+	}
+	sharedReadsMutex.Unlock()
+
+	if timeout <= 0 {
+		<-read.done
+		return read.file, read.err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-read.done:
+		return read.file, read.err
+	case <-timer.C:
+		sharedReadsMutex.Lock()
+		read.timedOut = true
+		sharedReadsMutex.Unlock()
+		return nil, fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// Reads a status file on behalf of the collectors that read the clients
+// connected to the servers on their own, reusing the status file as last
+// read by the exporter if recent enough, so that they neither start reads
+// of their own while the exporter is reading, nor read again right after.
+func readRecentStatusFile(statusPath string) (*StatusFile, error) {
+	return readSharedStatusFile(statusPath, time.Duration(recentReadTimeout.Load()), recentReadMaxAge)
+}
+
+// Returns the time at which the statistics were updated, if present.
+func (s *StatusFile) updateTime() (time.Time, bool) {
+	if s.Updated == "" {
+		return time.Time{}, false
+	}
+	updated, err := parseClientUpdateTime(s.Updated)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(updated), 0), true
+}
+
+// LastStatus returns the raw contents of a status file as last read, and
+// the time at which it was read. It returns false if the status file
+// hasn't been read successfully yet.
+func LastStatus(statusPath string) ([]byte, time.Time, bool) {
+	lastStatusMutex.Lock()
+	defer lastStatusMutex.Unlock()
+	status, ok := lastStatus[statusPath]
+	return status.contents, status.fetched, ok
+}
+
+// Returns the entries of the given type, with the values of each entry
+// indexed by column name. Addresses are normalized, and the IP address of
+// the real address is added as a Real IP column, without its port.
+func (s *StatusFile) rows(entryType string) ([]map[string]string, error) {
+	entries := s.Entries[entryType]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	columnNames, ok := s.Headers[entryType]
+	if !ok {
+		return nil, fmt.Errorf("%s should be preceded by HEADERS", entryType)
+	}
+	var rows []map[string]string
+	for _, fields := range entries {
+		if len(fields) != len(columnNames) {
+			return nil, fmt.Errorf("HEADER for %s describes a different number of columns", entryType)
+		}
+		row := map[string]string{}
+		for i, column := range columnNames {
+			if column == "Real Address" {
+				row[column] = normalizeRealAddress(fields[i])
+			} else if contains(addressColumns, column) {
+				row[column] = normalizeAddress(fields[i])
+			} else {
+				row[column] = fields[i]
+			}
+		}
+		if realAddress, ok := row["Real Address"]; ok {
+			row["Real IP"] = realAddress
+			if ip := addressIP(realAddress); ip != nil {
+				row["Real IP"] = ip.String()
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,254 @@
+package exporters
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Values extracted from a status file in examples/.
+type exampleStatus struct {
+	server  bool
+	updated time.Time
+	title   string
+	stats   map[string]string
+	// Rows of CLIENT_LIST and ROUTING_TABLE, limited to the given
+	// columns.
+	clients []map[string]string
+	routes  []map[string]string
+}
+
+// Returns the UNIX timestamp of a time written by OpenVPN in local time.
+func localTimestamp(t *testing.T, value string) string {
+	parsed, err := parseStatusTime(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strconv.FormatInt(parsed.Unix(), 10)
+}
+
+func localTime(t *testing.T, value string) time.Time {
+	parsed, err := parseStatusTime(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func exampleStatuses(t *testing.T) map[string]exampleStatus {
+	server2 := exampleStatus{
+		server:  true,
+		updated: time.Unix(1490089154, 0),
+		title:   "OpenVPN 2.3.2 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [EPOLL] [PKCS11] [eurephia] [MH] [IPv6] built on Dec  2 2014",
+		stats:   map[string]string{"Max bcast/mcast queue length": "0"},
+		clients: []map[string]string{
+			{"Common Name": "redacted1", "Real Address": "0.0.0.0:19021", "Real IP": "0.0.0.0", "Bytes Received": "693438277", "Bytes Sent": "228390856", "Connected Since (time_t)": "1489680543", "Username": "UNDEF"},
+			{"Common Name": "redacted2", "Real Address": "0.0.0.0:60536", "Real IP": "0.0.0.0", "Bytes Received": "2925752", "Bytes Sent": "3145665", "Connected Since (time_t)": "1489680537", "Username": "UNDEF"},
+			{"Common Name": "redacted3", "Real Address": "0.0.0.0:28331", "Real IP": "0.0.0.0", "Bytes Received": "57316467", "Bytes Sent": "611736741", "Connected Since (time_t)": "1489680537", "Username": "UNDEF"},
+			{"Common Name": "redacted4", "Real Address": "0.0.0.0:52335", "Real IP": "0.0.0.0", "Bytes Received": "24289622392", "Bytes Sent": "70914674697", "Connected Since (time_t)": "1489745789", "Username": "UNDEF"},
+			{"Common Name": "redacted5", "Real Address": "0.0.0.0:51865", "Real IP": "0.0.0.0", "Bytes Received": "277017840", "Bytes Sent": "1544465106", "Connected Since (time_t)": "1489680541", "Username": "UNDEF"},
+		},
+		routes: []map[string]string{
+			{"Virtual Address": "0.0.0.0", "Common Name": "redacted1", "Last Ref (time_t)": "1490088408"},
+			{"Virtual Address": "0.0.0.0", "Common Name": "redacted5", "Last Ref (time_t)": "1490089106"},
+			{"Virtual Address": "0.0.0.0", "Common Name": "redacted3", "Last Ref (time_t)": "1490089146"},
+			{"Virtual Address": "0.0.0.0", "Common Name": "redacted4", "Last Ref (time_t)": "1490089153"},
+			{"Virtual Address": "0.0.0.0", "Common Name": "redacted2", "Last Ref (time_t)": "1489680538"},
+		},
+	}
+	// server2.status lists redacted1 twice.
+	server3 := server2
+	server2.clients = append(append([]map[string]string{}, server2.clients...), server2.clients[0])
+	server2.routes = append(append([]map[string]string{}, server2.routes...), server2.routes[0])
+
+	// Written by OpenVPN 2.6 with DCO enabled, including the Data
+	// Channel Cipher column and the dco_enabled statistic.
+	openvpn26 := exampleStatus{
+		server:  true,
+		updated: time.Unix(1711013954, 0),
+		title:   "OpenVPN 2.6.8 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [PKCS11] [MH/PKTINFO] [AEAD] [DCO]",
+		stats:   map[string]string{"Max bcast/mcast queue length": "1", "dco_enabled": "1"},
+		clients: []map[string]string{
+			{"Common Name": "redacted1", "Real Address": "198.51.100.10:51234", "Real IP": "198.51.100.10", "Virtual Address": "10.8.0.2", "Virtual IPv6 Address": "fd00:8::1000", "Bytes Received": "1932541", "Bytes Sent": "3145665", "Connected Since (time_t)": "1711008721", "Username": "UNDEF", "Client ID": "0", "Peer ID": "0", "Data Channel Cipher": "AES-256-GCM"},
+			{"Common Name": "redacted2", "Real Address": "2001:db8::10:1194", "Real IP": "2001:db8::10", "Virtual Address": "10.8.0.3", "Virtual IPv6 Address": "", "Bytes Received": "693438277", "Bytes Sent": "228390856", "Connected Since (time_t)": "1710950943", "Username": "redacted2", "Client ID": "1", "Peer ID": "1", "Data Channel Cipher": "CHACHA20-POLY1305"},
+		},
+		routes: []map[string]string{
+			{"Virtual Address": "10.8.0.2", "Common Name": "redacted1", "Real Address": "198.51.100.10:51234", "Last Ref (time_t)": "1711013950"},
+			{"Virtual Address": "fd00:8::1000", "Common Name": "redacted1", "Real Address": "198.51.100.10:51234", "Last Ref (time_t)": "1711013950"},
+			{"Virtual Address": "10.8.0.3", "Common Name": "redacted2", "Real Address": "2001:db8::10:1194", "Last Ref (time_t)": "1711013939"},
+		},
+	}
+
+	return map[string]exampleStatus{
+		"client.status": {
+			updated: localTime(t, "Tue Mar 21 10:39:09 2017"),
+			stats: map[string]string{
+				"TUN/TAP read bytes":    "153789941",
+				"TUN/TAP write bytes":   "308764078",
+				"TCP/UDP read bytes":    "292806201",
+				"TCP/UDP write bytes":   "197558969",
+				"Auth read bytes":       "308854782",
+				"pre-compress bytes":    "45388190",
+				"post-compress bytes":   "45446864",
+				"pre-decompress bytes":  "162596168",
+				"post-decompress bytes": "216965355",
+			},
+		},
+		"client-openvpn26.status": {
+			updated: localTime(t, "2024-03-21 10:39:09"),
+			stats: map[string]string{
+				"TUN/TAP read bytes":    "153789941",
+				"TUN/TAP write bytes":   "308764078",
+				"TCP/UDP read bytes":    "292806201",
+				"TCP/UDP write bytes":   "197558969",
+				"Auth read bytes":       "308854782",
+				"pre-compress bytes":    "0",
+				"post-compress bytes":   "0",
+				"pre-decompress bytes":  "0",
+				"post-decompress bytes": "0",
+			},
+		},
+		"server2.status":           server2,
+		"server3.status":           server3,
+		"server2-openvpn26.status": openvpn26,
+		"server3-openvpn26.status": openvpn26,
+		// Using status-version 1, OpenVPN's default, whose times are
+		// converted from local time.
+		"server1-openvpn26.status": {
+			server:  true,
+			updated: localTime(t, "2024-03-21 10:39:14"),
+			stats:   map[string]string{"Max bcast/mcast queue length": "1", "dco_enabled": "1"},
+			clients: []map[string]string{
+				{"Common Name": "redacted1", "Real Address": "198.51.100.10:51234", "Real IP": "198.51.100.10", "Bytes Received": "1932541", "Bytes Sent": "3145665", "Connected Since (time_t)": localTimestamp(t, "2024-03-21 09:12:01")},
+				{"Common Name": "redacted2", "Real Address": "2001:db8::10:1194", "Real IP": "2001:db8::10", "Bytes Received": "693438277", "Bytes Sent": "228390856", "Connected Since (time_t)": localTimestamp(t, "2024-03-20 17:09:03")},
+			},
+			routes: []map[string]string{
+				{"Virtual Address": "10.8.0.2", "Common Name": "redacted1", "Real Address": "198.51.100.10:51234", "Last Ref (time_t)": localTimestamp(t, "2024-03-21 10:39:10")},
+				{"Virtual Address": "fd00:8::1000", "Common Name": "redacted1", "Real Address": "198.51.100.10:51234", "Last Ref (time_t)": localTimestamp(t, "2024-03-21 10:39:10")},
+				{"Virtual Address": "10.8.0.3", "Common Name": "redacted2", "Real Address": "2001:db8::10:1194", "Last Ref (time_t)": localTimestamp(t, "2024-03-21 10:38:59")},
+			},
+		},
+	}
+}
+
+func checkRows(t *testing.T, name string, entryType string, status *StatusFile, want []map[string]string) {
+	if len(want) == 0 {
+		if len(status.Entries[entryType]) != 0 {
+			t.Errorf("%s: got %d %s entries, want none", name, len(status.Entries[entryType]), entryType)
+		}
+		return
+	}
+	rows, err := status.rows(entryType)
+	if err != nil {
+		t.Errorf("%s: %s", name, err)
+		return
+	}
+	if len(rows) != len(want) {
+		t.Errorf("%s: got %d %s rows, want %d", name, len(rows), entryType, len(want))
+		return
+	}
+	for i, columns := range want {
+		for column, value := range columns {
+			if rows[i][column] != value {
+				t.Errorf("%s: %s row %d: got %s %q, want %q", name, entryType, i, column, rows[i][column], value)
+			}
+		}
+	}
+}
+
+func TestParseExampleStatusFiles(t *testing.T) {
+	statuses := exampleStatuses(t)
+	paths, err := filepath.Glob("../examples/*.status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no example status files found")
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		want, ok := statuses[name]
+		if !ok {
+			t.Errorf("%s: no expected values", name)
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, err := parseStatusFile(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		if status.Server != want.server {
+			t.Errorf("%s: got server %v, want %v", name, status.Server, want.server)
+		}
+		if updated, ok := status.updateTime(); !ok || !updated.Equal(want.updated) {
+			t.Errorf("%s: got update time %v (%v), want %v", name, updated, ok, want.updated)
+		}
+		if status.Title != want.title {
+			t.Errorf("%s: got title %q, want %q", name, status.Title, want.title)
+		}
+		if len(status.Stats) != len(want.stats) {
+			t.Errorf("%s: got statistics %v, want %v", name, status.Stats, want.stats)
+		}
+		for key, value := range want.stats {
+			if status.Stats[key] != value {
+				t.Errorf("%s: got %s %q, want %q", name, key, status.Stats[key], value)
+			}
+		}
+		checkRows(t, name, "CLIENT_LIST", status, want.clients)
+		checkRows(t, name, "ROUTING_TABLE", status, want.routes)
+	}
+}
+
+func TestParseClientStatusFileTimestamp(t *testing.T) {
+	// Some wrappers write a UNIX timestamp instead of a date.
+	status, err := parseStatusFile(strings.NewReader("OpenVPN STATISTICS\nUpdated,1711013949\nTUN/TAP read bytes,153789941\nEND\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated, ok := status.updateTime(); !ok || !updated.Equal(time.Unix(1711013949, 0)) {
+		t.Errorf("got update time %v (%v), want %v", updated, ok, time.Unix(1711013949, 0))
+	}
+	if status.Stats["TUN/TAP read bytes"] != "153789941" {
+		t.Errorf("got statistics %v", status.Stats)
+	}
+}
+
+func TestParseServerStatusFileDefaultHeaders(t *testing.T) {
+	// A status file of OpenVPN 2.4 stripped of its HEADER lines.
+	contents := "TITLE,OpenVPN 2.4.4 x86_64-pc-linux-gnu\n" +
+		"TIME,Thu Mar 21 10:39:14 2024,1711013954\n" +
+		"CLIENT_LIST,alice,192.0.2.1:51234,10.8.0.2,fd00:8::1000,100,200,Thu Mar 21 09:12:01 2024,1711008721,UNDEF,0,0\n" +
+		"ROUTING_TABLE,10.8.0.2,alice,192.0.2.1:51234,Thu Mar 21 10:39:10 2024,1711013950\n" +
+		"GLOBAL_STATS,Max bcast/mcast queue length,0\n" +
+		"END\n"
+
+	status, err := parseStatusFile(strings.NewReader(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := status.rows("CLIENT_LIST"); err == nil {
+		t.Error("got CLIENT_LIST rows without HEADER, want an error")
+	}
+
+	UseDefaultHeaders(true)
+	defer UseDefaultHeaders(false)
+	status, err = parseStatusFile(strings.NewReader(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, "stripped", "CLIENT_LIST", status, []map[string]string{
+		{"Common Name": "alice", "Real Address": "192.0.2.1:51234", "Virtual IPv6 Address": "fd00:8::1000", "Bytes Received": "100", "Bytes Sent": "200", "Connected Since (time_t)": "1711008721", "Peer ID": "0"},
+	})
+	checkRows(t, "stripped", "ROUTING_TABLE", status, []map[string]string{
+		{"Virtual Address": "10.8.0.2", "Common Name": "alice", "Last Ref (time_t)": "1711013950"},
+	})
+}
@@ -0,0 +1,66 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+)
+
+// Key figures of a single OpenVPN instance, as used by the exporter's
+// non-Prometheus outputs.
+type instanceSummary struct {
+	statusPath string
+	up         float64
+	clients    float64
+	received   float64
+	sent       float64
+	updated    float64
+}
+
+// Summarizes the metrics of every status file exported by the gatherer,
+// sorted by status path. Traffic is summed from the per-client metrics, so
+// it only covers clients that are currently connected.
+func summarizeInstances(gatherer prometheus.Gatherer) ([]instanceSummary, error) {
+	families, err := gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+
+	instances := map[string]*instanceSummary{}
+	get := func(statusPath string) *instanceSummary {
+		if _, ok := instances[statusPath]; !ok {
+			instances[statusPath] = &instanceSummary{statusPath: statusPath}
+		}
+		return instances[statusPath]
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var statusPath string
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "status_path" {
+					statusPath = label.GetValue()
+				}
+			}
+			switch family.GetName() {
+			case "openvpn_up":
+				get(statusPath).up = metric.GetGauge().GetValue()
+			case "openvpn_status_update_time_seconds":
+				get(statusPath).updated = metric.GetGauge().GetValue()
+			case "openvpn_server_connected_clients":
+				get(statusPath).clients = metric.GetGauge().GetValue()
+			case "openvpn_server_client_received_bytes_total":
+				get(statusPath).received += metric.GetCounter().GetValue()
+			case "openvpn_server_client_sent_bytes_total":
+				get(statusPath).sent += metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	var summaries []instanceSummary
+	for _, instance := range instances {
+		summaries = append(summaries, *instance)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].statusPath < summaries[j].statusPath
+	})
+	return summaries, nil
+}
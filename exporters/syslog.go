@@ -0,0 +1,207 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of messages queued for delivery to the syslog collector, beyond
+// which messages are dropped rather than delaying their sources.
+const syslogQueueLength = 1024
+
+// Syslog facilities by name, as defined by RFC 5424 section 6.2.1.
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"authpriv": 10,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// Severities of forwarded messages.
+const (
+	syslogWarning = 4
+	syslogNotice  = 5
+)
+
+// A message to forward, whose body is encoded as JSON.
+type syslogMessage struct {
+	time     time.Time
+	severity int
+	// One of client-connect, client-disconnect or auth-failure.
+	msgID string
+	body  interface{}
+}
+
+// SyslogForwarder sends client events as RFC 5424 messages to a syslog
+// collector, e.g. one feeding a SIEM. Messages carry the event as a JSON
+// object, and are sent in the background, one at a time, so that their
+// sources aren't delayed.
+type SyslogForwarder struct {
+	network  string
+	address  string
+	facility int
+	appName  string
+	hostname string
+	timeout  time.Duration
+
+	messages chan syslogMessage
+	conn     net.Conn
+
+	failures prometheus.Counter
+}
+
+// NewSyslogForwarder creates a forwarder sending messages to the address,
+// written as udp://host:port, tcp://host:port or unix:///path, with the
+// facility given by name, e.g. local0. Messages are given up on after the
+// timeout.
+func NewSyslogForwarder(collectorAddress string, facility string, appName string, timeout time.Duration) (*SyslogForwarder, error) {
+	u, err := url.Parse(collectorAddress)
+	if err != nil {
+		return nil, err
+	}
+	var network, address string
+	switch u.Scheme {
+	case "udp", "tcp":
+		network, address = u.Scheme, u.Host
+	case "unix":
+		network, address = "unix", u.Path
+	default:
+		return nil, fmt.Errorf("syslog address %q should start with udp://, tcp:// or unix://", collectorAddress)
+	}
+	code, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogForwarder{
+		network:  network,
+		address:  address,
+		facility: code,
+		appName:  appName,
+		hostname: hostname,
+		timeout:  timeout,
+		messages: make(chan syslogMessage, syslogQueueLength),
+		failures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "openvpn",
+				Subsystem: "syslog",
+				Name:      "failures_total",
+				Help:      "Number of client events that couldn't be forwarded to syslog, including those dropped as too many were queued.",
+			}),
+	}, nil
+}
+
+// Queues a message for delivery, dropping it if too many are queued.
+func (f *SyslogForwarder) forward(message syslogMessage) {
+	select {
+	case f.messages <- message:
+	default:
+		slog.Error("Dropping syslog message, as too many are queued", "address", f.address)
+		f.failures.Inc()
+	}
+}
+
+// Returns a header field, which may not be empty or contain spaces.
+func syslogHeaderField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Formats a message according to RFC 5424, without structured data.
+func (f *SyslogForwarder) format(message syslogMessage) ([]byte, error) {
+	body, err := json.Marshal(message.body)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ",
+		f.facility*8+message.severity,
+		message.time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(f.hostname),
+		syslogHeaderField(f.appName),
+		os.Getpid(),
+		syslogHeaderField(message.msgID))
+	return append([]byte(header), body...), nil
+}
+
+// Sends a formatted message, connecting to the collector if not connected
+// yet. Messages sent over TCP are framed by octet counting, as described
+// by RFC 6587.
+func (f *SyslogForwarder) send(data []byte) error {
+	if f.conn == nil {
+		conn, err := net.DialTimeout(f.network, f.address, f.timeout)
+		if err != nil && f.network == "unix" {
+			// Local syslog daemons usually listen on datagram
+			// sockets, like /dev/log.
+			conn, err = net.DialTimeout("unixgram", f.address, f.timeout)
+		}
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+	if f.network == "tcp" {
+		data = append([]byte(strconv.Itoa(len(data))+" "), data...)
+	}
+	f.conn.SetWriteDeadline(time.Now().Add(f.timeout))
+	if _, err := f.conn.Write(data); err != nil {
+		f.conn.Close()
+		f.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Run delivers queued messages to the collector. A message that can't be
+// sent is retried once over a new connection, as connections to the
+// collector may have been closed since the previous message. It never
+// returns.
+func (f *SyslogForwarder) Run() {
+	for message := range f.messages {
+		data, err := f.format(message)
+		if err != nil {
+			panic(err)
+		}
+		if err := f.send(data); err != nil {
+			if err := f.send(data); err != nil {
+				slog.Error("Failed to forward client event to syslog", "address", f.address, "err", err)
+				f.failures.Inc()
+			}
+		}
+	}
+}
+
+func (f *SyslogForwarder) Describe(ch chan<- *prometheus.Desc) {
+	f.failures.Describe(ch)
+}
+
+func (f *SyslogForwarder) Collect(ch chan<- prometheus.Metric) {
+	f.failures.Collect(ch)
+}
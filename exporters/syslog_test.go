@@ -0,0 +1,101 @@
+package exporters
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogFormat(t *testing.T) {
+	f, err := NewSyslogForwarder("udp://127.0.0.1:514", "local0", "openvpn exporter", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.hostname = "vpn"
+	data, err := f.format(syslogMessage{
+		time:     time.Date(2026, 10, 17, 6, 19, 39, 123456000, time.FixedZone("CEST", 2*3600)),
+		severity: syslogWarning,
+		msgID:    "auth-failure",
+		body:     logAuthFailure{Time: time.Unix(0, 0).UTC(), LogPath: "/var/log/openvpn.log", Reason: "password", Message: "failed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`<132>1 2026-10-17T04:19:39.123456Z vpn openvpn_exporter %d auth-failure - {"time":"1970-01-01T00:00:00Z","log_path":"/var/log/openvpn.log","reason":"password","message":"failed"}`, os.Getpid())
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	for _, address := range []string{"localhost:514", "http://localhost:514"} {
+		if _, err := NewSyslogForwarder(address, "local0", "openvpn_exporter", time.Second); err == nil {
+			t.Errorf("address %q was accepted", address)
+		}
+	}
+	if _, err := NewSyslogForwarder("udp://127.0.0.1:514", "local8", "openvpn_exporter", time.Second); err == nil {
+		t.Error("facility local8 was accepted")
+	}
+}
+
+func TestSyslogForwardLogs(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Messages are framed by their length.
+		r := bufio.NewReader(conn)
+		var length int
+		if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+			t.Error(err)
+			return
+		}
+		message := make([]byte, length)
+		if _, err := io.ReadFull(r, message); err != nil {
+			t.Error(err)
+		}
+		received <- string(message)
+	}()
+
+	f, err := NewSyslogForwarder("tcp://"+listener.Addr().String(), "auth", "openvpn_exporter", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go f.Run()
+	logPath := filepath.Join(t.TempDir(), "server.log")
+	if err := os.WriteFile(logPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewLogCollector([]string{logPath}, time.Minute)
+	c.SetSyslog(f)
+	c.read(true)
+	line := "2026-10-17 06:19:39 198.51.100.7:51234 TLS Auth Error: Auth Username/Password verification failed for peer\n"
+	if err := os.WriteFile(logPath, []byte("2026-10-17 06:19:38 TLS Error: TLS handshake failed\n"+line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.read(false)
+
+	select {
+	case message := <-received:
+		pattern := regexp.MustCompile(`^<36>1 \S+ \S+ openvpn_exporter [0-9]+ auth-failure - \{.*"reason":"password","message":"(.*)"\}$`)
+		match := pattern.FindStringSubmatch(message)
+		if match == nil || match[1] != strings.TrimSpace(line) {
+			t.Errorf("got message %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
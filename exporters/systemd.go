@@ -0,0 +1,141 @@
+package exporters
+
+import (
+	"context"
+	"github.com/godbus/dbus/v5"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SystemdDiscoverer discovers OpenVPN instances run by the
+// openvpn-server@.service and openvpn-client@.service units shipped with
+// OpenVPN, by listing the units through systemd's D-Bus interface. Each
+// unit becomes a status source named after the unit, whose status path is
+// derived from the instance name (%i) of the unit.
+type SystemdDiscoverer struct {
+	serverStatusPath string
+	clientStatusPath string
+	interval         time.Duration
+	update           func(sources []StatusSource) error
+}
+
+// NewSystemdDiscoverer creates a discoverer of the units whose status
+// path template is set, in which {instance} is replaced by the instance
+// name of the unit. The update function is called with the discovered
+// sources whenever units start or stop, and again at the next interval if
+// it fails.
+func NewSystemdDiscoverer(serverStatusPath string, clientStatusPath string, interval time.Duration, update func(sources []StatusSource) error) *SystemdDiscoverer {
+	return &SystemdDiscoverer{
+		serverStatusPath: serverStatusPath,
+		clientStatusPath: clientStatusPath,
+		interval:         interval,
+		update:           update,
+	}
+}
+
+// Discover lists the units that are running, or starting, restarting or
+// stopping, and returns their status sources, ordered by name. Units that
+// keep failing to start remain listed while systemd restarts them, so
+// that they're reported as down.
+func (d *SystemdDiscoverer) Discover() ([]StatusSource, error) {
+	templates := map[string]string{}
+	var patterns []string
+	if d.serverStatusPath != "" {
+		templates["openvpn-server@"] = d.serverStatusPath
+		patterns = append(patterns, "openvpn-server@*.service")
+	}
+	if d.clientStatusPath != "" {
+		templates["openvpn-client@"] = d.clientStatusPath
+		patterns = append(patterns, "openvpn-client@*.service")
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	units, err := listSystemdUnits([]string{"active", "activating", "deactivating", "reloading"}, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []StatusSource
+	for _, unit := range units {
+		prefix, instance, ok := strings.Cut(strings.TrimSuffix(unit, ".service"), "@")
+		if !ok || instance == "" {
+			continue
+		}
+		sources = append(sources, StatusSource{
+			Name:   unit,
+			Type:   "file",
+			Path:   strings.ReplaceAll(templates[prefix+"@"], "{instance}", instance),
+			Labels: map[string]string{"instance_name": instance},
+		})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+	return sources, nil
+}
+
+// Run discovers the units every interval, calling the update function if
+// they changed since the previous discovery, starting from the given
+// sources. It never returns.
+func (d *SystemdDiscoverer) Run(sources []StatusSource) {
+	for {
+		time.Sleep(d.interval)
+		discovered, err := d.Discover()
+		if err != nil {
+			slog.Error("Failed to discover systemd units", "err", err)
+			continue
+		}
+		if reflect.DeepEqual(discovered, sources) {
+			continue
+		}
+		if err := d.update(discovered); err != nil {
+			slog.Error("Failed to update discovered systemd units", "err", err)
+			continue
+		}
+		sources = discovered
+	}
+}
+
+// A unit as listed by ListUnitsByPatterns.
+type systemdUnit struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Followed    string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+// Lists the names of the units in one of the given states matching one of
+// the patterns, through the system bus.
+func listSystemdUnits(states []string, patterns []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var units []systemdUnit
+	err = conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1").
+		CallWithContext(ctx, "org.freedesktop.systemd1.Manager.ListUnitsByPatterns", 0, states, patterns).
+		Store(&units)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, unit := range units {
+		names = append(names, unit.Name)
+	}
+	return names, nil
+}
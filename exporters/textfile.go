@@ -0,0 +1,75 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TextfileWriter periodically writes the metrics of the exporter to a file
+// in the text exposition format, to be picked up by the textfile collector
+// of node_exporter on hosts where running another listening daemon is not
+// allowed. Only metrics prefixed with openvpn_ are written, as the metrics
+// of the Go runtime would conflict with those of node_exporter itself.
+type TextfileWriter struct {
+	path     string
+	gatherer prometheus.Gatherer
+	interval time.Duration
+}
+
+func NewTextfileWriter(path string, gatherer prometheus.Gatherer, interval time.Duration) *TextfileWriter {
+	return &TextfileWriter{
+		path:     path,
+		gatherer: gatherer,
+		interval: interval,
+	}
+}
+
+// Write gathers the metrics and writes them to the file. The file is
+// replaced atomically, so that node_exporter never reads a partial file.
+func (w *TextfileWriter) Write() error {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(w.path), filepath.Base(w.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "openvpn_") {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(tmp, family); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), w.path)
+}
+
+// Run writes the file every interval. It never returns.
+func (w *TextfileWriter) Run() {
+	for {
+		if err := w.Write(); err != nil {
+			slog.Error("Failed to write metrics to textfile", "path", w.path, "err", err)
+		}
+		time.Sleep(w.interval)
+	}
+}
@@ -0,0 +1,165 @@
+package exporters
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+type zabbixRequest struct {
+	Request string       `json:"request"`
+	Data    []zabbixItem `json:"data"`
+	Clock   int64        `json:"clock"`
+}
+
+type zabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// ZabbixSender periodically pushes the number of connected clients, the
+// traffic and the status of every OpenVPN instance to a Zabbix server or
+// proxy, using the protocol of zabbix_sender. For every status path, the
+// items <prefix>.up["<status_path>"], <prefix>.clients["<status_path>"],
+// <prefix>.received_bytes["<status_path>"] and
+// <prefix>.sent_bytes["<status_path>"] are sent, which should be configured
+// as trapper items in Zabbix.
+type ZabbixSender struct {
+	server    string
+	host      string
+	hosts     map[string]string
+	keyPrefix string
+	gatherer  prometheus.Gatherer
+	interval  time.Duration
+	timeout   time.Duration
+}
+
+// NewZabbixSender creates a sender that reports the instances under the
+// given Zabbix host name, unless their status path is mapped to another
+// host name.
+func NewZabbixSender(server string, host string, hosts map[string]string, keyPrefix string, gatherer prometheus.Gatherer, interval time.Duration, timeout time.Duration) *ZabbixSender {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "10051")
+	}
+	return &ZabbixSender{
+		server:    server,
+		host:      host,
+		hosts:     hosts,
+		keyPrefix: keyPrefix,
+		gatherer:  gatherer,
+		interval:  interval,
+		timeout:   timeout,
+	}
+}
+
+func (s *ZabbixSender) items(now time.Time) ([]zabbixItem, error) {
+	instances, err := summarizeInstances(s.gatherer)
+	if err != nil {
+		return nil, err
+	}
+	var items []zabbixItem
+	for _, instance := range instances {
+		host := s.host
+		if h, ok := s.hosts[instance.statusPath]; ok {
+			host = h
+		}
+		for _, item := range []struct {
+			name  string
+			value float64
+		}{
+			{"up", instance.up},
+			{"clients", instance.clients},
+			{"received_bytes", instance.received},
+			{"sent_bytes", instance.sent},
+		} {
+			items = append(items, zabbixItem{
+				Host:  host,
+				Key:   fmt.Sprintf("%s.%s[%s]", s.keyPrefix, item.name, zabbixKeyParameter(instance.statusPath)),
+				Value: strconv.FormatFloat(item.value, 'f', -1, 64),
+				Clock: now.Unix(),
+			})
+		}
+	}
+	return items, nil
+}
+
+// Quotes a parameter of an item key. Zabbix only allows escaping double
+// quotes within quoted parameters, so a trailing backslash can't be
+// represented and is dropped.
+func zabbixKeyParameter(s string) string {
+	s = strings.TrimRight(s, "\\")
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// Sends the items to the Zabbix server, returning its summary of the
+// number of processed and failed items.
+func (s *ZabbixSender) send(items []zabbixItem, now time.Time) (string, error) {
+	body, err := json.Marshal(zabbixRequest{Request: "sender data", Data: items, Clock: now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.DialTimeout("tcp", s.server, s.timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(now.Add(s.timeout))
+
+	// Protocol header, flags and little endian data length.
+	packet := append([]byte("ZBXD\x01"), make([]byte, 8)...)
+	binary.LittleEndian.PutUint64(packet[5:], uint64(len(body)))
+	if _, err := conn.Write(append(packet, body...)); err != nil {
+		return "", err
+	}
+
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if string(header[:4]) != "ZBXD" {
+		return "", errors.New("invalid response header from Zabbix server")
+	}
+	data := make([]byte, binary.LittleEndian.Uint32(header[5:9]))
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return "", err
+	}
+	var response zabbixResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", err
+	}
+	if response.Response != "success" {
+		return "", fmt.Errorf("Zabbix server responded with %q: %s", response.Response, response.Info)
+	}
+	return response.Info, nil
+}
+
+// Run sends the items at the configured interval. It never returns.
+func (s *ZabbixSender) Run() {
+	for {
+		now := time.Now()
+		items, err := s.items(now)
+		if err != nil {
+			slog.Error("Failed to gather metrics for Zabbix", "err", err)
+		} else if info, err := s.send(items, now); err != nil {
+			slog.Error("Failed to send metrics to Zabbix server", "server", s.server, "err", err)
+		} else if !strings.Contains(info, "failed: 0;") {
+			slog.Warn("Zabbix server did not accept all items", "server", s.server, "info", info)
+		}
+		time.Sleep(s.interval)
+	}
+}
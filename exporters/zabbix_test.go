@@ -0,0 +1,72 @@
+package exporters
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestZabbixKeyParameter(t *testing.T) {
+	for s, want := range map[string]string{
+		"/var/run/openvpn/server.status": `"/var/run/openvpn/server.status"`,
+		`/tmp/a "b".status`:              `"/tmp/a \"b\".status"`,
+		`C:\OpenVPN\log\`:                `"C:\OpenVPN\log"`,
+	} {
+		if got := zabbixKeyParameter(s); got != want {
+			t.Errorf("zabbixKeyParameter(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestZabbixSend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan zabbixRequest, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		header := make([]byte, 13)
+		if _, err := io.ReadFull(conn, header); err != nil || string(header[:5]) != "ZBXD\x01" {
+			t.Errorf("invalid request header % x (%v)", header, err)
+			return
+		}
+		body := make([]byte, binary.LittleEndian.Uint64(header[5:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			t.Error(err)
+			return
+		}
+		var request zabbixRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Error(err)
+		}
+		received <- request
+
+		response := []byte(`{"response":"success","info":"processed: 1; failed: 0; total: 1; seconds spent: 0.000055"}`)
+		header = append([]byte("ZBXD\x01"), make([]byte, 8)...)
+		binary.LittleEndian.PutUint32(header[5:], uint32(len(response)))
+		conn.Write(append(header, response...))
+	}()
+
+	s := NewZabbixSender(listener.Addr().String(), "vpn", nil, "openvpn", nil, time.Minute, time.Second)
+	items := []zabbixItem{{Host: "vpn", Key: `openvpn.up["/tmp/a \"b\".status"]`, Value: "1", Clock: 1700000000}}
+	info, err := s.send(items, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != "processed: 1; failed: 0; total: 1; seconds spent: 0.000055" {
+		t.Errorf("got info %q", info)
+	}
+	request := <-received
+	if request.Request != "sender data" || len(request.Data) != 1 || request.Data[0] != items[0] {
+		t.Errorf("got request %+v", request)
+	}
+}
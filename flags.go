@@ -0,0 +1,74 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// A flag that may be passed multiple times, collecting its values in
+// order. Unlike comma separated flags, values may contain commas.
+type repeatedFlag []string
+
+func newRepeatedFlag(name string, usage string) *repeatedFlag {
+	var f repeatedFlag
+	flag.Var(&f, name, usage)
+	return &f
+}
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Returns whether the flag with the given name was passed.
+func isFlagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// Returns the value of an environment variable used as the default of a
+// flag, or def if it isn't set.
+func envDefault(key string, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return def
+}
+
+// Returns the bearer token contained in the file passed using a flag,
+// exiting if it can't be read or is empty.
+func readTokenFile(name string, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal("Failed to read token file", "flag", name, "path", path, "err", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		fatal("Token file is empty", "flag", name, "path", path)
+	}
+	return token
+}
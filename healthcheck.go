@@ -0,0 +1,80 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Scrapes the metrics endpoint of an exporter running on the local host,
+// returning an error if it can't be scraped or if any of its status files
+// failed to be read. Used as a container health check, so that images
+// don't need to ship an HTTP client.
+func healthcheck(listenAddress string, metricsPath string, useTLS bool, timeout time.Duration) error {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// The certificate is unlikely to be valid for localhost.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get(scheme + "://" + net.JoinHostPort(host, port) + metricsPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return err
+	}
+	return checkUp(families["openvpn_up"])
+}
+
+// Returns an error naming the first status file reported as down by the
+// openvpn_up metric family, which may be nil.
+func checkUp(up *dto.MetricFamily) error {
+	for _, metric := range up.GetMetric() {
+		if metric.GetGauge().GetValue() != 1 {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "status_path" {
+					return fmt.Errorf("failed to read status file %s", label.GetValue())
+				}
+			}
+			return fmt.Errorf("failed to read status file")
+		}
+	}
+	return nil
+}
@@ -14,46 +14,866 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
+	"fmt"
 	"github.com/kumina/openvpn_exporter/exporters"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"log"
+	"github.com/prometheus/common/version"
+	"io/ioutil"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		os.Exit(0)
+	}
+
 	var (
-		listenAddress      = flag.String("web.listen-address", ":9176", "Address to listen on for web interface and telemetry.")
-		metricsPath        = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-		openvpnStatusPaths = flag.String("openvpn.status_paths", "examples/client.status,examples/server2.status,examples/server3.status", "Paths at which OpenVPN places its status files.")
+		listenAddress      = flag.String("web.listen-address", envDefault("OPENVPN_EXPORTER_WEB_LISTEN_ADDRESS", ":9176"), "Address to listen on for web interface and telemetry, defaulting to $OPENVPN_EXPORTER_WEB_LISTEN_ADDRESS if set. Disabled if empty, e.g. when only writing metrics to -textfile.path or pushing them to -push.gateway-url or -remote-write.url.")
+		metricsPath        = flag.String("web.telemetry-path", envDefault("OPENVPN_EXPORTER_WEB_TELEMETRY_PATH", "/metrics"), "Path under which to expose metrics, defaulting to $OPENVPN_EXPORTER_WEB_TELEMETRY_PATH if set.")
+		tlsCertFile        = flag.String("web.tls-cert-file", "", "Certificate file for serving the web interface over TLS. Reloaded on change and on SIGHUP.")
+		tlsKeyFile         = flag.String("web.tls-key-file", "", "Key file for serving the web interface over TLS. Reloaded on change and on SIGHUP.")
+		tlsReloadInterval  = flag.Duration("web.tls-reload-interval", 10*time.Second, "Interval at which to check the TLS certificate and key files for changes.")
+		enableLifecycle    = flag.Bool("web.enable-lifecycle", false, "Reload the configuration file on POST requests to /-/reload, which anyone able to reach -web.listen-address can send. The configuration file is reloaded on SIGHUP either way.")
+		configFile         = flag.String("config.file", "", "YAML file declaring the status sources to collect from, each with its own name, labels and options. Replaces -openvpn.status_path, -openvpn.status_paths and -openvpn.management_addresses if set.")
+		discoverSystemd    = flag.Bool("discover.systemd", false, "Discover OpenVPN instances run by openvpn-server@ and openvpn-client@ systemd units through D-Bus, collecting them in addition to the other status sources while their units are running.")
+		discoverInterval   = flag.Duration("discover.systemd.interval", 30*time.Second, "Interval at which to discover OpenVPN instances run by systemd units.")
+		discoverServerPath = flag.String("discover.systemd.server-status-path", "/run/openvpn-server/status-{instance}.log", "Status path of instances run by openvpn-server@ units, in which {instance} is replaced by the instance name of the unit. Such units aren't discovered if empty.")
+		discoverClientPath = flag.String("discover.systemd.client-status-path", "", "Status path of instances run by openvpn-client@ units, in which {instance} is replaced by the instance name of the unit, e.g. unix:///run/openvpn-client/{instance}.sock for a management interface. Such units aren't discovered if empty.")
+		discoverDirs       = flag.String("discover.directories", "", "Comma separated directories to watch for status files, collecting every file matching -discover.directories.pattern as a status source of its own while it exists.")
+		discoverPattern    = flag.String("discover.directories.pattern", "*", "Glob pattern that the names of status files in the directories passed using -discover.directories should match.")
+		discoverRescan     = flag.Duration("discover.directories.rescan-interval", 30*time.Second, "Interval at which to rescan the directories passed using -discover.directories, besides doing so when files are created or removed in them.")
+		openvpnStatusPath  = newRepeatedFlag("openvpn.status_path", "Path at which OpenVPN places its status file, optionally written as <name>=<path> to add an instance_name label. May be passed multiple times, and replaces the default of -openvpn.status_paths. Unlike the latter, paths may contain commas and colons.")
+		openvpnStatusPaths = flag.String("openvpn.status_paths", "examples/client.status,examples/server2.status,examples/server3.status", "Comma separated paths at which OpenVPN places its status files, optionally written as <name>:<path> or <name>=<path> to add an instance_name label. Local paths may be glob patterns.")
+		managementAddrs    = flag.String("openvpn.management_addresses", "", "Comma separated addresses of OpenVPN management interfaces to collect statistics from, in addition to the status paths, written as host:port or as the path of a unix socket.")
+		managementPassword = flag.String("openvpn.management_password_file", "", "File containing the password of the management interfaces passed using -openvpn.management_addresses.")
+		managementInterval = flag.Duration("openvpn.management_bytecount_interval", 0, "Interval at which the management interfaces passed using -openvpn.management_addresses send the byte counts of their clients, which are kept in memory and replace the traffic of their status. Byte counts are only read along with the status if zero.")
+		logPaths           = flag.String("openvpn.log_paths", "", "Comma separated OpenVPN server logs to follow, counting failed authentications, rejected connections and TLS errors. Disabled if empty.")
+		logPollInterval    = flag.Duration("openvpn.log_poll_interval", time.Second, "Interval at which to read new messages from the OpenVPN server logs.")
+		pidFiles           = flag.String("openvpn.pid_files", "", "Comma separated pid files written by OpenVPN daemons (--writepid), optionally written as <name>:<path> or <name>=<path> to set the instance_name label, to export whether the daemons are running.")
+		systemdUnits       = flag.String("openvpn.systemd_units", "", "Comma separated systemd units running OpenVPN daemons, optionally written as <name>:<unit> to set the instance_name label, to export whether the daemons are running.")
+		systemdTimeout     = flag.Duration("openvpn.systemd_timeout", 5*time.Second, "Timeout for querying systemd for the process of a unit passed using -openvpn.systemd_units.")
+		defaultHeaders     = flag.Bool("parse.default-headers", false, "Fall back to OpenVPN's default column layout for CLIENT_LIST and ROUTING_TABLE entries of server status files lacking a HEADER, e.g. because they were truncated or stripped.")
 		ignoreIndividuals  = flag.Bool("ignore.individuals", false, "If ignoring metrics for individuals")
+		collectServer      = flag.Bool("collector.server_status", true, "Collect the client list of server status files.")
+		aggregateClients   = flag.Bool("collector.server_status.aggregate", false, "Label client metrics by common name only, summing the traffic of its sessions and counting them, rather than exporting metrics per connection.")
+		churnByCommonName  = flag.Bool("collector.server_status.churn-by-common-name", false, "Count the sessions started and ended per common name rather than per status file.")
+		clientLabels       = flag.String("collector.server_status.labels", "", "Comma separated labels to attach to client metrics when not ignoring individuals, out of common_name, connection_time, real_address, real_ip, virtual_address, virtual_ipv6_address, username, client_id and peer_id. All but real_ip, virtual_ipv6_address, client_id and peer_id if empty.")
+		collectRouting     = flag.Bool("collector.routing", true, "Collect the routing table of server status files.")
+		routeLabels        = flag.String("collector.routing.labels", "", "Comma separated labels to attach to route metrics when not ignoring individuals, out of common_name, real_address, real_ip and virtual_address. All but real_ip if empty.")
+		clientRoutes       = flag.Bool("collector.routing.client-routes", false, "Export the number of routes per common name, to detect clients whose iroutes are missing.")
+		collectGlobalStats = flag.Bool("collector.global_stats", true, "Collect the global statistics of server status files.")
+		columnsFile        = flag.String("collector.columns.file", "", "CSV file declaring additional metrics to export from columns of server status files, with a header row of section,column,name,type,labels.")
+		asnDatabase        = flag.String("asn.database", "", "MaxMind ASN database (e.g. GeoLite2-ASN.mmdb) used to count connected clients per autonomous system. Disabled if empty.")
+		geoipDatabase      = flag.String("geoip.database", "", "MaxMind Country or City database (e.g. GeoLite2-Country.mmdb) used to count connected clients per country, and export the country of every connection when not ignoring individuals. Disabled if empty.")
+		collectClient      = flag.Bool("collector.client_status", true, "Collect client status files. If disabled, client status files are skipped without exporting any metrics for them.")
+		realAddress        = flag.String("privacy.real-address", "keep", "How to export the real addresses of clients: keep, hash (replacing them by a salted hash) or drop (removing the real_address label).")
+		realAddressSalt    = flag.String("privacy.real-address.salt-file", "", "File containing the salt used to hash real addresses. A random salt is used if empty, which changes the hashes whenever the exporter restarts.")
+		sessionIndex       = flag.Bool("ignore.individuals.session-index", false, "When ignoring individuals, add a session label numbering the sessions of a common name, so that sessions sharing a common name aren't dropped.")
+		cumulativeCounters = flag.Bool("collect.cumulative-counters", false, "Keep counters monotonic across OpenVPN restarts and client reconnects by adding their values prior to being reset. Only affects series whose labels survive resets, i.e. the totals of client status files and per-client counters with -ignore.individuals or -collector.server_status.aggregate, as per-client series are labeled by the time clients connected otherwise.")
+		collectConcurrency = flag.Int("collect.concurrency", 8, "Maximum number of status files to collect concurrently.")
+		collectTimeout     = flag.Duration("collect.timeout", 5*time.Second, "Timeout for reading a status file, after which it's reported as down. Disabled if zero.")
+		cacheTTL           = flag.Duration("collect.cache-ttl", 0, "Serve the metrics of status files collected less than this long ago from a cache, e.g. to multiple Prometheus servers. Disabled if zero.")
+		collectWatch       = flag.Bool("collect.watch", false, "Watch status files for changes, only collecting them again once they have been written to.")
+		staleThreshold     = flag.Duration("collect.stale-threshold", 0, "Count scrapes of status files that haven't been updated for this long in openvpn_scrape_errors_total, with reason stale. Disabled if zero.")
+		hooksPath          = flag.String("hooks.path", "", "Path under which to receive client-connect/client-disconnect script events. Disabled if empty.")
+		hooksListenSocket  = flag.String("hooks.listen-socket", "", "Unix socket on which to receive script events, under -hooks.path, instead of on -web.listen-address.")
+		hooksTokenFile     = flag.String("hooks.token-file", "", "File containing the bearer token required for script events received on -web.listen-address. Required unless -hooks.listen-socket is set.")
+		hooksInstances     = flag.String("hooks.instance-names", "", "Comma separated instance names that script events may carry. If empty, any valid instance name is accepted, up to 64 of them.")
+		hooksSessionsFile  = flag.String("hooks.sessions-file", "", "File to append a JSON record of every ended client session to, as reported by client-disconnect scripts. Disabled if empty.")
+		hooksArchiveURL    = flag.String("hooks.sessions-archive.url", "", "URL of an S3 compatible bucket, optionally followed by a prefix, to upload the file passed using -hooks.sessions-file to, compressed, after rotating it every -hooks.sessions-archive.interval, e.g. https://s3.eu-west-1.amazonaws.com/bucket/openvpn or https://storage.googleapis.com/bucket/openvpn. Disabled if empty.")
+		hooksArchiveRegion = flag.String("hooks.sessions-archive.region", "us-east-1", "Region of the bucket passed using -hooks.sessions-archive.url, for signing requests. Google Cloud Storage accepts any region.")
+		hooksArchiveKeyID  = flag.String("hooks.sessions-archive.access-key-id", "", "Access key ID for uploading to -hooks.sessions-archive.url, e.g. an HMAC key for Google Cloud Storage.")
+		hooksArchiveSecret = flag.String("hooks.sessions-archive.secret-access-key-file", "", "File containing the secret access key for uploading to -hooks.sessions-archive.url.")
+		hooksArchiveInt    = flag.Duration("hooks.sessions-archive.interval", 24*time.Hour, "Interval at which to rotate the file passed using -hooks.sessions-file and upload it to -hooks.sessions-archive.url.")
+		hooksArchiveTime   = flag.Duration("hooks.sessions-archive.timeout", time.Minute, "Timeout for uploading a rotated sessions file to -hooks.sessions-archive.url.")
+		hooksWebhookURL    = flag.String("hooks.webhook-url", "", "URL to POST every script event to as JSON. Disabled if empty.")
+		hooksWebhookTime   = flag.Duration("hooks.webhook-timeout", 5*time.Second, "Timeout for requests to -hooks.webhook-url.")
+		syslogAddress      = flag.String("syslog.address", "", "Syslog collector to forward client-connect/client-disconnect script events and authentication failures logged by OpenVPN to as RFC 5424 messages, written as udp://host:port, tcp://host:port or unix:///path. Disabled if empty.")
+		syslogFacility     = flag.String("syslog.facility", "daemon", "Facility of the messages forwarded to -syslog.address, e.g. auth, daemon or local0.")
+		syslogAppName      = flag.String("syslog.app-name", "openvpn_exporter", "Application name of the messages forwarded to -syslog.address.")
+		syslogTimeout      = flag.Duration("syslog.timeout", 5*time.Second, "Timeout for connecting to and sending messages to -syslog.address.")
+		federationTargets  = flag.String("federation.targets", "", "Comma separated URLs of other openvpn_exporter metrics endpoints to federate.")
+		federationTimeout  = flag.Duration("federation.timeout", 8*time.Second, "Timeout for scraping the federated exporters, which are scraped concurrently. Should be shorter than the scrape timeout of Prometheus.")
+		probeAddresses     = flag.String("probe.addresses", "", "Comma separated OpenVPN ports to probe, written as udp://host:port or tcp://host:port.")
+		probeTimeout       = flag.Duration("probe.timeout", 5*time.Second, "Timeout for probing an OpenVPN port.")
+		handshakeProfiles  = flag.String("handshake.profiles", "", "Comma separated OpenVPN client profiles used to periodically probe whether connections can be established.")
+		handshakeInterval  = flag.Duration("handshake.interval", time.Minute, "Interval at which to establish connections using the handshake profiles.")
+		handshakeTimeout   = flag.Duration("handshake.timeout", 30*time.Second, "Timeout for establishing a connection using a handshake profile.")
+		handshakeBinary    = flag.String("handshake.openvpn-binary", "openvpn", "OpenVPN binary used to establish connections using the handshake profiles.")
+		pingClients        = flag.Bool("ping.clients", false, "Periodically ping the virtual address of connected clients.")
+		pingInterval       = flag.Duration("ping.interval", time.Minute, "Interval at which to ping connected clients.")
+		pingTimeout        = flag.Duration("ping.timeout", time.Second, "Timeout for receiving an echo reply.")
+		pingCount          = flag.Int("ping.count", 3, "Number of echo requests to send to each client per interval.")
+		pingConcurrency    = flag.Int("ping.concurrency", 16, "Maximum number of clients to ping concurrently.")
+		pingRate           = flag.Int("ping.rate", 100, "Maximum number of echo requests to send per second, up to 10000.")
+		pingPrivileged     = flag.Bool("ping.privileged", false, "Use raw sockets for pinging clients, which requires CAP_NET_RAW.")
+		quotaFile          = flag.String("quota.file", "", "CSV file containing traffic quotas per common name, as common_name,bytes[,reset_day].")
+		quotaInterval      = flag.Duration("quota.interval", time.Minute, "Interval at which to accumulate client traffic for quotas.")
+		stateFile          = flag.String("state.file", "", "File in which to persist cumulative counters, session churn and idle times, and quota usage across restarts.")
+		stateInterval      = flag.Duration("state.interval", time.Minute, "Interval at which to write the state file.")
+		agentxMaster       = flag.String("agentx.master", "", "AgentX master agent to register with as a subagent, written as unix:///path or tcp://host:port. Disabled if empty.")
+		agentxBaseOID      = flag.String("agentx.base-oid", "1.3.6.1.4.1.8072.9999.9999.1194", "OID below which to expose objects over AgentX.")
+		agentxTimeout      = flag.Duration("agentx.timeout", 5*time.Second, "Timeout for connecting to the AgentX master agent, also used as the session timeout.")
+		zabbixServer       = flag.String("zabbix.server", "", "Zabbix server or proxy to push metrics to, written as host[:port]. Disabled if empty.")
+		zabbixHost         = flag.String("zabbix.host", "", "Zabbix host name under which to push metrics. Defaults to the system's host name.")
+		zabbixHosts        = flag.String("zabbix.hosts", "", "Comma separated status_path=host pairs, overriding the Zabbix host name per status file.")
+		zabbixKeyPrefix    = flag.String("zabbix.key-prefix", "openvpn", "Prefix of the Zabbix item keys.")
+		zabbixInterval     = flag.Duration("zabbix.interval", time.Minute, "Interval at which to push metrics to Zabbix.")
+		zabbixTimeout      = flag.Duration("zabbix.timeout", 10*time.Second, "Timeout for pushing metrics to Zabbix.")
+		pushGatewayURL     = flag.String("push.gateway-url", "", "URL of a Pushgateway to periodically push metrics to, e.g. when Prometheus can't reach this host. May contain credentials for basic authentication. Disabled if empty.")
+		pushInterval       = flag.Duration("push.interval", time.Minute, "Interval at which to push metrics to the Pushgateway.")
+		pushJob            = flag.String("push.job", "openvpn", "Job label under which to push metrics to the Pushgateway.")
+		pushInstance       = flag.String("push.instance", "", "Instance label under which to push metrics to the Pushgateway. Defaults to the system's host name.")
+		pushTimeout        = flag.Duration("push.timeout", 10*time.Second, "Timeout for pushing metrics to the Pushgateway.")
+		remoteWriteURL     = flag.String("remote-write.url", "", "Remote write endpoint of a Prometheus compatible database to periodically send metrics to, e.g. https://prometheus.example.com/api/v1/write. Disabled if empty.")
+		remoteWriteInt     = flag.Duration("remote-write.interval", 30*time.Second, "Interval at which to collect and send metrics using remote write.")
+		remoteWriteTimeout = flag.Duration("remote-write.timeout", 10*time.Second, "Timeout for sending metrics using remote write.")
+		remoteWriteJob     = flag.String("remote-write.job", "openvpn", "Job label of the series sent using remote write.")
+		remoteWriteInst    = flag.String("remote-write.instance", "", "Instance label of the series sent using remote write. Defaults to the system's host name.")
+		remoteWriteUser    = flag.String("remote-write.username", "", "Username for basic authentication with the remote write endpoint.")
+		remoteWritePass    = flag.String("remote-write.password-file", "", "File containing the password for basic authentication with the remote write endpoint.")
+		remoteWriteToken   = flag.String("remote-write.bearer-token-file", "", "File containing the bearer token for authenticating with the remote write endpoint.")
+		remoteWriteCA      = flag.String("remote-write.tls-ca-file", "", "CA certificates with which to verify the remote write endpoint, in addition to the system's.")
+		remoteWriteCert    = flag.String("remote-write.tls-cert-file", "", "Client certificate to present to the remote write endpoint.")
+		remoteWriteKey     = flag.String("remote-write.tls-key-file", "", "Key of the client certificate to present to the remote write endpoint.")
+		remoteWriteInsec   = flag.Bool("remote-write.tls-insecure-skip-verify", false, "Don't verify the certificate of the remote write endpoint.")
+		anomalyDetect      = flag.Bool("anomaly.detect", false, "Track the transfer rate of clients and flag rates that deviate from their moving average.")
+		anomalyInterval    = flag.Duration("anomaly.interval", time.Minute, "Interval at which to measure client transfer rates.")
+		anomalyHalfLife    = flag.Duration("anomaly.half-life", time.Hour, "Half-life of the exponentially weighted moving average of client transfer rates.")
+		anomalyFactor      = flag.Float64("anomaly.factor", 10, "Factor by which a client's transfer rate must exceed its average to be flagged as anomalous.")
+		anomalyMinRate     = flag.Float64("anomaly.min-rate", 1024, "Minimum average transfer rate in bytes per second, to avoid flagging mostly idle clients.")
+		metadataFile       = flag.String("metadata.file", "", "CSV file containing labels to attach to the metrics of each common name, with a header row of common_name followed by label names.")
+		metadataInterval   = flag.Duration("metadata.reload-interval", 10*time.Second, "Interval at which to check the metadata file for changes.")
+		ldapURL            = flag.String("ldap.url", "", "LDAP server in which to look up the usernames of connected clients, written as ldap://host:port or ldaps://host:port. Disabled if empty.")
+		ldapBindDN         = flag.String("ldap.bind-dn", "", "DN to bind to the LDAP server as. Binds anonymously if empty.")
+		ldapBindPassword   = flag.String("ldap.bind-password-file", "", "File containing the password for binding to the LDAP server.")
+		ldapBaseDN         = flag.String("ldap.base-dn", "", "DN below which to search for users.")
+		ldapFilter         = flag.String("ldap.filter", "(uid=%s)", "LDAP filter for looking up a user, in which %s is replaced by the username. Use (sAMAccountName=%s) for Active Directory.")
+		ldapAttributes     = flag.String("ldap.attributes", "department", "Comma separated LDAP attributes to export as labels of openvpn_server_user_ldap_info.")
+		ldapCacheTTL       = flag.Duration("ldap.cache-ttl", time.Hour, "Duration for which to cache the attributes of a user.")
+		ldapTimeout        = flag.Duration("ldap.timeout", 5*time.Second, "Timeout for LDAP requests.")
+		ldapInterval       = flag.Duration("ldap.interval", time.Minute, "Interval at which to look up the users that connected since.")
+		enrichmentURL      = flag.String("enrichment.url", "", "URL of an HTTP service returning labels for a common name as a JSON object, in which %s is replaced by the escaped common name, in either the path or the query. Disabled if empty.")
+		enrichmentLabels   = flag.String("enrichment.labels", "", "Comma separated labels returned by the enrichment service to export.")
+		enrichmentCacheTTL = flag.Duration("enrichment.cache-ttl", time.Hour, "Duration for which to cache the labels of a common name.")
+		enrichmentTimeout  = flag.Duration("enrichment.timeout", 5*time.Second, "Timeout for requests to the enrichment service.")
+		enrichmentInterval = flag.Duration("enrichment.interval", time.Minute, "Interval at which to look up the common names that connected since.")
+		coverageCCDDir     = flag.String("coverage.ccd-dir", "", "OpenVPN client-config-dir whose files name the clients expected to be connected, for reporting which of them are offline. Disabled if empty.")
+		textfilePath       = flag.String("textfile.path", "", "File to periodically write metrics to, for node_exporter's textfile collector. Should end in .prom. Disabled if empty.")
+		textfileInterval   = flag.Duration("textfile.interval", time.Minute, "Interval at which to write metrics to the textfile.")
+		apiTokenFile       = flag.String("api.token-file", "", "File containing the bearer token required for /api/v1/clients, which serves the clients connected to each server as JSON. Disabled if empty.")
+		corsOrigins        = flag.String("web.cors-origins", "", "Comma separated origins of web pages allowed to request /api/v1/clients from the browser, or * to allow any.")
+		debugTokenFile     = flag.String("debug.token-file", "", "File containing the bearer token required for /debug/status, which serves the raw contents of status files as last read. Disabled if empty.")
+		logLevel           = flag.String("log.level", "info", "Only log messages with the given severity or above: debug, info, warn or error.")
+		logFormat          = flag.String("log.format", "logfmt", "Output format of log messages: logfmt or json.")
+		printVersion       = flag.Bool("version", false, "Print version information and exit.")
+		once               = flag.Bool("once", false, "Instead of serving metrics, print the metrics of the status sources to stdout once and exit, with 1 if any of them failed to be read.")
+		healthcheckMode    = flag.Bool("healthcheck", false, "Instead of serving metrics, check the health of an exporter running on the local host with the same flags, exiting with 0 if healthy and 1 otherwise.")
 	)
 	flag.Parse()
 
-	log.Printf("Starting OpenVPN Exporter\n")
-	log.Printf("Listen address: %v\n", *listenAddress)
-	log.Printf("Metrics path: %v\n", *metricsPath)
-	log.Printf("openvpn.status_path: %v\n", *openvpnStatusPaths)
-	log.Printf("Ignore Individuals: %v\n", *ignoreIndividuals)
+	if *printVersion {
+		fmt.Println(version.Print("openvpn_exporter"))
+		os.Exit(0)
+	}
+
+	logger, err := newLogger(*logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	if *healthcheckMode {
+		if err := healthcheck(*listenAddress, *metricsPath, *tlsCertFile != "", 10*time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "Unhealthy: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	slog.Info("Starting OpenVPN Exporter",
+		"version", version.Info(),
+		"build_context", version.BuildContext(),
+		"listen_address", *listenAddress,
+		"metrics_path", *metricsPath,
+		"config_file", *configFile,
+		"discover_systemd", *discoverSystemd,
+		"discover_directories", *discoverDirs,
+		"status_paths", *openvpnStatusPaths,
+		"status_path", openvpnStatusPath.String(),
+		"management_addresses", *managementAddrs,
+		"log_paths", *logPaths,
+		"pid_files", *pidFiles,
+		"systemd_units", *systemdUnits,
+		"ignore_individuals", *ignoreIndividuals,
+		"cumulative_counters", *cumulativeCounters,
+		"hooks_path", *hooksPath,
+		"federation_targets", *federationTargets,
+		"probe_addresses", *probeAddresses,
+		"handshake_profiles", *handshakeProfiles,
+		"ping_clients", *pingClients,
+		"quota_file", *quotaFile,
+		"state_file", *stateFile,
+		"anomaly_detection", *anomalyDetect,
+		"metadata_file", *metadataFile,
+		"ldap_url", *ldapURL,
+		"enrichment_url", *enrichmentURL,
+		"coverage_ccd_dir", *coverageCCDDir,
+		"agentx_master", *agentxMaster,
+		"zabbix_server", *zabbixServer,
+		"remote_write_url", *remoteWriteURL,
+		"textfile_path", *textfilePath)
+
+	exporters.UseDefaultHeaders(*defaultHeaders)
+	exporters.SetRecentReadTimeout(*collectTimeout)
+
+	// Status sources are either declared in the configuration file, or
+	// passed using flags, in which case they're collected as a whole,
+	// apart from the status paths of named instances.
+	var (
+		flagSources   []exporters.OverviewSource
+		sources       []exporters.StatusSource
+		instanceNames []string
+		instancePaths = map[string][]string{}
+	)
+	if *configFile != "" {
+		config, err := exporters.LoadConfig(*configFile)
+		if err != nil {
+			panic(err)
+		}
+		sources = config.Sources
+	} else {
+		addStatusPath := func(name string, statusPath string) {
+			if _, ok := instancePaths[name]; !ok && name != "" {
+				instanceNames = append(instanceNames, name)
+			}
+			instancePaths[name] = append(instancePaths[name], statusPath)
+			flagSources = append(flagSources, exporters.OverviewSource{Name: name, StatusPath: statusPath})
+		}
+		// Allow running without any local status files, e.g. when
+		// only federating other exporters. The example status files
+		// passed by default are left out when using
+		// -openvpn.status_path.
+		if *openvpnStatusPaths != "" && (len(*openvpnStatusPath) == 0 || isFlagPassed("openvpn.status_paths")) {
+			for _, statusPath := range strings.Split(*openvpnStatusPaths, ",") {
+				addStatusPath(exporters.SplitInstanceName(statusPath))
+			}
+		}
+		for _, statusPath := range *openvpnStatusPath {
+			addStatusPath(exporters.SplitInstanceNameEquals(statusPath))
+		}
+		// Management interfaces are read like status files, under a
+		// status path of tcp://<host>:<port> or unix://<path>.
+		if *managementAddrs != "" {
+			for _, address := range strings.Split(*managementAddrs, ",") {
+				statusPath := exporters.ManagementBytecountStatusPath(address, *managementPassword, *managementInterval)
+				instancePaths[""] = append(instancePaths[""], statusPath)
+				flagSources = append(flagSources, exporters.OverviewSource{StatusPath: statusPath})
+			}
+		}
+	}
+
+	// Stateful collectors are registered with the state file, so that
+	// their state survives restarts of the exporter. The state is saved
+	// periodically and on shutdown.
+	var state *exporters.StateFile
+	// Called before exiting when asked to stop, e.g. by SIGTERM or by
+	// stopping the Windows service.
+	stop := func() {}
+	if *stateFile != "" {
+		var err error
+		state, err = exporters.NewStateFile(*stateFile)
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			for {
+				time.Sleep(*stateInterval)
+				if err := state.Save(); err != nil {
+					slog.Error("Failed to save state", "path", *stateFile, "err", err)
+				}
+			}
+		}()
+		stop = func() {
+			if err := state.Save(); err != nil {
+				fatal("Failed to save state", "path", *stateFile, "err", err)
+			}
+		}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signals
+			stop()
+			os.Exit(0)
+		}()
+	}
+
+	var metadata *exporters.ClientMetadata
+	if *metadataFile != "" {
+		var err error
+		metadata, err = exporters.NewClientMetadata(*metadataFile, *metadataInterval)
+		if err != nil {
+			panic(err)
+		}
+		go metadata.Run()
+	}
+
+	var clientLabelNames, routeLabelNames []string
+	if *clientLabels != "" {
+		clientLabelNames = strings.Split(*clientLabels, ",")
+		if err := exporters.CheckClientLabels(clientLabelNames); err != nil {
+			fatal("Invalid -collector.server_status.labels", "err", err)
+		}
+	}
+	if *routeLabels != "" {
+		routeLabelNames = strings.Split(*routeLabels, ",")
+		if err := exporters.CheckRouteLabels(routeLabelNames); err != nil {
+			fatal("Invalid -collector.routing.labels", "err", err)
+		}
+	}
+
+	privacy, err := exporters.NewRealAddressPrivacy(*realAddress, *realAddressSalt)
+	if err != nil {
+		fatal("Invalid real address privacy setting", "err", err)
+	}
+
+	var columnMappings []exporters.ColumnMapping
+	if *columnsFile != "" {
+		var err error
+		columnMappings, err = exporters.LoadColumnMappings(*columnsFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Creates an exporter for the given status paths, adding the labels
+	// to all of its metrics and giving up on reads after the timeout.
+	// Collectors enabled or disabled for the source and its cache TTL
+	// override the flags.
+	newExporter := func(statusPaths []string, ignore bool, aggregate bool, labels prometheus.Labels, timeout time.Duration, source exporters.StatusSource, stateName string, set *sourceExporters) (*prometheus.Registry, error) {
+		ttl := *cacheTTL
+		if source.CacheTTL > 0 {
+			ttl = source.CacheTTL
+		}
+		exporter, err := exporters.New(exporters.Options{
+			StatusPaths:         statusPaths,
+			IgnoreIndividuals:   ignore,
+			SessionIndex:        *sessionIndex,
+			CumulativeCounters:  *cumulativeCounters,
+			Aggregate:           aggregate,
+			ChurnByCommonName:   *churnByCommonName,
+			ClientLabels:        clientLabelNames,
+			RouteLabels:         routeLabelNames,
+			ClientRoutes:        *clientRoutes,
+			RealAddressPrivacy:  privacy,
+			Metadata:            metadata,
+			DisableServerStatus: !source.CollectorEnabled("server_status", *collectServer),
+			DisableRouting:      !source.CollectorEnabled("routing", *collectRouting),
+			DisableGlobalStats:  !source.CollectorEnabled("global_stats", *collectGlobalStats),
+			DisableClientStatus: !source.CollectorEnabled("client_status", *collectClient),
+			ColumnMappings:      columnMappings,
+			ASNDatabase:         *asnDatabase,
+			GeoIPDatabase:       *geoipDatabase,
+			Concurrency:         *collectConcurrency,
+			Timeout:             timeout,
+			CacheTTL:            ttl,
+			StaleThreshold:      *staleThreshold,
+			Watch:               *collectWatch,
+		})
+		if err != nil {
+			return nil, err
+		}
+		set.byStateName[stateName] = exporter
+		registry := prometheus.NewRegistry()
+		if err := prometheus.WrapRegistererWith(labels, registry).Register(exporter); err != nil {
+			return nil, err
+		}
+		return registry, nil
+	}
+	stateNames := map[bool]string{false: "exporter_individuals", true: "exporter_aggregates"}
+
+	// Creates exporters for both individual-metric modes, so that
+	// scrapes may override the mode by passing ?individuals=<bool>.
+	buildSources := func(sources []exporters.StatusSource) (*sourceExporters, error) {
+		set := &sourceExporters{
+			byStateName: map[string]*exporters.OpenVPNExporter{},
+			registries:  map[bool]prometheus.Gatherers{},
+		}
+		if *configFile == "" {
+			set.overview = append(set.overview, flagSources...)
+			for _, ignore := range []bool{false, true} {
+				registry, err := newExporter(instancePaths[""], ignore, *aggregateClients, nil, *collectTimeout, exporters.StatusSource{}, stateNames[ignore], set)
+				if err != nil {
+					set.close()
+					return nil, err
+				}
+				set.registries[ignore] = append(set.registries[ignore], registry)
+			}
+			// Named instances are labeled by their name.
+			for _, name := range instanceNames {
+				for _, ignore := range []bool{false, true} {
+					labels := prometheus.Labels{"instance_name": name}
+					registry, err := newExporter(instancePaths[name], ignore, *aggregateClients, labels, *collectTimeout, exporters.StatusSource{}, stateNames[ignore]+"/"+name, set)
+					if err != nil {
+						set.close()
+						return nil, err
+					}
+					set.registries[ignore] = append(set.registries[ignore], registry)
+				}
+			}
+		}
+		// Configured sources are collected by exporters of their own,
+		// as their labels differ. Sources overriding the mode only
+		// need one.
+		for _, source := range sources {
+			set.overview = append(set.overview, exporters.OverviewSource{Name: source.Name, StatusPath: source.StatusPath()})
+			sourceRegistries := map[bool]*prometheus.Registry{}
+			for _, ignore := range []bool{false, true} {
+				if source.IgnoreIndividuals != nil && *source.IgnoreIndividuals != ignore {
+					continue
+				}
+				timeout := *collectTimeout
+				if source.Timeout > 0 {
+					timeout = source.Timeout
+				}
+				registry, err := newExporter([]string{source.StatusPath()}, ignore, *aggregateClients || source.Aggregate, source.Labels, timeout, source, stateNames[ignore]+"/"+source.Name, set)
+				if err != nil {
+					set.close()
+					return nil, err
+				}
+				sourceRegistries[ignore] = registry
+			}
+			for _, ignore := range []bool{false, true} {
+				registry, ok := sourceRegistries[ignore]
+				if !ok {
+					registry = sourceRegistries[!ignore]
+				}
+				set.registries[ignore] = append(set.registries[ignore], registry)
+			}
+		}
+		return set, nil
+	}
+	statusSources := newSourceReloader(*configFile, buildSources, state)
+	if err := statusSources.load(sources); err != nil {
+		panic(err)
+	}
+	if *configFile != "" {
+		go statusSources.watch()
+	}
+	// Instances run by systemd units are collected as sources of their
+	// own, named after their unit and labeled by their instance name.
+	if *discoverSystemd {
+		discoverer := exporters.NewSystemdDiscoverer(*discoverServerPath, *discoverClientPath, *discoverInterval, func(sources []exporters.StatusSource) error {
+			if err := statusSources.discover("systemd", sources); err != nil {
+				return err
+			}
+			slog.Info("Discovered systemd units changed", "units", len(sources))
+			return nil
+		})
+		discovered, err := discoverer.Discover()
+		if err != nil {
+			slog.Error("Failed to discover systemd units", "err", err)
+		} else if err := statusSources.discover("systemd", discovered); err != nil {
+			panic(err)
+		}
+		go discoverer.Run(discovered)
+	}
+	// Status files in watched directories are collected as sources of
+	// their own, named after their path and labeled by their name.
+	if *discoverDirs != "" {
+		discoverer, err := exporters.NewDirectoryDiscoverer(strings.Split(*discoverDirs, ","), *discoverPattern, *discoverRescan, func(sources []exporters.StatusSource) error {
+			if err := statusSources.discover("directories", sources); err != nil {
+				return err
+			}
+			slog.Info("Discovered status files changed", "status_files", len(sources))
+			return nil
+		})
+		if err != nil {
+			fatal("Invalid -discover.directories.pattern", "err", err)
+		}
+		discovered, err := discoverer.Discover()
+		if err != nil {
+			slog.Error("Failed to discover status files", "err", err)
+		} else if err := statusSources.discover("directories", discovered); err != nil {
+			panic(err)
+		}
+		prometheus.MustRegister(discoverer)
+		go discoverer.Run(discovered)
+	}
+	if *enableLifecycle {
+		http.Handle("/-/reload", statusSources)
+	} else {
+		http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Reloading is disabled, as -web.enable-lifecycle isn't set", http.StatusForbidden)
+		})
+	}
+
+	registries := map[bool]prometheus.Gatherer{}
+	handlers := map[bool]http.Handler{}
+	for _, ignore := range []bool{false, true} {
+		registries[ignore] = statusSources.gatherer(ignore)
+		handlers[ignore] = promhttp.HandlerFor(
+			prometheus.Gatherers{prometheus.DefaultGatherer, registries[ignore]},
+			promhttp.HandlerOpts{})
+	}
+
+	if *once {
+		if err := writeOnce(os.Stdout, registries[*ignoreIndividuals]); err != nil {
+			fatal("Failed to collect metrics", "err", err)
+		}
+		os.Exit(0)
+	}
+
+	prometheus.MustRegister(version.NewCollector("openvpn_exporter"))
+
+	http.Handle(*metricsPath, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ignore := *ignoreIndividuals
+			if value := r.URL.Query().Get("individuals"); value != "" {
+				individuals, err := strconv.ParseBool(value)
+				if err != nil {
+					http.Error(w, "Invalid value for individuals: "+value, http.StatusBadRequest)
+					return
+				}
+				ignore = !individuals
+			}
+			handlers[ignore].ServeHTTP(w, r)
+		})))
+
+	if *federationTargets != "" {
+		collector, err := exporters.NewFederationCollector(strings.Split(*federationTargets, ","), *federationTimeout)
+		if err != nil {
+			panic(err)
+		}
+		prometheus.MustRegister(collector)
+	}
+
+	var syslogForwarder *exporters.SyslogForwarder
+	if *syslogAddress != "" {
+		if *hooksPath == "" && *logPaths == "" {
+			fatal("-syslog.address requires -hooks.path or -openvpn.log_paths, which the forwarded events are taken from")
+		}
+		var err error
+		syslogForwarder, err = exporters.NewSyslogForwarder(*syslogAddress, *syslogFacility, *syslogAppName, *syslogTimeout)
+		if err != nil {
+			panic(err)
+		}
+		prometheus.MustRegister(syslogForwarder)
+		go syslogForwarder.Run()
+	}
+
+	if *logPaths != "" {
+		collector := exporters.NewLogCollector(strings.Split(*logPaths, ","), *logPollInterval)
+		if syslogForwarder != nil {
+			collector.SetSyslog(syslogForwarder)
+		}
+		prometheus.MustRegister(collector)
+		go collector.Run()
+	}
+
+	if *pidFiles != "" || *systemdUnits != "" {
+		var pidFileList, unitList []string
+		if *pidFiles != "" {
+			pidFileList = strings.Split(*pidFiles, ",")
+		}
+		if *systemdUnits != "" {
+			unitList = strings.Split(*systemdUnits, ",")
+		}
+		prometheus.MustRegister(exporters.NewProcessCollector(pidFileList, unitList, *systemdTimeout))
+	}
+
+	if *probeAddresses != "" {
+		collector, err := exporters.NewPortProbeCollector(strings.Split(*probeAddresses, ","), *probeTimeout)
+		if err != nil {
+			panic(err)
+		}
+		prometheus.MustRegister(collector)
+	}
+
+	if *handshakeProfiles != "" {
+		collector := exporters.NewHandshakeProbeCollector(*handshakeBinary, strings.Split(*handshakeProfiles, ","), *handshakeInterval, *handshakeTimeout)
+		prometheus.MustRegister(collector)
+		go collector.Run()
+	}
+
+	if *pingClients {
+		if *pingCount < 1 || *pingConcurrency < 1 {
+			fatal("-ping.count and -ping.concurrency should be at least 1")
+		}
+		if *pingRate < 1 || *pingRate > exporters.MaxPingRate {
+			fatal("-ping.rate should be between 1 and the maximum", "maximum", exporters.MaxPingRate)
+		}
+		collector := exporters.NewClientPingCollector(statusSources.statusPaths, *pingInterval, *pingTimeout, *pingCount, *pingConcurrency, *pingRate, *pingPrivileged)
+		prometheus.MustRegister(collector)
+		go collector.Run()
+	}
 
-	exporter, err := exporters.NewOpenVPNExporter(strings.Split(*openvpnStatusPaths, ","), *ignoreIndividuals)
+	if *quotaFile != "" {
+		collector, err := exporters.NewQuotaCollector(statusSources.statusPaths, *quotaFile, *quotaInterval)
+		if err != nil {
+			panic(err)
+		}
+		if state != nil {
+			if err := state.Register("quota", collector); err != nil {
+				slog.Error("Failed to restore state", "name", "quota", "err", err)
+			}
+		}
+		prometheus.MustRegister(collector)
+		go collector.Run()
+	}
+
+	if *anomalyDetect {
+		collector := exporters.NewTrafficAnomalyCollector(statusSources.statusPaths, *anomalyInterval, *anomalyHalfLife, *anomalyFactor, *anomalyMinRate)
+		prometheus.MustRegister(collector)
+		go collector.Run()
+	}
+
+	if *ldapURL != "" {
+		var password string
+		if *ldapBindPassword != "" {
+			data, err := ioutil.ReadFile(*ldapBindPassword)
+			if err != nil {
+				panic(err)
+			}
+			password = strings.TrimSpace(string(data))
+		}
+		collector, err := exporters.NewLDAPUserCollector(statusSources.statusPaths, *ldapURL, *ldapBindDN, password, *ldapBaseDN, *ldapFilter, strings.Split(*ldapAttributes, ","), *ldapCacheTTL, *ldapTimeout, *ldapInterval)
+		if err != nil {
+			panic(err)
+		}
+		prometheus.MustRegister(collector)
+		go collector.Run()
+	}
+
+	if *enrichmentURL != "" {
+		collector, err := exporters.NewEnrichmentCollector(statusSources.statusPaths, *enrichmentURL, strings.Split(*enrichmentLabels, ","), *enrichmentCacheTTL, *enrichmentTimeout, *enrichmentInterval)
+		if err != nil {
+			panic(err)
+		}
+		prometheus.MustRegister(collector)
+		go collector.Run()
+	}
+
+	if *coverageCCDDir != "" {
+		prometheus.MustRegister(exporters.NewCoverageCollector(statusSources.statusPaths, *coverageCCDDir))
+	}
+
+	if *debugTokenFile != "" {
+		token := readTokenFile("debug.token-file", *debugTokenFile)
+		http.Handle("/debug/status", exporters.NewStatusDebugHandler(statusSources.statusPaths, token))
+	}
+
+	if *hooksPath != "" {
+		// Script events are only accepted from anyone able to reach the
+		// web interface if they carry the token.
+		var token string
+		if *hooksListenSocket == "" {
+			if *hooksTokenFile == "" {
+				fatal("-hooks.token-file is required unless -hooks.listen-socket is set")
+			}
+			token = readTokenFile("hooks.token-file", *hooksTokenFile)
+		}
+		var instanceNames []string
+		if *hooksInstances != "" {
+			instanceNames = strings.Split(*hooksInstances, ",")
+		}
+		receiver := exporters.NewClientHookReceiver(token, instanceNames, privacy)
+		if *hooksSessionsFile != "" {
+			if err := receiver.SetSessionsFile(*hooksSessionsFile); err != nil {
+				panic(err)
+			}
+		}
+		if *hooksArchiveURL != "" {
+			if *hooksArchiveKeyID == "" || *hooksArchiveSecret == "" {
+				fatal("-hooks.sessions-archive.access-key-id and -hooks.sessions-archive.secret-access-key-file are required by -hooks.sessions-archive.url")
+			}
+			secret := readTokenFile("hooks.sessions-archive.secret-access-key-file", *hooksArchiveSecret)
+			archiver, err := exporters.NewSessionsArchiver(receiver, *hooksArchiveURL, *hooksArchiveRegion, *hooksArchiveKeyID, secret, *hooksArchiveInt, *hooksArchiveTime)
+			if err != nil {
+				panic(err)
+			}
+			prometheus.MustRegister(archiver)
+			go archiver.Run()
+		}
+		if *hooksWebhookURL != "" {
+			receiver.SetWebhook(*hooksWebhookURL, *hooksWebhookTime)
+		}
+		if syslogForwarder != nil {
+			receiver.SetSyslog(syslogForwarder)
+		}
+		prometheus.MustRegister(receiver)
+
+		if *hooksListenSocket != "" {
+			slog.Info("Listening for script events on unix socket", "path", *hooksListenSocket)
+			os.Remove(*hooksListenSocket)
+			listener, err := net.Listen("unix", *hooksListenSocket)
+			if err != nil {
+				panic(err)
+			}
+			mux := http.NewServeMux()
+			mux.Handle(*hooksPath, receiver)
+			go func() {
+				fatal("Failed to serve script events", "path", *hooksListenSocket, "err", http.Serve(listener, mux))
+			}()
+		} else {
+			http.Handle(*hooksPath, receiver)
+		}
+	}
+
+	if *agentxMaster != "" {
+		// Traffic totals are summed from the per-client metrics of the
+		// local status files.
+		subagent, err := exporters.NewAgentXSubagent(*agentxMaster, *agentxBaseOID, registries[false], *agentxTimeout)
+		if err != nil {
+			panic(err)
+		}
+		go subagent.Run()
+	}
+
+	if *zabbixServer != "" {
+		host := *zabbixHost
+		if host == "" {
+			var err error
+			if host, err = os.Hostname(); err != nil {
+				panic(err)
+			}
+		}
+		hosts := map[string]string{}
+		if *zabbixHosts != "" {
+			for _, pair := range strings.Split(*zabbixHosts, ",") {
+				fields := strings.SplitN(pair, "=", 2)
+				if len(fields) != 2 {
+					fatal("Invalid status_path=host pair in -zabbix.hosts", "pair", pair)
+				}
+				hosts[fields[0]] = fields[1]
+			}
+		}
+		sender := exporters.NewZabbixSender(*zabbixServer, host, hosts, *zabbixKeyPrefix, registries[false], *zabbixInterval, *zabbixTimeout)
+		go sender.Run()
+	}
+
+	if *pushGatewayURL != "" {
+		instance := *pushInstance
+		if instance == "" {
+			var err error
+			if instance, err = os.Hostname(); err != nil {
+				panic(err)
+			}
+		}
+		pusher, err := exporters.NewPushgatewayPusher(
+			*pushGatewayURL,
+			*pushJob,
+			instance,
+			prometheus.Gatherers{prometheus.DefaultGatherer, registries[*ignoreIndividuals]},
+			*pushInterval,
+			*pushTimeout)
+		if err != nil {
+			panic(err)
+		}
+		go pusher.Run()
+	}
+
+	if *remoteWriteURL != "" {
+		instance := *remoteWriteInst
+		if instance == "" {
+			var err error
+			if instance, err = os.Hostname(); err != nil {
+				panic(err)
+			}
+		}
+		var password, token string
+		if *remoteWritePass != "" {
+			data, err := ioutil.ReadFile(*remoteWritePass)
+			if err != nil {
+				panic(err)
+			}
+			password = strings.TrimSpace(string(data))
+		}
+		if *remoteWriteToken != "" {
+			data, err := ioutil.ReadFile(*remoteWriteToken)
+			if err != nil {
+				panic(err)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+		if *remoteWriteUser != "" && token != "" {
+			fatal("Only one of -remote-write.username and -remote-write.bearer-token-file may be set")
+		}
+		tlsConfig, err := newClientTLSConfig(*remoteWriteCA, *remoteWriteCert, *remoteWriteKey, *remoteWriteInsec)
+		if err != nil {
+			panic(err)
+		}
+		writer := exporters.NewRemoteWriter(
+			*remoteWriteURL,
+			*remoteWriteJob,
+			instance,
+			prometheus.Gatherers{prometheus.DefaultGatherer, registries[*ignoreIndividuals]},
+			*remoteWriteInt,
+			*remoteWriteTimeout,
+			*remoteWriteUser,
+			password,
+			token,
+			tlsConfig)
+		go writer.Run()
+	}
+
+	if *textfilePath != "" {
+		writer := exporters.NewTextfileWriter(
+			*textfilePath,
+			prometheus.Gatherers{prometheus.DefaultGatherer, registries[*ignoreIndividuals]},
+			*textfileInterval)
+		go writer.Run()
+	}
+
+	if err := runService(stop); err != nil {
+		fatal("Failed to run as a Windows service", "err", err)
+	}
+
+	// Hosts on which running a listening daemon isn't allowed may only
+	// write metrics to a textfile or push them elsewhere.
+	if *listenAddress == "" {
+		select {}
+	}
+
+	http.Handle("/", exporters.NewOverviewHandler(*metricsPath, statusSources.overview))
+	// The clients API is only served when a token is configured, as
+	// the clients of a server are sensitive.
+	if *apiTokenFile != "" {
+		handler := exporters.NewClientsHandler(statusSources.overview, privacy, readTokenFile("api.token-file", *apiTokenFile))
+		if *corsOrigins != "" {
+			handler.SetCORSOrigins(strings.Split(*corsOrigins, ","))
+		}
+		http.Handle("/api/v1/clients", handler)
+	}
+
+	if *tlsCertFile == "" && *tlsKeyFile == "" {
+		fatal("Failed to serve web interface", "err", http.ListenAndServe(*listenAddress, nil))
+	}
+	reloader, err := newCertificateReloader(*tlsCertFile, *tlsKeyFile)
 	if err != nil {
 		panic(err)
 	}
-	prometheus.MustRegister(exporter)
-
-	http.Handle(*metricsPath, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`
-			<html>
-			<head><title>OpenVPN Exporter</title></head>
-			<body>
-			<h1>OpenVPN Exporter</h1>
-			<p><a href='` + *metricsPath + `'>Metrics</a></p>
-			</body>
-			</html>`))
-	})
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	go reloader.watch(*tlsReloadInterval)
+	server := &http.Server{
+		Addr:      *listenAddress,
+		TLSConfig: &tls.Config{GetCertificate: reloader.getCertificate},
+	}
+	fatal("Failed to serve web interface", "err", server.ListenAndServeTLS("", ""))
 }
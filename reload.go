@@ -0,0 +1,224 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/kumina/openvpn_exporter/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// The exporters of a set of status sources, indexed by the name under
+// which their state is persisted, and the registries containing them for
+// both individual-metric modes, along with the sources as listed on the
+// overview page and by the clients API.
+type sourceExporters struct {
+	byStateName map[string]*exporters.OpenVPNExporter
+	registries  map[bool]prometheus.Gatherers
+	overview    []exporters.OverviewSource
+}
+
+// Stops the exporters from watching their status files.
+func (s *sourceExporters) close() {
+	for _, exporter := range s.byStateName {
+		exporter.Close()
+	}
+}
+
+// Holds the exporters of the status sources, rebuilding them from the
+// configuration file on SIGHUP or, if enabled, a POST to /-/reload, and
+// whenever the discovered sources change. The exporters are only swapped
+// once all of them have been created, so that a broken configuration file
+// leaves the running ones untouched. Stateful collectors of sources that remain
+// configured keep their state.
+type sourceReloader struct {
+	configFile string
+	build      func(sources []exporters.StatusSource) (*sourceExporters, error)
+	// State file with which the exporters are registered, if any.
+	state *exporters.StateFile
+
+	// Serializes rebuilding the exporters.
+	loadMutex  sync.Mutex
+	configured []exporters.StatusSource
+	// Discovered sources, indexed by the name of their discoverer.
+	discovered map[string][]exporters.StatusSource
+
+	mutex   sync.RWMutex
+	current *sourceExporters
+}
+
+func newSourceReloader(configFile string, build func(sources []exporters.StatusSource) (*sourceExporters, error), state *exporters.StateFile) *sourceReloader {
+	return &sourceReloader{
+		configFile: configFile,
+		build:      build,
+		state:      state,
+		discovered: map[string][]exporters.StatusSource{},
+	}
+}
+
+// Creates the exporters of the given sources of the configuration file,
+// along with those of the discovered sources, and swaps them with the
+// current ones.
+func (r *sourceReloader) load(sources []exporters.StatusSource) error {
+	r.loadMutex.Lock()
+	defer r.loadMutex.Unlock()
+	if err := r.swap(sources, r.discovered); err != nil {
+		return err
+	}
+	r.configured = sources
+	return nil
+}
+
+// Replaces the sources found by a discoverer.
+func (r *sourceReloader) discover(discoverer string, sources []exporters.StatusSource) error {
+	r.loadMutex.Lock()
+	defer r.loadMutex.Unlock()
+	discovered := map[string][]exporters.StatusSource{discoverer: sources}
+	for name, sources := range r.discovered {
+		if name != discoverer {
+			discovered[name] = sources
+		}
+	}
+	if err := r.swap(r.configured, discovered); err != nil {
+		return err
+	}
+	r.discovered = discovered
+	return nil
+}
+
+func (r *sourceReloader) swap(configured []exporters.StatusSource, discovered map[string][]exporters.StatusSource) error {
+	sources := append([]exporters.StatusSource{}, configured...)
+	var discoverers []string
+	for name := range discovered {
+		discoverers = append(discoverers, name)
+	}
+	sort.Strings(discoverers)
+	for _, name := range discoverers {
+		sources = append(sources, discovered[name]...)
+	}
+	next, err := r.build(sources)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for name, exporter := range next.byStateName {
+		if r.state != nil {
+			if err := r.state.Register(name, exporter); err != nil {
+				slog.Error("Failed to restore state", "name", name, "err", err)
+			}
+		}
+		if r.current == nil {
+			continue
+		}
+		if previous, ok := r.current.byStateName[name]; ok {
+			state, err := previous.SaveState()
+			if err == nil {
+				err = exporter.LoadState(state)
+			}
+			if err != nil {
+				slog.Error("Failed to carry over state", "name", name, "err", err)
+			}
+		}
+	}
+	if r.current != nil {
+		// The state of sources that were removed is forgotten.
+		for name := range r.current.byStateName {
+			if _, ok := next.byStateName[name]; !ok && r.state != nil {
+				r.state.Unregister(name)
+			}
+		}
+		r.current.close()
+	}
+	r.current = next
+	return nil
+}
+
+// Re-reads the configuration file.
+func (r *sourceReloader) reload() error {
+	if r.configFile == "" {
+		return fmt.Errorf("no configuration file given using -config.file")
+	}
+	config, err := exporters.LoadConfig(r.configFile)
+	if err != nil {
+		return err
+	}
+	if err := r.load(config.Sources); err != nil {
+		return err
+	}
+	slog.Info("Reloaded configuration file", "path", r.configFile)
+	return nil
+}
+
+// Returns a gatherer of the metrics of the current exporters in the given
+// individual-metric mode. Exporters are only closed once the scrapes using
+// them are done, as their collectors may hold databases.
+func (r *sourceReloader) gatherer(ignore bool) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+		return r.current.registries[ignore].Gather()
+	})
+}
+
+// Returns the current sources, as listed on the overview page and by the
+// clients API.
+func (r *sourceReloader) overview() []exporters.OverviewSource {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.current.overview
+}
+
+// Returns the status paths of the current sources, for the collectors that
+// read the clients connected to the servers on their own.
+func (r *sourceReloader) statusPaths() []string {
+	var statusPaths []string
+	for _, source := range r.overview() {
+		statusPaths = append(statusPaths, source.StatusPath)
+	}
+	return statusPaths
+}
+
+// Reloads the configuration file on SIGHUP. It never returns.
+func (r *sourceReloader) watch() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := r.reload(); err != nil {
+			slog.Error("Failed to reload configuration file", "path", r.configFile, "err", err)
+		}
+	}
+}
+
+// Reloads the configuration file on POST requests, responding with the
+// error if reloading failed.
+func (r *sourceReloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload configuration file: %s", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package main
+
+import (
+	"golang.org/x/sys/windows/svc"
+	"os"
+)
+
+// Runs the exporter as a Windows service if it was started by the service
+// control manager, reporting it as running. Once the service is asked to
+// stop, or the system shuts down, stop is called before exiting.
+func runService(stop func()) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return err
+	}
+	go func() {
+		// The name is ignored for services running in a process of
+		// their own.
+		if err := svc.Run("openvpn_exporter", service{stop: stop}); err != nil {
+			fatal("Failed to run as a Windows service", "err", err)
+		}
+		os.Exit(0)
+	}()
+	return nil
+}
+
+type service struct {
+	stop func()
+}
+
+func (s service) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			s.stop()
+			return false, 0
+		}
+	}
+	return false, 0
+}
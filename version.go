@@ -0,0 +1,44 @@
+// Copyright 2017 Kumina, https://kumina.nl/
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prometheus/common/version"
+	"runtime/debug"
+)
+
+// Fills in the build information that wasn't set using -ldflags from the
+// information embedded by the Go toolchain, e.g. when built using go
+// install or a plain go build.
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if version.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if version.Revision == "" {
+				version.Revision = setting.Value
+			}
+		case "vcs.time":
+			if version.BuildDate == "" {
+				version.BuildDate = setting.Value
+			}
+		}
+	}
+}